@@ -17,6 +17,7 @@
 package internal
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"flag"
@@ -28,6 +29,7 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"strings"
 	"syscall"
 
 	"github.com/maruel/panicparse/v2/stack"
@@ -48,6 +50,7 @@ var defaultPalette = Palette{
 	RoutineFirst:                ansi.ColorCode("magenta+b"),
 	CreatedBy:                   ansi.LightBlack,
 	Race:                        ansi.LightRed,
+	Recursion:                   ansi.LightYellow,
 	Package:                     ansi.ColorCode("default+b"),
 	SrcFile:                     resetFG,
 	FuncMain:                    ansi.ColorCode("yellow+b"),
@@ -84,31 +87,34 @@ func writeBucketsToConsole(out io.Writer, p *Palette, a *stack.Aggregated, pf pa
 	return nil
 }
 
-func writeGoroutinesToConsole(out io.Writer, p *Palette, s *stack.Snapshot, pf pathFormat, needsEnv bool, filter, match *regexp.Regexp) error {
-	if needsEnv {
-		_, _ = io.WriteString(out, "\nTo see all goroutines, visit https://github.com/maruel/panicparse#gotraceback\n\n")
-	}
-	srcLen, pkgLen := calcGoroutinesLengths(s, pf)
-	multi := len(s.Goroutines) > 1
-	for _, e := range s.Goroutines {
-		header := p.GoroutineHeader(e, pf, multi)
+// writeRaceToConsole prints the data race report, unless filter matches the
+// header of one of the goroutines or match matches none.
+func writeRaceToConsole(out io.Writer, p *Palette, r *stack.RaceReport, pf pathFormat, needsEnv bool, filter, match *regexp.Regexp) error {
+	matched := match == nil
+	for _, g := range r.Accesses() {
+		header := p.GoroutineHeader(g, pf, true)
 		if filter != nil && filter.MatchString(header) {
-			continue
+			return nil
 		}
-		if match != nil && !match.MatchString(header) {
-			continue
+		if match != nil && match.MatchString(header) {
+			matched = true
 		}
-		_, _ = io.WriteString(out, header)
-		_, _ = io.WriteString(out, p.StackLines(&e.Signature, srcLen, pkgLen, pf))
 	}
-	return nil
+	if !matched {
+		return nil
+	}
+	if needsEnv {
+		_, _ = io.WriteString(out, "\nTo see all goroutines, visit https://github.com/maruel/panicparse#gotraceback\n\n")
+	}
+	_, err := io.WriteString(out, p.RaceLines(r, pf))
+	return err
 }
 
 type toHTMLer interface {
-	ToHTML(io.Writer, template.HTML) error
+	ToHTMLWithOptions(io.Writer, *stack.HTMLOpts) error
 }
 
-func toHTML(h toHTMLer, p string, needsEnv bool) error {
+func toHTML(h toHTMLer, p string, needsEnv bool, links *stack.LinkResolver, races *stack.RaceReports) error {
 	f, err := os.Create(p)
 	if err != nil {
 		return err
@@ -117,16 +123,31 @@ func toHTML(h toHTMLer, p string, needsEnv bool) error {
 	if needsEnv {
 		footer = "To see all goroutines, visit <a href=https://github.com/maruel/panicparse#gotraceback>github.com/maruel/panicparse</a>"
 	}
-	err = h.ToHTML(f, footer)
+	err = h.ToHTMLWithOptions(f, &stack.HTMLOpts{Footer: footer, Links: links, Races: races})
 	if err2 := f.Close(); err == nil {
 		err = err2
 	}
 	return err
 }
 
-func processInner(out io.Writer, p *Palette, s stack.Similarity, pf pathFormat, html string, filter, match *regexp.Regexp, c *stack.Snapshot, first bool) error {
+// raceState is the data races found in the input.
+type raceState struct {
+	stack.RaceReports
+	// snapshot is the first snapshot with a data race. With -html, all the
+	// data races are written at the end, using it for the metadata.
+	snapshot *stack.Snapshot
+	needsEnv bool
+}
+
+func processInner(out io.Writer, p *Palette, s stack.Similarity, pf pathFormat, html string, links *stack.LinkResolver, filter, match *regexp.Regexp, races *raceState, c *stack.Snapshot, first bool) error {
 	log.Printf("GOROOT=%s", c.RemoteGOROOT)
 	log.Printf("GOPATH=%s", c.RemoteGOPATHs)
+	if c.RemoteGoVersion != "" {
+		log.Printf("Go version=%s", c.RemoteGoVersion)
+	}
+	if c.BuildInfo != nil {
+		log.Printf("Binary=%s %s built with %s", c.BuildInfo.Main.Path, c.BuildInfo.Main.Version, c.BuildInfo.GoVersion)
+	}
 	needsEnv := len(c.Goroutines) == 1 && showBanner()
 	// Bucketing should only be done if no data race was detected.
 	if !c.IsRace() {
@@ -134,20 +155,76 @@ func processInner(out io.Writer, p *Palette, s stack.Similarity, pf pathFormat,
 		if html == "" {
 			return writeBucketsToConsole(out, p, a, pf, needsEnv, filter, match)
 		}
-		return toHTML(a, html, needsEnv)
+		return toHTML(a, html, needsEnv, links, nil)
+	}
+	// It's a data race. Only print the first occurrence of each.
+	if !races.Add(c.Race) {
+		log.Printf("Skipping duplicate data race")
+		return nil
 	}
-	// It's a data race.
 	if html == "" {
-		return writeGoroutinesToConsole(out, p, c, pf, needsEnv, filter, match)
+		return writeRaceToConsole(out, p, c.Race, pf, needsEnv, filter, match)
+	}
+	if races.snapshot == nil {
+		races.snapshot = c
+		races.needsEnv = needsEnv
+	}
+	return nil
+}
+
+// writeDiagnostics prints the issues found while processing a snapshot.
+func writeDiagnostics(out io.Writer, diags []stack.Diagnostic) error {
+	if len(diags) == 0 {
+		return nil
+	}
+	if _, err := io.WriteString(out, "Diagnostics:\n"); err != nil {
+		return err
+	}
+	for _, d := range diags {
+		if _, err := fmt.Fprintf(out, "  %s\n", d.String()); err != nil {
+			return err
+		}
 	}
-	return toHTML(c, html, needsEnv)
+	return nil
+}
+
+// inputCounter counts the bytes and the lines read from r.
+type inputCounter struct {
+	r     io.Reader
+	bytes int64
+	lines int
+}
+
+func (i *inputCounter) Read(b []byte) (int, error) {
+	n, err := i.r.Read(b)
+	i.bytes += int64(n)
+	i.lines += bytes.Count(b[:n], lf)
+	return n, err
+}
+
+var lf = []byte{'\n'}
+
+// inputPosition is a position in the input, in bytes and in lines.
+type inputPosition struct {
+	offset int64
+	line   int
 }
 
 // process copies stdin to stdout and processes any "panic: " line found.
 //
-// If html is used, a stack trace is written to this file instead.
-func process(in io.Reader, out io.Writer, p *Palette, s stack.Similarity, pf pathFormat, parse, rebase bool, html string, filter, match *regexp.Regexp) error {
+// If html is used, a stack trace is written to this file instead. links is
+// used to link to the source files in the HTML file. logPrefix, if set, is
+// removed from each line before parsing. If diagnose is set, the issues found
+// while parsing each snapshot are printed after it.
+//
+// pos is the position in the input of the beginning of in. It is updated to
+// the position of its end, so the positions reported for the snapshots are
+// relative to the whole input when it is processed with multiple calls. It
+// can be nil.
+func process(in io.Reader, pos *inputPosition, out io.Writer, p *Palette, s stack.Similarity, pf pathFormat, parse, rebase, diagnose bool, binary, html string, links *stack.LinkResolver, logPrefix, filter, match *regexp.Regexp) error {
 	opts := stack.DefaultOpts()
+	opts.Binary = binary
+	opts.LogPrefix = logPrefix
 	if !rebase {
 		opts.GuessPaths = false
 		opts.AnalyzeSources = false
@@ -155,14 +232,32 @@ func process(in io.Reader, out io.Writer, p *Palette, s stack.Similarity, pf pat
 	if !parse {
 		opts.AnalyzeSources = false
 	}
+	if pos == nil {
+		pos = &inputPosition{}
+	}
+	opts.InputOffset, opts.InputLine = pos.offset, pos.line
+	defer func() {
+		pos.offset, pos.line = opts.InputOffset, opts.InputLine
+	}()
+	races := &raceState{}
 	for first := true; ; first = false {
-		c, suffix, err := stack.ScanSnapshot(in, out, opts)
+		ic := &inputCounter{r: in}
+		c, suffix, err := stack.ScanSnapshot(ic, out, opts)
 		if c != nil {
 			// Process it even if an error occurred.
-			if err1 := processInner(out, p, s, pf, html, filter, match, c, first); err == nil {
+			if err1 := processInner(out, p, s, pf, html, links, filter, match, races, c, first); err == nil {
 				err = err1
 			}
+			if diagnose {
+				if err1 := writeDiagnostics(out, c.Diagnostics); err == nil {
+					err = err1
+				}
+			}
 		}
+		// The suffix is fed back to the next call, so the positions reported
+		// for the next snapshot are relative to the start of the input.
+		opts.InputOffset += ic.bytes - int64(len(suffix))
+		opts.InputLine += ic.lines - bytes.Count(suffix, lf)
 		if err == nil {
 			// This means the whole buffer was not read, loop again.
 			in = io.MultiReader(bytes.NewReader(suffix), in)
@@ -174,6 +269,13 @@ func process(in io.Reader, out io.Writer, p *Palette, s stack.Similarity, pf pat
 			}
 		}
 		if err == io.EOF {
+			if races.snapshot != nil {
+				return toHTML(races.snapshot, html, races.needsEnv, links, &races.RaceReports)
+			}
+			if races.Total > 1 {
+				_, err = fmt.Fprintf(out, "\n%s\n", &races.RaceReports)
+				return err
+			}
 			return nil
 		}
 		// Parts of the input will be lost.
@@ -196,14 +298,26 @@ func Main() error {
 	aggressive := flag.Bool("aggressive", false, "Aggressive deduplication including non pointers")
 	parse := flag.Bool("parse", true, "Parses source files to deduct types; use -parse=false to work around bugs in source parser")
 	rebase := flag.Bool("rebase", true, "Guess GOROOT and GOPATH")
+	binary := flag.String("binary", "", "Executable that generated the stack trace, to read its build information for exact versions and resolve unknown source locations")
 	verboseFlag := flag.Bool("v", false, "Enables verbose logging output")
+	diagnose := flag.Bool("diagnose", false, "Print the issues found while parsing: unparsed lines, truncated traces, unresolved source paths and source analysis failures")
 	filterFlag := flag.String("f", "", "Regexp to filter out headers that match, ex: -f 'IO wait|syscall'")
 	matchFlag := flag.String("m", "", "Regexp to filter by only headers that match, ex: -m 'semacquire'")
+	jsonFlag := flag.Bool("json", false, "Decode JSON log lines, like Docker json-file logs, before parsing")
+	jsonFields := flag.String("json-fields", strings.Join(stack.DefaultJSONLogFields(), ","), "Comma separated JSON fields containing the log text or the stack trace; implies -json when set")
+	logPrefixFlag := flag.String("log-prefix", "", "Log prefix to remove from each line, one of auto, cri, rfc3339, syslog or a regexp, ex: -log-prefix cri")
+	var links linkFlags
+	flag.Var(&links, "link", "Template to link to source files as prefix=URL, can be specified multiple times, ex: -link 'git.example.com/=https://git.example.com/{repo}/blob/{ref}/{path}#L{line}'")
+	var docs docFlags
+	flag.Var(&docs, "doc", "Documentation server base URL as [prefix=]URL, can be specified multiple times, ex: -doc 'git.example.com/=https://pkgsite.example.com/'")
+	srcs := docFlags{src: true}
+	flag.Var(&srcs, "doc-src", "Source server base URL as [prefix=]URL, can be specified multiple times, ex: -doc-src 'https://godoc.example.com/src/'")
 	// Console only.
 	fullPathArg := flag.Bool("full-path", false, "Print full sources path")
 	relPathArg := flag.Bool("rel-path", false, "Print sources path relative to GOROOT or GOPATH; implies -rebase")
 	noColor := flag.Bool("no-color", !isatty.IsTerminal(os.Stdout.Fd()) || os.Getenv("TERM") == "dumb", "Disable coloring")
 	forceColor := flag.Bool("force-color", false, "Forcibly enable coloring when with stdout is redirected")
+	hyperlinks := flag.Bool("hyperlinks", false, "Print source references as terminal hyperlinks to the source files")
 	// HTML only.
 	html := flag.String("html", "", "Output an HTML file")
 
@@ -263,17 +377,34 @@ func Main() error {
 		}
 	}
 
+	var logPrefix *regexp.Regexp
+	if *logPrefixFlag != "" {
+		if logPrefix = logPrefixes[*logPrefixFlag]; logPrefix == nil {
+			if logPrefix, err = regexp.Compile(*logPrefixFlag); err != nil {
+				return err
+			}
+		}
+	}
+
 	s := stack.AnyPointer
 	if *aggressive {
 		s = stack.AnyValue
 	}
 
+	l := stack.DefaultLinkResolver()
+	l.Templates = append(l.Templates, links...)
+	l.DocServers = append(docs.servers, srcs.servers...)
 	if *html == "" {
 		if *noColor && !*forceColor {
 			p = &Palette{}
 		} else {
 			out = colorable.NewColorableStdout()
 		}
+		if *hyperlinks {
+			c := *p
+			c.Links = l
+			p = &c
+		}
 	}
 
 	var in *os.File
@@ -301,6 +432,15 @@ func Main() error {
 	default:
 		return errors.New("pipe from stdin or specify a single file")
 	}
+	var r io.Reader = in
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "json-fields" {
+			*jsonFlag = true
+		}
+	})
+	if *jsonFlag {
+		r = stack.NewJSONLogReader(r, strings.Split(*jsonFields, ","))
+	}
 	pf := basePath
 	if *fullPathArg {
 		if *relPathArg {
@@ -311,5 +451,158 @@ func Main() error {
 		pf = relPath
 		*rebase = true
 	}
-	return process(in, out, p, s, pf, *parse, *rebase, *html, filter, match)
+	// The positions are relative to the decoded text when -json is used or with
+	// a "go test -json" stream, see processTestJSON.
+	pos := &inputPosition{}
+	proc := func(in io.Reader) error {
+		return process(in, pos, out, p, s, pf, *parse, *rebase, *diagnose, *binary, *html, l, logPrefix, filter, match)
+	}
+	// Look at the first lines to detect the format.
+	br := bufio.NewReader(r)
+	head, isJSON, err := detectTestJSON(br)
+	if err != nil {
+		return err
+	}
+	r = io.MultiReader(bytes.NewReader(head), br)
+	if isJSON {
+		return processTestJSON(r, out, proc)
+	}
+	return proc(r)
+}
+
+// detectTestJSON reads the beginning of br to determine if it is a "go test
+// -json" stream and returns the lines read.
+//
+// The decision is made on the first line that looks like JSON. The empty
+// lines and the build output, like "# pkg" followed by compiler errors, that
+// are printed before the test events are skipped. Any other line means it is
+// not a test stream, so the output is not delayed for a normal trace.
+func detectTestJSON(br *bufio.Reader) ([]byte, bool, error) {
+	var head []byte
+	build := false
+	for {
+		line, err := br.ReadBytes('\n')
+		head = append(head, line...)
+		if err != nil && err != io.EOF {
+			return head, false, err
+		}
+		if t := bytes.TrimSpace(line); len(t) != 0 {
+			if t[0] == '{' {
+				return head, stack.IsTestJSON(t), nil
+			}
+			if bytes.HasPrefix(t, buildHeader) {
+				build = true
+			} else if !build {
+				return head, false, nil
+			}
+		}
+		if err == io.EOF {
+			return head, false, nil
+		}
+	}
+}
+
+// buildHeader is the start of the package header printed by the go tool
+// before build errors.
+var buildHeader = []byte("# ")
+
+// processTestJSON reconstructs the output of each package of a "go test
+// -json" stream and processes it with proc as soon as its tests ended.
+//
+// When a package panicked, the test that panicked and the tests that were
+// still running are printed after its output, even if proc failed.
+//
+// The positions reported, like the line numbers printed with -diagnose, are
+// relative to the reconstructed output of the packages, one after the other
+// in the order they are processed, not to the JSON stream.
+func processTestJSON(in io.Reader, out io.Writer, proc func(io.Reader) error) error {
+	return stack.ScanTestJSON(in, func(t *stack.TestOutput) error {
+		err := proc(bytes.NewReader(t.Output))
+		if err2 := printPanicTests(out, t); err == nil {
+			err = err2
+		}
+		return err
+	})
+}
+
+// printPanicTests prints the test that panicked and the tests that were still
+// running, if the package panicked.
+func printPanicTests(out io.Writer, t *stack.TestOutput) error {
+	if t.PanicTest != "" {
+		if _, err := fmt.Fprintf(out, "\nPackage %s: panic in %s\n", t.Package, t.PanicTest); err != nil {
+			return err
+		}
+	} else if len(t.Running) != 0 {
+		if _, err := fmt.Fprintf(out, "\nPackage %s: panic\n", t.Package); err != nil {
+			return err
+		}
+	}
+	if len(t.Running) != 0 {
+		_, err := fmt.Fprintf(out, "Tests running: %s\n", strings.Join(t.Running, ", "))
+		return err
+	}
+	return nil
+}
+
+// logPrefixes are the presets for -log-prefix.
+var logPrefixes = map[string]*regexp.Regexp{
+	"auto":    stack.LogPrefixAuto,
+	"cri":     stack.LogPrefixCRI,
+	"rfc3339": stack.LogPrefixRFC3339,
+	"syslog":  stack.LogPrefixSyslog,
+}
+
+// linkFlags is a repeatable flag of link templates in the form prefix=URL.
+type linkFlags []stack.LinkTemplate
+
+func (l *linkFlags) String() string {
+	var out []string
+	for _, t := range *l {
+		out = append(out, t.Prefix+"="+t.URL)
+	}
+	return strings.Join(out, ",")
+}
+
+func (l *linkFlags) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("invalid link template %q, expected prefix=URL", s)
+	}
+	*l = append(*l, stack.LinkTemplate{Prefix: s[:i], URL: s[i+1:]})
+	return nil
+}
+
+// docFlags is a repeatable flag of documentation or source servers in the
+// form [prefix=]URL.
+type docFlags struct {
+	src     bool
+	servers []stack.DocServer
+}
+
+func (d *docFlags) String() string {
+	var out []string
+	for _, s := range d.servers {
+		u := s.DocURL
+		if d.src {
+			u = s.SrcURL
+		}
+		if s.Prefix != "" {
+			u = s.Prefix + "=" + u
+		}
+		out = append(out, u)
+	}
+	return strings.Join(out, ",")
+}
+
+func (d *docFlags) Set(s string) error {
+	prefix, s := stack.SplitDocServer(s)
+	if s == "" {
+		return errors.New("invalid empty server URL")
+	}
+	if d.src {
+		d.servers = append(d.servers, stack.DocServer{Prefix: prefix, SrcURL: s})
+	} else {
+		d.servers = append(d.servers, stack.DocServer{Prefix: prefix, DocURL: s})
+	}
+	return nil
 }
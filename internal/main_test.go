@@ -5,9 +5,12 @@
 package internal
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -81,7 +84,7 @@ func TestProcess(t *testing.T) {
 			t.Parallel()
 			out := bytes.Buffer{}
 			r := bytes.NewReader(internaltest.PanicOutputs()["simple"])
-			if err := process(r, &out, line.palette, line.simil, line.path, false, true, "", line.filter, line.match); err != nil {
+			if err := process(r, nil, &out, line.palette, line.simil, line.path, false, true, false, "", "", nil, nil, line.filter, line.match); err != nil {
 				t.Fatal(err)
 			}
 			compareString(t, line.want, out.String())
@@ -98,7 +101,7 @@ func TestProcessTwoSnapshots(t *testing.T) {
 	in.WriteString("Ye\n")
 	in.Write(internaltest.PanicOutputs()["int"])
 	in.WriteString("Yo\n")
-	err := process(&in, &out, &Palette{}, stack.AnyPointer, basePath, false, true, "", nil, nil)
+	err := process(&in, nil, &out, &Palette{}, stack.AnyPointer, basePath, false, true, false, "", "", nil, nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -118,6 +121,237 @@ func TestProcessTwoSnapshots(t *testing.T) {
 	compareString(t, want, out.String())
 }
 
+func TestProcessDiagnose(t *testing.T) {
+	t.Parallel()
+	out := bytes.Buffer{}
+	in := strings.NewReader(strings.Join([]string{
+		"Ya",
+		"panic: a",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:8 +0x25",
+		"junk",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"",
+	}, "\n"))
+	err := process(in, nil, &out, &Palette{}, stack.AnyPointer, basePath, false, false, true, "", "", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ("Ya\n" +
+		"panic: a\n\n" +
+		"1: running\n" +
+		"    main main.go:8 main()\n" +
+		"Diagnostics:\n" +
+		"  line 7: UnparsedLine \"junk\": end of snapshot\n" +
+		"junk\n" +
+		"1: running\n" +
+		"    main :0 main()\n" +
+		"Diagnostics:\n" +
+		"  line 9: Truncated: input ended in the middle of goroutine 1\n")
+	compareString(t, want, out.String())
+}
+
+func TestProcessRaces(t *testing.T) {
+	t.Parallel()
+	out := bytes.Buffer{}
+	in := bytes.Buffer{}
+	in.Write(internaltest.StaticPanicRaceOutput())
+	in.WriteString("junk\n")
+	in.Write(internaltest.StaticPanicRaceOutput())
+	err := process(&in, nil, &out, &Palette{}, stack.AnyPointer, basePath, false, false, false, "", "", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ("\n" +
+		"GOTRACEBACK=all\n" +
+		"Data race @ 0xc000014100\n" +
+		"Read by goroutine 8                    | Previous write by goroutine 7\n" +
+		"    main main.go:137 panicDoRaceRead() |     main main.go:132 panicDoRaceWrite()\n" +
+		"    main main.go:154 panicRace.func2() |     main main.go:151 panicRace.func1()\n" +
+		"Goroutine 8 (running) created at:\n" +
+		"    main main.go:153 panicRace()\n" +
+		"    main main.go:54  main()\n" +
+		"Goroutine 7 (running) created at:\n" +
+		"    main main.go:150 panicRace()\n" +
+		"    main main.go:54  main()\n" +
+		"junk\n" +
+		"\n" +
+		"GOTRACEBACK=all\n" +
+		"\n" +
+		"1 unique race, 2 occurrences\n")
+	compareString(t, want, out.String())
+}
+
+func TestWriteRaceToConsoleNeedsEnv(t *testing.T) {
+	t.Parallel()
+	c, _, err := stack.ScanSnapshot(bytes.NewReader(internaltest.StaticPanicRaceOutput()), ioutil.Discard, stack.DefaultOpts())
+	if c == nil || c.Race == nil {
+		t.Fatalf("expected a data race: %v", err)
+	}
+	out := bytes.Buffer{}
+	if err := writeRaceToConsole(&out, &Palette{}, c.Race, basePath, true, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "\nTo see all goroutines, visit https://github.com/maruel/panicparse#gotraceback\n\nData race @ ") {
+		t.Fatalf("missing GOTRACEBACK hint:\n%s", out.String())
+	}
+}
+
+func TestProcessRacesHTML(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	race := string(internaltest.StaticPanicRaceOutput())
+	// A different race.
+	different := strings.Replace(race, "main.go:137", "main.go:138", 1)
+	in := strings.NewReader(race + different + race)
+	p := filepath.Join(dir, "races.html")
+	if err = process(in, nil, ioutil.Discard, &Palette{}, stack.AnyPointer, basePath, false, false, false, "", p, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(raw)
+	for _, want := range []string{
+		`<div class="bucket" id="race" `,
+		`<span class="count">[2 occurrences]</span>`,
+		`main.go:137</a>`,
+		`<div class="bucket" id="race1" `,
+		`main.go:138</a>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+func TestProcessLogPrefix(t *testing.T) {
+	t.Parallel()
+	out := bytes.Buffer{}
+	in := bytes.Buffer{}
+	for _, l := range strings.SplitAfter(string(internaltest.StaticPanicRaceOutput()), "\n") {
+		if l != "" {
+			in.WriteString("2024-01-02T03:04:05.123456789Z stderr F " + l)
+		}
+	}
+	err := process(&in, nil, &out, &Palette{}, stack.AnyPointer, basePath, false, false, false, "", "", nil, logPrefixes["cri"], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ("2024-01-02T03:04:05.123456789Z stderr F \n" +
+		"2024-01-02T03:04:05.123456789Z stderr F GOTRACEBACK=all\n" +
+		"Data race @ 0xc000014100\n" +
+		"Read by goroutine 8                    | Previous write by goroutine 7\n" +
+		"    main main.go:137 panicDoRaceRead() |     main main.go:132 panicDoRaceWrite()\n" +
+		"    main main.go:154 panicRace.func2() |     main main.go:151 panicRace.func1()\n" +
+		"Goroutine 8 (running) created at:\n" +
+		"    main main.go:153 panicRace()\n" +
+		"    main main.go:54  main()\n" +
+		"Goroutine 7 (running) created at:\n" +
+		"    main main.go:150 panicRace()\n" +
+		"    main main.go:54  main()\n")
+	compareString(t, want, out.String())
+}
+
+func TestProcessTestJSON(t *testing.T) {
+	t.Parallel()
+	in := "" +
+		`{"Action":"run","Package":"example.com/a","Test":"TestSlow"}` + "\n" +
+		`{"Action":"run","Package":"example.com/b","Test":"TestOk"}` + "\n" +
+		`{"Action":"output","Package":"example.com/b","Test":"TestOk","Output":"ok\n"}` + "\n" +
+		`{"Action":"pass","Package":"example.com/b","Test":"TestOk"}` + "\n" +
+		`{"Action":"output","Package":"example.com/a","Output":"panic: test timed out after 1s\n"}` + "\n" +
+		`{"Action":"output","Package":"example.com/a","Output":"\n"}` + "\n" +
+		`{"Action":"output","Package":"example.com/a","Output":"goroutine 1 [running]:\n"}` + "\n" +
+		`{"Action":"output","Package":"example.com/a","Output":"main.main()\n"}` + "\n" +
+		`{"Action":"output","Package":"example.com/a","Output":"\t/gopath/src/foo/main.go:8 +0x25\n"}` + "\n"
+	out := bytes.Buffer{}
+	// The positions continue from one package to the next.
+	pos := &inputPosition{}
+	proc := func(in io.Reader) error {
+		return process(in, pos, &out, &Palette{}, stack.AnyPointer, basePath, false, false, false, "", "", nil, nil, nil, nil)
+	}
+	if err := processTestJSON(strings.NewReader(in), &out, proc); err != nil {
+		t.Fatal(err)
+	}
+	want := ("panic: test timed out after 1s\n" +
+		"\n" +
+		"1: running\n" +
+		"    main main.go:8 main()\n" +
+		"\n" +
+		"Package example.com/a: panic\n" +
+		"Tests running: TestSlow\n" +
+		"ok\n")
+	compareString(t, want, out.String())
+	if pos.line != 6 || pos.offset != 103 {
+		t.Fatalf("unexpected position %d, %d", pos.line, pos.offset)
+	}
+}
+
+func TestProcessTestJSON_Error(t *testing.T) {
+	t.Parallel()
+	in := "" +
+		`{"Action":"run","Package":"example.com/a","Test":"TestCrash"}` + "\n" +
+		`{"Action":"output","Package":"example.com/a","Test":"TestCrash","Output":"panic: oh no\n"}` + "\n" +
+		`{"Action":"fail","Package":"example.com/a"}` + "\n"
+	out := bytes.Buffer{}
+	errFoo := errors.New("foo")
+	proc := func(in io.Reader) error {
+		return errFoo
+	}
+	if err := processTestJSON(strings.NewReader(in), &out, proc); err != errFoo {
+		t.Fatal(err)
+	}
+	// The tests are printed even if the output failed to be processed.
+	want := "\nPackage example.com/a: panic in TestCrash\nTests running: TestCrash\n"
+	compareString(t, want, out.String())
+}
+
+func TestDetectTestJSON(t *testing.T) {
+	t.Parallel()
+	const event = `{"Action":"run","Package":"example.com/a","Test":"TestA"}` + "\n"
+	data := []struct {
+		name string
+		in   string
+		head string
+		want bool
+	}{
+		{"Event", event + "junk\n", event, true},
+		{"Empty", "", "", false},
+		{"EmptyLines", "\n\n" + event, "\n\n" + event, true},
+		{"BuildOutput", "# example.com/b\nb/b.go:3:2: undefined: x\n" + event, "# example.com/b\nb/b.go:3:2: undefined: x\n" + event, true},
+		{"Trace", "panic: oh no\n" + event, "panic: oh no\n", false},
+		{"JSONLog", `{"level":"error"}` + "\n", `{"level":"error"}` + "\n", false},
+		{"BuildOutputOnly", "# example.com/b\nb/b.go:3:2: undefined: x", "# example.com/b\nb/b.go:3:2: undefined: x", false},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
+			t.Parallel()
+			head, got, err := detectTestJSON(bufio.NewReader(strings.NewReader(line.in)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != line.want {
+				t.Errorf("%t != %t", got, line.want)
+			}
+			compareString(t, line.head, string(head))
+		})
+	}
+}
+
 func TestMainFn(t *testing.T) {
 	t.Parallel()
 	// It doesn't do anything since stdin is closed.
@@ -7,6 +7,7 @@ package internal
 import (
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/maruel/panicparse/v2/stack"
 )
@@ -23,6 +24,9 @@ type Palette struct {
 	CreatedBy    string
 	Race         string
 
+	// Recursion cycle header.
+	Recursion string
+
 	// Call line.
 	Package                     string
 	SrcFile                     string
@@ -38,6 +42,10 @@ type Palette struct {
 	FuncStdLib                  string
 	FuncStdLibExported          string
 	Arguments                   string
+
+	// Links, when set, is used to print the source references as terminal
+	// hyperlinks (OSC 8).
+	Links *stack.LinkResolver
 }
 
 // pathFormat determines how much to show.
@@ -91,13 +99,13 @@ func calcBucketsLengths(a *stack.Aggregated, pf pathFormat) (int, int) {
 	return srcLen, pkgLen
 }
 
-// calcGoroutinesLengths returns the maximum length of the source lines and
+// calcStacksLengths returns the maximum length of the source lines and
 // package names.
-func calcGoroutinesLengths(s *stack.Snapshot, pf pathFormat) (int, int) {
+func calcStacksLengths(stacks []*stack.Stack, pf pathFormat) (int, int) {
 	srcLen := 0
 	pkgLen := 0
-	for _, e := range s.Goroutines {
-		for _, line := range e.Signature.Stack.Calls {
+	for _, e := range stacks {
+		for _, line := range e.Calls {
 			if l := len(pf.formatCall(&line)); l > srcLen {
 				srcLen = l
 			}
@@ -203,25 +211,157 @@ func (p *Palette) GoroutineHeader(g *stack.Goroutine, pf pathFormat, multipleGor
 		p.EOLReset)
 }
 
+// hyperlink returns src as a terminal hyperlink to the source file of the
+// call, padded to srcLen.
+func (p *Palette) hyperlink(line *stack.Call, src string, srcLen int) string {
+	if p.Links == nil {
+		return src
+	}
+	u := p.Links.SrcURL(line)
+	if u == "" {
+		return src
+	}
+	pad := ""
+	if l := srcLen - len(src); l > 0 {
+		pad = strings.Repeat(" ", l)
+	}
+	return "\033]8;;" + u + "\033\\" + src + "\033]8;;\033\\" + pad
+}
+
 // callLine prints one stack line.
 func (p *Palette) callLine(line *stack.Call, srcLen, pkgLen int, pf pathFormat) string {
 	return fmt.Sprintf(
 		"    %s%-*s %s%-*s %s%s%s(%s)%s",
 		p.Package, pkgLen, line.Func.DirName,
-		p.SrcFile, srcLen, pf.formatCall(line),
+		p.SrcFile, srcLen, p.hyperlink(line, pf.formatCall(line), srcLen),
 		p.functionColor(line), line.Func.Name,
 		p.Arguments, &line.Args,
 		p.EOLReset)
 }
 
 // StackLines prints one complete stack trace, without the header.
+//
+// A recursion cycle is printed once, preceded by the number of repetitions.
 func (p *Palette) StackLines(signature *stack.Signature, srcLen, pkgLen int, pf pathFormat) string {
-	out := make([]string, len(signature.Stack.Calls))
-	for i := range signature.Stack.Calls {
-		out[i] = p.callLine(&signature.Stack.Calls[i], srcLen, pkgLen, pf)
+	out := make([]string, 0, len(signature.Stack.Calls))
+	for _, c := range signature.Stack.Compact() {
+		if c.Count > 1 {
+			out = append(out, fmt.Sprintf("    %sRecursion: %s%s", p.Recursion, c.String(), p.EOLReset))
+		}
+		for i := range c.Calls {
+			out = append(out, p.callLine(&c.Calls[i], srcLen, pkgLen, pf))
+		}
 	}
 	if signature.Stack.Elided {
 		out = append(out, "    (...)")
 	}
 	return strings.Join(out, "\n") + "\n"
 }
+
+// RaceLines prints a data race report with the conflicting memory accesses
+// side by side, followed by the memory location and the stacks where the
+// goroutines were created.
+//
+// The calls present in both access stacks are marked with "=".
+func (p *Palette) RaceLines(r *stack.RaceReport, pf pathFormat) string {
+	accesses := r.Accesses()
+	stacks := make([]*stack.Stack, 0, 2*len(accesses)+1)
+	for _, g := range accesses {
+		stacks = append(stacks, &g.Stack, &g.CreatedBy)
+	}
+	if r.Location != nil && r.Location.Global == "" {
+		stacks = append(stacks, &r.Location.Stack)
+	}
+	srcLen, pkgLen := calcStacksLengths(stacks, pf)
+
+	// Each column is the colored text and its printed width.
+	type cell struct {
+		s string
+		w int
+	}
+	plain := &Palette{}
+	cols := make([][]cell, len(accesses))
+	widths := make([]int, len(accesses))
+	for i, g := range accesses {
+		h := raceAccessString(g, i != 0)
+		cols[i] = append(cols[i], cell{p.Race + h + p.EOLReset, utf8.RuneCountInString(h)})
+		for j := range g.Stack.Calls {
+			c := &g.Stack.Calls[j]
+			line := p.callLine(c, srcLen, pkgLen, pf)
+			if r.Shared(c) {
+				// callLine() starts with 4 spaces.
+				line = "  = " + line[4:]
+			}
+			l := plain.callLine(c, srcLen, pkgLen, pf)
+			cols[i] = append(cols[i], cell{line, utf8.RuneCountInString(l)})
+		}
+		if g.Stack.Elided {
+			cols[i] = append(cols[i], cell{"    (...)", 9})
+		}
+		for _, c := range cols[i] {
+			if c.w > widths[i] {
+				widths[i] = c.w
+			}
+		}
+	}
+
+	out := fmt.Sprintf("%sData race @ 0x%08x%s\n", p.Race, r.Current.RaceAddr, p.EOLReset)
+	rows := 0
+	for _, c := range cols {
+		if len(c) > rows {
+			rows = len(c)
+		}
+	}
+	for j := 0; j < rows; j++ {
+		line := ""
+		for i, c := range cols {
+			if i != 0 {
+				line += " | "
+			}
+			w := 0
+			if j < len(c) {
+				line += c[j].s
+				w = c[j].w
+			}
+			if i != len(cols)-1 {
+				line += strings.Repeat(" ", widths[i]-w)
+			}
+		}
+		out += strings.TrimRight(line, " ") + "\n"
+	}
+
+	if l := r.Location; l != nil {
+		if l.Global != "" {
+			decl := ""
+			if len(l.Stack.Calls) != 0 {
+				decl = " declared at " + pf.formatCall(&l.Stack.Calls[0])
+			}
+			out += fmt.Sprintf("Global var %s of size %d @ 0x%08x%s\n", l.Global, l.Size, l.Addr, decl)
+		} else {
+			out += fmt.Sprintf("Heap block of size %d @ 0x%08x allocated by goroutine %d:\n", l.Size, l.Addr, l.AllocatedBy)
+			out += p.StackLines(&stack.Signature{Stack: l.Stack}, srcLen, pkgLen, pf)
+		}
+	}
+	for _, g := range accesses {
+		if len(g.CreatedBy.Calls) != 0 {
+			out += fmt.Sprintf("%sGoroutine %d (%s) created at:%s\n", p.CreatedBy, g.ID, g.State, p.EOLReset)
+			out += p.StackLines(&stack.Signature{Stack: g.CreatedBy}, srcLen, pkgLen, pf)
+		}
+	}
+	return out
+}
+
+// raceAccessString returns the description of a memory access of a data race,
+// e.g. "Previous write by goroutine 7".
+func raceAccessString(g *stack.Goroutine, previous bool) string {
+	op := "read"
+	if g.RaceWrite {
+		op = "write"
+	}
+	if previous {
+		op = "Previous " + op
+	} else {
+		op = strings.ToUpper(op[:1]) + op[1:]
+	}
+	return fmt.Sprintf("%s by goroutine %d", op, g.ID)
+}
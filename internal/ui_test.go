@@ -32,6 +32,7 @@ var testPalette = &Palette{
 	FuncStdLib:                  "P",
 	FuncStdLibExported:          "Q",
 	Arguments:                   "R",
+	Recursion:                   "S",
 }
 
 func TestCalcBucketsLengths(t *testing.T) {
@@ -170,6 +171,114 @@ func TestStackLines(t *testing.T) {
 	compareString(t, want, testPalette.StackLines(s, 10, 10, basePath))
 }
 
+func TestStackLinesRecursion(t *testing.T) {
+	t.Parallel()
+	f := newCallLocal("main.f", stack.Args{}, "/home/user/go/src/main.go", 5)
+	g := newCallLocal("main.g", stack.Args{}, "/home/user/go/src/main.go", 7)
+	s := &stack.Signature{
+		Stack: stack.Stack{
+			Calls: []stack.Call{
+				f, g, f, g, f, g,
+				newCallLocal("main.main", stack.Args{}, "/home/user/go/src/main.go", 10),
+			},
+		},
+	}
+	want := "" +
+		"    SRecursion: main.f → main.g ×3A\n" +
+		"    Emain F/home/user/go/src/main.go:5 GfR()A\n" +
+		"    Emain F/home/user/go/src/main.go:7 GgR()A\n" +
+		"    Emain F/home/user/go/src/main.go:10 GmainR()A\n"
+	compareString(t, want, testPalette.StackLines(s, 0, 4, fullPath))
+}
+
+func TestStackLinesHyperlinks(t *testing.T) {
+	t.Parallel()
+	s := &stack.Signature{
+		Stack: stack.Stack{
+			Calls: []stack.Call{
+				newCallLocal("foo.OtherExported", stack.Args{}, "/home/user/go/src/foo/bar.go", 1575),
+				{Func: newFunc("foo.unknown")},
+			},
+		},
+	}
+	p := Palette{Links: stack.DefaultLinkResolver()}
+	want := "" +
+		"    foo        \033]8;;file:////home/user/go/src/foo/bar.go\033\\bar.go:1575\033]8;;\033\\ OtherExported()\n" +
+		"    foo        :0          unknown()\n"
+	compareString(t, want, p.StackLines(s, 11, 10, basePath))
+}
+
+func TestRaceLines(t *testing.T) {
+	t.Parallel()
+	caller := newCallLocal("main.main", stack.Args{}, "/home/user/go/src/main.go", 10)
+	current := &stack.Goroutine{
+		Signature: stack.Signature{
+			State:     "running",
+			CreatedBy: stack.Stack{Calls: []stack.Call{newCallLocal("main.main", stack.Args{}, "/home/user/go/src/main.go", 9)}},
+			Stack: stack.Stack{
+				Calls: []stack.Call{
+					newCallLocal("main.write", stack.Args{}, "/home/user/go/src/main.go", 20),
+					caller,
+				},
+			},
+		},
+		ID:        7,
+		RaceWrite: true,
+		RaceAddr:  0xc000014108,
+	}
+	previous := &stack.Goroutine{
+		Signature: stack.Signature{
+			Stack: stack.Stack{
+				Calls: []stack.Call{
+					newCallLocal("main.readLonger", stack.Args{}, "/home/user/go/src/main.go", 30),
+					newCallLocal("main.read", stack.Args{}, "/home/user/go/src/main.go", 40),
+					caller,
+				},
+			},
+		},
+		ID:       1,
+		RaceAddr: 0xc000014108,
+	}
+	r := &stack.RaceReport{
+		Current:  current,
+		Previous: previous,
+		Location: &stack.RaceLocation{
+			Size:        16,
+			Addr:        0xc000014100,
+			AllocatedBy: 1,
+			Stack:       stack.Stack{Calls: []stack.Call{newCallLocal("main.newFoo", stack.Args{}, "/home/user/go/src/main.go", 5)}},
+		},
+	}
+	want := "" +
+		"Data race @ 0xc000014108\n" +
+		"Write by goroutine 7        | Previous read by goroutine 1\n" +
+		"    main main.go:20 write() |     main main.go:30 readLonger()\n" +
+		"  = main main.go:10 main()  |     main main.go:40 read()\n" +
+		"                            |   = main main.go:10 main()\n" +
+		"Heap block of size 16 @ 0xc000014100 allocated by goroutine 1:\n" +
+		"    main main.go:5  newFoo()\n" +
+		"Goroutine 7 (running) created at:\n" +
+		"    main main.go:9  main()\n"
+	compareString(t, want, (&Palette{}).RaceLines(r, basePath))
+
+	r.Location = &stack.RaceLocation{
+		Global: "main.x",
+		Size:   8,
+		Addr:   0xc000014108,
+		Stack:  stack.Stack{Calls: []stack.Call{newCallLocal("main.x", stack.Args{}, "/home/user/go/src/main.go", 3)}},
+	}
+	r.Previous = nil
+	want = "" +
+		"Data race @ 0xc000014108\n" +
+		"Write by goroutine 7\n" +
+		"    main main.go:20 write()\n" +
+		"    main main.go:10 main()\n" +
+		"Global var main.x of size 8 @ 0xc000014108 declared at main.go:3\n" +
+		"Goroutine 7 (running) created at:\n" +
+		"    main main.go:9  main()\n"
+	compareString(t, want, (&Palette{}).RaceLines(r, basePath))
+}
+
 //
 
 func newFunc(s string) stack.Func {
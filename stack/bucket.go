@@ -43,6 +43,7 @@ func (s *Snapshot) Aggregate(similar Similarity) *Aggregated {
 	type count struct {
 		ids   []int
 		first bool
+		input InputRange
 	}
 	b := map[*Signature]*count{}
 	// O(n²). Fix eventually.
@@ -68,13 +69,13 @@ func (s *Snapshot) Aggregate(similar Similarity) *Aggregated {
 			// Create a copy of the Signature, since it will be mutated.
 			key := &Signature{}
 			*key = routine.Signature
-			b[key] = &count{ids: []int{routine.ID}, first: routine.First}
+			b[key] = &count{ids: []int{routine.ID}, first: routine.First, input: routine.Input}
 		}
 	}
 	bs := make([]*Bucket, 0, len(b))
 	for signature, c := range b {
 		sort.Ints(c.ids)
-		bs = append(bs, &Bucket{Signature: *signature, IDs: c.ids, First: c.first})
+		bs = append(bs, &Bucket{Signature: *signature, IDs: c.ids, First: c.first, Input: c.input})
 	}
 	// Do reverse sort.
 	sort.SliceStable(bs, func(i, j int) bool {
@@ -107,6 +108,9 @@ type Bucket struct {
 	// First is true if this Bucket contains the first goroutine, e.g. the one
 	// Signature that likely generated the panic() call, if any.
 	First bool
+	// Input is the position in the input of the first goroutine printed with
+	// this Signature.
+	Input InputRange
 
 	// Disallow initialization with unnamed parameters.
 	_ struct{}
@@ -43,31 +43,33 @@ func TestAggregateNotAggressive(t *testing.T) {
 				State: "chan receive",
 				Stack: Stack{
 					Calls: []Call{
-						newCall(
+						newCallOffset(
 							"main.func·001",
 							Args{Values: []Arg{{Value: 0x11000000, IsPtr: true}, {Value: 2}}},
 							"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-							72),
+							72, 0x49),
 					},
 				},
 			},
 			IDs:   []int{6},
 			First: true,
+			Input: InputRange{Offset: 42, End: 166, FirstLine: 3, LastLine: 5},
 		},
 		{
 			Signature: Signature{
 				State: "chan receive",
 				Stack: Stack{
 					Calls: []Call{
-						newCall(
+						newCallOffset(
 							"main.func·001",
 							Args{Values: []Arg{{Value: 0x21000000, Name: "#1", IsPtr: true}, {Value: 2}}},
 							"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-							72),
+							72, 0x49),
 					},
 				},
 			},
-			IDs: []int{7},
+			IDs:   []int{7},
+			Input: InputRange{Offset: 167, End: 291, FirstLine: 7, LastLine: 9},
 		},
 	}
 	a := s.Aggregate(ExactLines)
@@ -110,25 +112,26 @@ func TestAggregateExactMatching(t *testing.T) {
 				State: "chan receive",
 				CreatedBy: Stack{
 					Calls: []Call{
-						newCall(
+						newCallOffset(
 							"main.mainImpl",
 							Args{},
 							"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-							74),
+							74, 0xeb),
 					},
 				},
 				Stack: Stack{
 					Calls: []Call{
-						newCall(
+						newCallOffset(
 							"main.func·001",
 							Args{},
 							"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-							72),
+							72, 0x49),
 					},
 				},
 			},
 			IDs:   []int{6, 7},
 			First: true,
+			Input: InputRange{Offset: 42, End: 244, FirstLine: 3, LastLine: 7},
 		},
 	}
 	compareBuckets(t, want, s.Aggregate(ExactLines).Buckets)
@@ -169,16 +172,17 @@ func TestAggregateAggressive(t *testing.T) {
 				SleepMax: 100,
 				Stack: Stack{
 					Calls: []Call{
-						newCall(
+						newCallOffset(
 							"main.func·001",
 							Args{Values: []Arg{{Value: 0x21000000, Name: "*", IsPtr: true}, {Value: 2}}},
 							"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-							72),
+							72, 0x49),
 					},
 				},
 			},
 			IDs:   []int{6, 7, 8},
 			First: true,
+			Input: InputRange{Offset: 42, End: 178, FirstLine: 3, LastLine: 5},
 		},
 	}
 	compareBuckets(t, want, s.Aggregate(AnyPointer).Buckets)
@@ -229,6 +233,7 @@ func TestAggregateDeadlockPanic(t *testing.T) {
 						Func:          Func{Complete: "main", Name: "main"},
 						RemoteSrcPath: "foo/foo.go",
 						Line:          631,
+						PCOffset:      0x4b,
 						SrcName:       "foo.go",
 					},
 				}},
@@ -246,6 +251,7 @@ func TestAggregateDeadlockPanic(t *testing.T) {
 							},
 							RemoteSrcPath: "foo/foo.go",
 							Line:          467,
+							PCOffset:      0x2b8,
 							SrcName:       "foo.go",
 							ImportPath:    "foo",
 						},
@@ -254,6 +260,7 @@ func TestAggregateDeadlockPanic(t *testing.T) {
 							Args:          Args{Values: []Arg{{Value: 3}}},
 							RemoteSrcPath: "foo/foo.go",
 							Line:          643,
+							PCOffset:      0x69,
 							SrcName:       "foo.go",
 							ImportPath:    "foo",
 						},
@@ -262,6 +269,7 @@ func TestAggregateDeadlockPanic(t *testing.T) {
 			},
 			IDs:   []int{11},
 			First: true,
+			Input: InputRange{Offset: 34, End: 178, FirstLine: 3, LastLine: 9},
 		},
 		{
 			Signature: Signature{
@@ -271,6 +279,7 @@ func TestAggregateDeadlockPanic(t *testing.T) {
 						Func:          Func{Complete: "main", Name: "main"},
 						RemoteSrcPath: "foo/foo.go",
 						Line:          631,
+						PCOffset:      0x4b,
 						SrcName:       "foo.go",
 					},
 				}},
@@ -288,6 +297,7 @@ func TestAggregateDeadlockPanic(t *testing.T) {
 							},
 							RemoteSrcPath: "foo/foo.go",
 							Line:          467,
+							PCOffset:      0x2b8,
 							SrcName:       "foo.go",
 							ImportPath:    "foo",
 						},
@@ -296,13 +306,15 @@ func TestAggregateDeadlockPanic(t *testing.T) {
 							Args:          Args{Values: []Arg{{Value: 1}}},
 							RemoteSrcPath: "foo/foo.go",
 							Line:          643,
+							PCOffset:      0x69,
 							SrcName:       "foo.go",
 							ImportPath:    "foo",
 						},
 					},
 				},
 			},
-			IDs: []int{55},
+			IDs:   []int{55},
+			Input: InputRange{Offset: 288, End: 431, FirstLine: 17, LastLine: 23},
 		},
 		{
 			Signature: Signature{
@@ -313,6 +325,7 @@ func TestAggregateDeadlockPanic(t *testing.T) {
 							Func:          Func{Complete: "bozo", Name: "bozo"},
 							RemoteSrcPath: "foo/foo.go",
 							Line:          420,
+							PCOffset:      0x33,
 							SrcName:       "foo.go",
 						},
 					},
@@ -331,13 +344,15 @@ func TestAggregateDeadlockPanic(t *testing.T) {
 							},
 							RemoteSrcPath: "foo/foo.go",
 							Line:          467,
+							PCOffset:      0x2b8,
 							SrcName:       "foo.go",
 							ImportPath:    "foo",
 						},
 					},
 				},
 			},
-			IDs: []int{52},
+			IDs:   []int{52},
+			Input: InputRange{Offset: 179, End: 287, FirstLine: 11, LastLine: 15},
 		},
 	}
 	compareBuckets(t, want, s.Aggregate(AnyPointer).Buckets)
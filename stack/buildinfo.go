@@ -0,0 +1,177 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BuildInfo is the build information embedded in an executable by the Go
+// toolchain.
+//
+// It is a subset of runtime/debug.BuildInfo that doesn't depend on the Go
+// version used to compile panicparse.
+type BuildInfo struct {
+	// GoVersion is the version of the Go toolchain that built the executable,
+	// e.g. "go1.21.0".
+	GoVersion string
+	// Path is the package path of the main package.
+	Path string
+	// Main is the module containing the main package.
+	Main Module
+	// Deps are all the module dependencies of the executable.
+	Deps []Module
+	// VCSRevision is the revision of the main module as reported by the
+	// version control system, if available.
+	VCSRevision string
+	// VCSTime is the commit time of VCSRevision in RFC3339 format, if
+	// available.
+	VCSTime string
+	// VCSModified is true if the source tree had local modifications.
+	VCSModified bool
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// Module is a go module embedded in an executable.
+type Module struct {
+	// Path is the module path, e.g. "golang.org/x/sys".
+	Path string
+	// Version is the module version, e.g. "v0.1.0". It is "(devel)" for the
+	// main module when built from a source tree.
+	Version string
+	// Sum is the checksum of the module, if available.
+	Sum string
+	// Replace is the module replacing this one, if any.
+	Replace *Module
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// Private stuff.
+
+// buildInfoCache is the build information of the last executable read, so it
+// is read only once when the snapshots of a stream are scanned one after the
+// other.
+var buildInfoCache struct {
+	sync.Mutex
+	path    string
+	size    int64
+	modTime time.Time
+	bi      *BuildInfo
+}
+
+// cachedBuildInfo is readBuildInfo() reusing the last result if the
+// executable p didn't change.
+func cachedBuildInfo(p string) (*BuildInfo, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return readBuildInfo(p)
+	}
+	c := &buildInfoCache
+	c.Lock()
+	defer c.Unlock()
+	if c.bi != nil && c.path == p && c.size == fi.Size() && c.modTime.Equal(fi.ModTime()) {
+		return c.bi, nil
+	}
+	bi, err := readBuildInfo(p)
+	if err != nil {
+		return nil, err
+	}
+	c.path, c.size, c.modTime, c.bi = p, fi.Size(), fi.ModTime(), bi
+	return bi, nil
+}
+
+// mainModuleDevel is the version of the main module when built from a source
+// tree instead of via "go install pkg@version".
+const mainModuleDevel = "(devel)"
+
+// moduleVersion returns the version of the code at importPath as built in
+// the executable.
+//
+// For the standard library, it is the Go version. For the main module, it is
+// the VCS revision if the module version is not known. Returns an empty
+// string if not found.
+func (b *BuildInfo) moduleVersion(importPath string) string {
+	if importPath == "" {
+		return ""
+	}
+	if importPath == "main" {
+		importPath = b.Path
+	}
+	if isStdlibImportPath(importPath) {
+		return b.GoVersion
+	}
+	// Prefer the longest match since modules can be nested.
+	var m *Module
+	if hasPathPrefix(importPath, b.Main.Path) {
+		m = &b.Main
+	}
+	for i := range b.Deps {
+		if hasPathPrefix(importPath, b.Deps[i].Path) && (m == nil || len(b.Deps[i].Path) > len(m.Path)) {
+			m = &b.Deps[i]
+		}
+	}
+	if m == nil {
+		return ""
+	}
+	if m.Replace != nil {
+		// A replacement to a local directory has no version.
+		if m.Replace.Version == "" {
+			return ""
+		}
+		return m.Replace.Version
+	}
+	if m == &b.Main && (m.Version == mainModuleDevel || m.Version == "") {
+		return b.VCSRevision
+	}
+	return m.Version
+}
+
+// updateVersions sets ModuleVersion on each Call in the goroutines.
+func (b *BuildInfo) updateVersions(goroutines []*Goroutine) {
+	for _, g := range goroutines {
+		for _, s := range []*Stack{&g.Stack, &g.CreatedBy} {
+			for i := range s.Calls {
+				c := &s.Calls[i]
+				if c.ModuleVersion != "" {
+					continue
+				}
+				imp := c.ImportPath
+				if c.Location == Stdlib {
+					c.ModuleVersion = b.GoVersion
+					continue
+				}
+				// The version is already in the path when it was in the module cache.
+				if strings.IndexByte(imp, '@') != -1 {
+					continue
+				}
+				c.ModuleVersion = b.moduleVersion(imp)
+			}
+		}
+	}
+}
+
+// hasPathPrefix returns true if p is prefix or is inside the directory
+// prefix.
+func hasPathPrefix(p, prefix string) bool {
+	return prefix != "" && (p == prefix || strings.HasPrefix(p, prefix+"/"))
+}
+
+// isStdlibImportPath returns true if the import path looks like the standard
+// library, e.g. the first element doesn't contain a dot.
+//
+// This is the same heuristic than cmd/go.
+func isStdlibImportPath(p string) bool {
+	if i := strings.IndexByte(p, '/'); i != -1 {
+		p = p[:i]
+	}
+	return p != "main" && !strings.Contains(p, ".")
+}
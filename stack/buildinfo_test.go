@@ -0,0 +1,78 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBuildInfo_ModuleVersion(t *testing.T) {
+	t.Parallel()
+	b := BuildInfo{
+		GoVersion:   "go1.21.0",
+		Path:        "example.com/foo/cmd/foo",
+		Main:        Module{Path: "example.com/foo", Version: "(devel)"},
+		VCSRevision: "0123456789abcdef0123456789abcdef01234567",
+		Deps: []Module{
+			{Path: "github.com/bar/baz", Version: "v1.2.3"},
+			{Path: "github.com/bar/baz/v2", Version: "v2.0.1"},
+			{Path: "github.com/local/dep", Version: "v0.1.0", Replace: &Module{Path: "../dep"}},
+			{Path: "github.com/fork/dep", Version: "v0.1.0", Replace: &Module{Path: "github.com/me/dep", Version: "v0.1.1"}},
+		},
+	}
+	data := []struct {
+		importPath string
+		want       string
+	}{
+		{"", ""},
+		{"net/http", "go1.21.0"},
+		{"main", "0123456789abcdef0123456789abcdef01234567"},
+		{"example.com/foo/internal", "0123456789abcdef0123456789abcdef01234567"},
+		{"github.com/bar/baz", "v1.2.3"},
+		{"github.com/bar/baz/sub", "v1.2.3"},
+		{"github.com/bar/baz/v2/sub", "v2.0.1"},
+		{"github.com/bar/bazooka", ""},
+		{"github.com/local/dep", ""},
+		{"github.com/fork/dep", "v0.1.1"},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.importPath), func(t *testing.T) {
+			t.Parallel()
+			compareString(t, line.want, b.moduleVersion(line.importPath))
+		})
+	}
+}
+
+func TestBuildInfo_UpdateVersions(t *testing.T) {
+	t.Parallel()
+	b := BuildInfo{
+		GoVersion: "go1.21.0",
+		Path:      "example.com/foo",
+		Main:      Module{Path: "example.com/foo", Version: "v1.0.0"},
+		Deps:      []Module{{Path: "github.com/bar/baz", Version: "v1.2.3"}},
+	}
+	g := []*Goroutine{
+		{
+			Signature: Signature{
+				CreatedBy: Stack{Calls: []Call{newCall("main.main", Args{}, "/src/foo/main.go", 10)}},
+				Stack: Stack{
+					Calls: []Call{
+						{Func: newFunc("runtime.gopark"), ImportPath: "runtime", Location: Stdlib},
+						newCall("github.com/bar/baz.Baz", Args{}, "/src/baz/baz.go", 10),
+						{Func: newFunc("github.com/bar/baz.Baz"), ImportPath: "github.com/bar/baz@v1.2.3", Location: GoPkg},
+					},
+				},
+			},
+		},
+	}
+	b.updateVersions(g)
+	want := []string{"go1.21.0", "v1.2.3", ""}
+	for i, c := range g[0].Stack.Calls {
+		compareString(t, want[i], c.ModuleVersion)
+	}
+	compareString(t, "v1.0.0", g[0].CreatedBy.Calls[0].ModuleVersion)
+}
@@ -5,6 +5,8 @@
 //go:generate go get golang.org/x/tools/cmd/stringer
 //go:generate stringer -type state
 //go:generate stringer -type Location
+//go:generate stringer -type WaitCategory
+//go:generate stringer -type DiagnosticKind
 
 package stack
 
@@ -23,6 +25,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Opts represents options to process the snapshot.
@@ -33,6 +37,17 @@ type Opts struct {
 	// LocalGOPATHs is GOPATH with "/" as path separator. No trailing "/". Can be
 	// unset.
 	LocalGOPATHs []string
+	// LocalGOMODCACHE is GOMODCACHE with "/" as path separator. No trailing "/".
+	// Can be unset.
+	//
+	// It is used to find the go module dependencies when the executable was
+	// built with -trimpath.
+	LocalGOMODCACHE string
+	// LocalBazelOutputBase is the Bazel output base, as printed by "bazel info
+	// output_base", with "/" as path separator. No trailing "/". Can be unset.
+	//
+	// It is used to find the sources when the executable was built with Bazel.
+	LocalBazelOutputBase string
 
 	// NameArguments tells panicparse to find the recurring pointer values and
 	// give them pseudo 'names'.
@@ -56,30 +71,110 @@ type Opts struct {
 	// Requires GuessPaths to be true.
 	AnalyzeSources bool
 
+	// Binary is the path to the executable that generated the stack trace. Can
+	// be unset.
+	//
+	// When set, the build information embedded in the executable is read to
+	// initialize Snapshot.BuildInfo and Call.ModuleVersion. Requires
+	// panicparse to be built with go1.18 or later.
+	//
+	// For ELF executables, the symbol tables are also used to resolve the
+	// source location of calls with an unknown source file "??", like cgo
+	// calls, including inlined C functions when DWARF information is present.
+	Binary string
+
+	// LogPrefix matches the prefix added to each line by a logging system, like
+	// a timestamp. Can be unset.
+	//
+	// When set, the prefix is removed from each line before it is parsed, so
+	// stack traces embedded in logs can be found. Lines that are not part of a
+	// stack trace are still written unmodified to the prefix writer. Only a
+	// match at the start of the line is considered.
+	//
+	// LogPrefixAuto, LogPrefixCRI, LogPrefixRFC3339 and LogPrefixSyslog are
+	// ready to use.
+	LogPrefix *regexp.Regexp
+
+	// InputOffset and InputLine are the number of bytes and lines of the input
+	// preceding the io.Reader being scanned.
+	//
+	// They are added to the positions recorded in Goroutine.Input,
+	// Snapshot.Input and Snapshot.Diagnostics, so the positions are relative to
+	// the whole input when it is processed with multiple calls to
+	// ScanSnapshot.
+	InputOffset int64
+	InputLine   int
+
+	// KeepRaw tells panicparse to keep the original text of each goroutine in
+	// Goroutine.Raw.
+	KeepRaw bool
+
+	// RemoteGOOS is the GOOS of the process that generated the snapshot. Can be
+	// unset.
+	//
+	// When unset, "windows" is detected from the drive letters in the source
+	// paths. With "windows", the remote source paths are matched without
+	// regard to case. It is copied to Snapshot.RemoteGOOS.
+	RemoteGOOS string
+
 	// Disallow initialization with unnamed parameters.
 	_ struct{}
 }
 
+// Log prefixes ready to use with Opts.LogPrefix.
+var (
+	// LogPrefixCRI matches the CRI log format used by containerd and CRI-O for
+	// the container logs stored under /var/log/pods, e.g.
+	// "2024-01-02T03:04:05.123456789Z stderr F ".
+	LogPrefixCRI = regexp.MustCompile(`^` + rfc3339 + ` (?:stdout|stderr) [FP] `)
+	// LogPrefixRFC3339 matches a RFC 3339 timestamp, as printed by
+	// "docker logs -t" or "kubectl logs --timestamps", e.g.
+	// "2024-01-02T03:04:05.123456789Z ".
+	LogPrefixRFC3339 = regexp.MustCompile(`^` + rfc3339 + ` `)
+	// LogPrefixSyslog matches the syslog formats, RFC 3164 as printed by
+	// journalctl, e.g. "Jan 02 03:04:05 host app[123]: ", and RFC 5424, e.g.
+	// "<11>1 2024-01-02T03:04:05Z host app 123 - - ".
+	LogPrefixSyslog = regexp.MustCompile(`^(?:` + syslog3164 + `|` + syslog5424 + `)`)
+	// LogPrefixAuto matches any of LogPrefixCRI, LogPrefixRFC3339 and
+	// LogPrefixSyslog.
+	LogPrefixAuto = regexp.MustCompile(`^(?:` + rfc3339 + ` (?:stdout|stderr) [FP] |` + rfc3339 + ` |` + syslog3164 + `|` + syslog5424 + `)`)
+)
+
 // DefaultOpts returns default options to process the snapshot.
 func DefaultOpts() *Opts {
 	p := runtime.GOROOT()
 	if runtime.GOOS == "windows" {
 		p = strings.Replace(p, pathSeparator, "/", -1)
 	}
+	gopaths := getGOPATHs()
 	return &Opts{
-		LocalGOROOT:    p,
-		LocalGOPATHs:   getGOPATHs(),
-		NameArguments:  true,
-		GuessPaths:     true,
-		AnalyzeSources: true,
+		LocalGOROOT:     p,
+		LocalGOPATHs:    gopaths,
+		LocalGOMODCACHE: getGOMODCACHE(gopaths),
+		NameArguments:   true,
+		GuessPaths:      true,
+		AnalyzeSources:  true,
+	}
+}
+
+// stripLogPrefix returns the line without the log prefix, if any.
+func (o *Opts) stripLogPrefix(line []byte) []byte {
+	if o.LogPrefix != nil {
+		if m := o.LogPrefix.FindIndex(line); m != nil && m[0] == 0 {
+			return line[m[1]:]
+		}
 	}
+	return line
 }
 
 func (o *Opts) isValid() bool {
 	if !o.GuessPaths && o.AnalyzeSources {
 		return false
 	}
-	if strings.Contains(o.LocalGOROOT, "\\") {
+	if o.InputOffset < 0 || o.InputLine < 0 {
+		return false
+	}
+	if strings.Contains(o.LocalGOROOT, "\\") || strings.Contains(o.LocalGOMODCACHE, "\\") || strings.Contains(o.LocalBazelOutputBase, "\\") {
 		return false
 	}
 	for _, p := range o.LocalGOPATHs {
@@ -101,6 +196,13 @@ type Snapshot struct {
 	LocalGOROOT string
 	// LocalGOPATHs is copied from Opts.
 	LocalGOPATHs []string
+	// LocalGOMODCACHE is copied from Opts.
+	LocalGOMODCACHE string
+	// LocalBazelOutputBase is copied from Opts.
+	LocalBazelOutputBase string
+	// RemoteGOOS is copied from Opts. When unset, it is set to "windows" by
+	// findRoots() if a source path has a drive letter.
+	RemoteGOOS string
 
 	// The following members are initialized when Opts.GuessPaths is true.
 
@@ -124,15 +226,57 @@ type Snapshot struct {
 	//
 	// Uses "/" as path separator. No trailing "/".
 	//
-	// Because of the "replace" statement in go.mod, there can be multiple root
-	// directories. A file run by "go run" is also considered a go module to (a
-	// certain extent).
+	// Because of the "replace" statement in go.mod and the "use" statement in
+	// go.work, there can be multiple root directories. When a directory is
+	// referenced by a "replace" statement, the value is the replaced import
+	// path. A file run by "go run" is also considered a go module to (a certain
+	// extent).
 	//
 	// It is initialized by findRoots().
 	//
 	// Unlike GOROOT and GOPATH, it only works with stack traces created in the
 	// local file system, hence "Local" prefix.
 	LocalGomods map[string]string
+	// LocalBazelExecRoot is the Bazel execution root found under
+	// LocalBazelOutputBase, if any "bazel-out/" path was found in the traceback.
+	//
+	// It is initialized by findRoots().
+	LocalBazelExecRoot string
+
+	// BuildInfo is the build information read from Opts.Binary, if set.
+	BuildInfo *BuildInfo
+	// Race is set when a data race report was found. Its goroutines are also
+	// in Goroutines.
+	Race *RaceReport
+	// RemoteGoVersion is the Go version of the process that generated the
+	// traceback, in the format returned by runtime.Version(), e.g. "go1.15.2".
+	//
+	// It is determined from BuildInfo if set, otherwise from the GOROOT path,
+	// e.g. "/usr/local/go1.15.2", "/usr/lib/go-1.15" or
+	// "golang.org/toolchain@v0.0.1-go1.21.0.linux-amd64". It is empty when it
+	// could not be determined.
+	RemoteGoVersion string
+	// RemoteGoMinVersion is the oldest Go version that prints the traceback in
+	// this format, e.g. "go1.21" when the frames elided count is printed. It is
+	// inferred from the traceback itself and is empty when no version specific
+	// feature was found.
+	RemoteGoMinVersion string
+	// Gccgo is true when the traceback was printed by a program built with
+	// gccgo. It is detected from the first frame, as gccgo doesn't print the
+	// function arguments nor the program counter offsets. Call.Args is empty
+	// and the function names are demangled.
+	Gccgo bool
+	// Diagnostics are the issues found while processing the snapshot, in the
+	// order they were found.
+	Diagnostics []Diagnostic
+	// Input is the range of the input lines parsed as part of the snapshot,
+	// from the first goroutine header or race detector header to the last
+	// line of the trace.
+	Input InputRange
+
+	// wd is the go module containing the current working directory, once
+	// looked up by findTrimmedRoot().
+	wd *localModule
 
 	// Disallow initialization with unnamed parameters.
 	_ struct{}
@@ -162,25 +306,32 @@ func ScanSnapshot(in io.Reader, prefix io.Writer, opts *Opts) (*Snapshot, []byte
 		return nil, nil, errors.New("invalid Opts")
 	}
 	// TODO(maruel): Validate opts.
-	s := scanningState{
-		Snapshot: &Snapshot{
-			LocalGOROOT:  opts.LocalGOROOT,
-			LocalGOPATHs: opts.LocalGOPATHs,
-		},
-		state: looking,
+	var bi *BuildInfo
+	if opts.Binary != "" {
+		var err error
+		if bi, err = cachedBuildInfo(opts.Binary); err != nil {
+			return nil, nil, fmt.Errorf("failed to read build information: "+wrap, err)
+		}
 	}
+	s := newScanningState(opts, bi)
 	r := reader{rd: in}
 	var err error
 	var suffix []byte
 	for err == nil && s.state != done {
 		var d []byte
 		if d, err = r.readLine(); len(d) != 0 {
-			l, err1 := s.scan(d)
+			s.line++
+			l, err1 := s.scan(opts.stripLogPrefix(d))
 			if err1 != nil && (err == nil || err == io.EOF) {
 				err = err1
 			}
+			if l {
+				s.record(d)
+			}
+			s.offset += int64(len(d))
 			if !l {
 				if s.state != looking {
+					s.diagnoseLine(d, err1)
 					suffix = append([]byte{}, d...)
 					suffix = append(suffix, r.buffered()...)
 					break
@@ -192,15 +343,38 @@ func ScanSnapshot(in io.Reader, prefix io.Writer, opts *Opts) (*Snapshot, []byte
 			}
 		}
 	}
+	if err == io.EOF {
+		s.diagnoseEOF()
+	}
+	if s.state == done && suffix == nil {
+		// The trace had an explicit end, e.g. a race detector report. Return the
+		// data that was already read so the caller can continue scanning.
+		suffix = append([]byte{}, r.buffered()...)
+	}
 	if s.Goroutines != nil {
+		s.attachStackErrors(s.Goroutines)
+		s.Race = newRaceReport(s.Goroutines, s.raceLocation)
 		if opts.NameArguments {
 			nameArguments(s.Goroutines)
 		}
+		if opts.Binary != "" {
+			// Must be done before guessPaths() since it can update RemoteSrcPath.
+			s.symbolize(opts.Binary)
+		}
 		if opts.GuessPaths {
 			_ = s.guessPaths()
+			s.diagnoseUnresolved(s.Goroutines)
+		}
+		if s.BuildInfo != nil {
+			s.BuildInfo.updateVersions(s.Goroutines)
 		}
+		s.guessGoVersion(s.Goroutines)
 		if opts.AnalyzeSources {
-			_ = s.augment()
+			c := cacheAST{
+				files:  map[string][]byte{},
+				parsed: map[string]*parsedFile{},
+			}
+			augmentGoroutines(&c, s.Goroutines, s.diagnoseAugment)
 		}
 		return s.Snapshot, suffix, err
 	}
@@ -213,19 +387,72 @@ func ScanSnapshot(in io.Reader, prefix io.Writer, opts *Opts) (*Snapshot, []byte
 //
 // When a race condition was detected, it is preferable to not call Aggregate().
 func (s *Snapshot) IsRace() bool {
-	return s.Goroutines[0].RaceAddr != 0
+	return s.Race != nil
 }
 
 func (s *Snapshot) guessPaths() bool {
 	b := s.findRoots() == 0
-	for _, r := range s.Goroutines {
+	r := s.roots()
+	for _, g := range s.Goroutines {
 		// Note that this is important to call it even if
 		// s.RemoteGOROOT == s.LocalGOROOT.
-		b = r.updateLocations(s.RemoteGOROOT, s.LocalGOROOT, s.LocalGomods, s.RemoteGOPATHs) && b
+		b = g.updateLocations(r) && b
+	}
+	if s.Race != nil && s.Race.Location != nil {
+		b = s.Race.Location.Stack.updateLocations(r) && b
 	}
 	return b
 }
 
+// guessGoVersion initializes RemoteGoVersion and sets it as the
+// ModuleVersion of the standard library calls that do not have one.
+func (s *Snapshot) guessGoVersion(goroutines []*Goroutine) {
+	if s.BuildInfo != nil && s.BuildInfo.GoVersion != "" {
+		s.RemoteGoVersion = s.BuildInfo.GoVersion
+	} else if s.RemoteGOROOT != "" {
+		s.RemoteGoVersion = goVersionFromGOROOT(s.RemoteGOROOT)
+	} else {
+		// Opts.GuessPaths was false, look at the runtime source files directly.
+		for _, g := range goroutines {
+			for _, c := range g.Stack.Calls {
+				if i := strings.Index(c.RemoteSrcPath, "/src/runtime/"); i != -1 {
+					s.RemoteGoVersion = goVersionFromGOROOT(c.RemoteSrcPath[:i])
+					break
+				}
+			}
+			if s.RemoteGoVersion != "" {
+				break
+			}
+		}
+	}
+	if s.RemoteGoVersion == "" {
+		return
+	}
+	for _, g := range goroutines {
+		for _, st := range []*Stack{&g.Stack, &g.CreatedBy} {
+			for i := range st.Calls {
+				if c := &st.Calls[i]; c.Location == Stdlib && c.ModuleVersion == "" {
+					c.ModuleVersion = s.RemoteGoVersion
+				}
+			}
+		}
+	}
+}
+
+// roots returns the roots to use to resolve the source paths.
+func (s *Snapshot) roots() *roots {
+	return &roots{
+		remoteGOROOT:         s.RemoteGOROOT,
+		localGOROOT:          s.LocalGOROOT,
+		remoteGOPATHs:        s.RemoteGOPATHs,
+		localGomods:          s.LocalGomods,
+		localGOMODCACHE:      s.LocalGOMODCACHE,
+		localBazelOutputBase: s.LocalBazelOutputBase,
+		localBazelExecRoot:   s.LocalBazelExecRoot,
+		fold:                 s.RemoteGOOS == "windows",
+	}
+}
+
 // augment processes source files to improve calls to be more descriptive.
 //
 // It modifies goroutines in place. It requires calling guessPaths() to work
@@ -238,21 +465,64 @@ func (s *Snapshot) augment() error {
 		parsed: map[string]*parsedFile{},
 	}
 	var err error
-	for _, g := range s.Goroutines {
-		if err1 := c.augmentGoroutine(g); err1 != nil {
-			err = err1
+	augmentGoroutines(&c, s.Goroutines, func(_ *Goroutine, err1 error) {
+		err = err1
+	})
+	return err
+}
+
+// augmentGoroutines processes source files with c to improve the calls of the
+// goroutines.
+//
+// failed is called for each goroutine that failed to be processed.
+func augmentGoroutines(c *cacheAST, goroutines []*Goroutine, failed func(g *Goroutine, err error)) {
+	for _, g := range goroutines {
+		if err := c.augmentGoroutine(g); err != nil {
+			failed(g, err)
 		}
 	}
-	return err
 }
 
 // Private stuff.
 
+// roots is the set of directories used to map the source paths found in a
+// snapshot to the local file system.
+//
+// All paths are expected to be in "/" format even on Windows. They must not
+// have a trailing "/".
+type roots struct {
+	// remoteGOROOT and localGOROOT map stdlib sources.
+	remoteGOROOT string
+	localGOROOT  string
+	// remoteGOPATHs maps each remote GOPATH to the local one.
+	remoteGOPATHs map[string]string
+	// localGomods maps each local go module root directory to its import path.
+	localGomods map[string]string
+	// localGOMODCACHE is where -trimpath dependencies are found.
+	localGOMODCACHE string
+	// localBazelOutputBase is where Bazel "external/" sources are found.
+	localBazelOutputBase string
+	// localBazelExecRoot is where Bazel "bazel-out/" sources are found.
+	localBazelExecRoot string
+	// fold is set when the remote paths are case insensitive, like on Windows.
+	fold bool
+}
+
 const pathSeparator = string(filepath.Separator)
 
 var (
 	lockedToThread = []byte("locked to thread")
+	minutes        = []byte(" minutes")
 	framesElided   = []byte("...additional frames elided...")
+	// gotRoutineHeader
+	goroutine = []byte("goroutine ")
+	// gotUnavail
+	unavail = []byte("goroutine running on other thread; stack unavailable")
+	// gotCreated
+	createdBy = []byte("created by ")
+	// gotFileFunc
+	autogenerated = []byte("<autogenerated>")
+	unknownFile   = []byte("??")
 	// gotRaceHeader1, done
 	raceHeaderFooter = []byte("==================")
 	// gotRaceHeader2
@@ -263,63 +533,92 @@ var (
 	writeCap   = []byte("Write")
 	writeLow   = []byte("write")
 	threeDots  = []byte("...")
+	// gotFileFunc, gotUnavail
+	inGoroutine = []byte(" in goroutine ")
+	// gotFunc
+	nonGoFunction = []byte("non-Go function")
+	// gotFunc, with gccgo
+	dot        = []byte(".")
+	dotDot     = []byte("..")
+	gccgoPanic = []byte("panic")
+	// gotRaceOperationHeader, gotRaceHeapHeader, gotRaceGoroutineHeader
+	raceFailedStack = []byte("[failed to restore the stack]")
+	// gotSignalSeparator
+	signalSeparator = []byte("-----")
+	// gotSignalPC
+	cgoSignal = []byte("signal arrived during cgo execution")
+)
+
+// Log prefixes.
+const (
+	rfc3339    = `\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(?:\.\d+)?(?:Z|[+-]\d\d:\d\d)`
+	syslog3164 = `(?:<\d{1,3}>)?[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d [^\s:]+ [^\s:]+: `
+	syslog5424 = `<\d{1,3}>1 \S+ \S+ \S+ \S+ \S+ (?:-|\[.*?\]) `
 )
 
 // These are effectively constants.
 var (
 	// gotRoutineHeader
-	reRoutineHeader = regexp.MustCompile("^([ \t]*)goroutine (\\d+) \\[([^\\]]+)\\]\\:$")
-	reMinutes       = regexp.MustCompile(`^(\d+) minutes$`)
+	reSynctest = regexp.MustCompile(`^synctest (?:group|bubble) (\d+)$`)
 
-	// gotUnavail
-	reUnavail = regexp.MustCompile("^(?:\t| +)goroutine running on other thread; stack unavailable")
-
-	// gotFileFunc, gotRaceOperationFile, gotRaceGoroutineFile
-	// See gentraceback() in src/runtime/traceback.go for more information.
-	// - Sometimes the source file comes up as "<autogenerated>". It is the
-	//   compiler than generated these, not the runtime.
-	// - The tab may be replaced with spaces when a user copy-paste it, handle
-	//   this transparently.
-	// - "runtime.gopanic" is explicitly replaced with "panic" by gentraceback().
-	// - The +0x123 byte offset is printed when frame.pc > _func.entry. _func is
-	//   generated by the linker.
-	// - The +0x123 byte offset is not included with generated code, e.g. unnamed
-	//   functions "func·006()" which is generally go func() { ... }()
-	//   statements. Since the _func is generated at runtime, it's probably why
-	//   _func.entry is not set.
-	// - C calls may have fp=0x123 sp=0x123 appended. I think it normally happens
-	//   when a signal is not correctly handled. It is printed with m.throwing>0.
-	//   These are discarded.
-	// - For cgo, the source file may be "??".
-	reFile = regexp.MustCompile("^(?:\t| +)(\\?\\?|\\<autogenerated\\>|.+\\.(?:c|go|s))\\:(\\d+)(?:| \\+0x[0-9a-f]+)(?:| fp=0x[0-9a-f]+ sp=0x[0-9a-f]+(?:| pc=0x[0-9a-f]+))$")
+	// gotFileFunc
+	// See printOneCgoTraceback() in src/runtime/traceback.go for more
+	// information. The file is only printed when a cgo symbolizer is
+	// registered via runtime.SetCgoTraceback().
+	reCgoFile = regexp.MustCompile("^(?:\t| +)(?:(.+)\\:(\\d+) )?pc=0x([0-9a-f]+)$")
 
-	// gotCreated
-	// Sadly, it doesn't note the goroutine number so we could cascade them per
-	// parenthood.
-	reCreated = regexp.MustCompile("^created by (.+)$")
+	// gotFileFunc
+	// Go 1.21 and later print the innermost and outermost frames and elide the
+	// ones in between.
+	reFramesElided = regexp.MustCompile(`^\.\.\.\d+ frames elided\.\.\.$`)
 
-	// gotFunc, gotRaceOperationFunc, gotRaceGoroutineFunc
-	reFunc = regexp.MustCompile(`^(.+)\((.*)\)$`)
+	// gotStackError
+	// See (*unwinder).next() in src/runtime/traceback.go. Go 1.21 and later
+	// print the goroutine ID. Stack barriers were removed in Go 1.9.
+	reStackError = regexp.MustCompile(`^runtime: (?:g ?(\d+): )?(?:unexpected return pc for .+ called from 0x[0-9a-f]+|found next stack barrier at 0x[0-9a-f]+; expected .*)$`)
+	reStackFatal = regexp.MustCompile(`^fatal error: (?:missed stack barrier|unknown caller pc)$`)
+
+	// gotStackDump
+	// See tracebackHexdump() in src/runtime/traceback.go.
+	reStackDump = regexp.MustCompile(`^(?:stack: frame=\{sp:0x[0-9a-f]+, fp:0x[0-9a-f]+\} stack=\[0x[0-9a-f]+,0x[0-9a-f]+\)|0x[0-9a-f]+: .*)$`)
+
+	// gotSignal
+	// See sighandler() in src/runtime/signal_unix.go.
+	reSignal = regexp.MustCompile(`^SIG[A-Z0-9]+: .+$`)
+
+	// gotSignalPC
+	reSignalPC = regexp.MustCompile(`^PC=0x[0-9a-f]+ m=\d+ sigcode=`)
+
+	// gotRegister
+	// See dumpregs() in src/runtime/signal_<GOOS>_<GOARCH>.go. The name is
+	// padded with spaces.
+	reRegister = regexp.MustCompile(`^([a-z][a-z0-9]*) +0x([0-9a-f]+)$`)
 
 	// Race:
 	// See https://github.com/llvm/llvm-project/blob/master/compiler-rt/lib/tsan/rtl/tsan_report.cpp
 	// for the code generating these messages. Please note only the block in
 	//   #else  // #if !SANITIZER_GO
 	// is used.
-	// TODO(maruel): "    [failed to restore the stack]\n\n"
-	// TODO(maruel): "Global var %s of size %zu at %p declared at %s:%zu\n"
 
 	// gotRaceOperationHeader
-	reRaceOperationHeader = regexp.MustCompile(`^(Read|Write) at (0x[0-9a-f]+) by goroutine (\d+):$`)
+	//
+	// The main goroutine is printed as "by main goroutine:".
+	reRaceOperationHeader = regexp.MustCompile(`^(Read|Write) at (0x[0-9a-f]+) by (?:goroutine (\d+)|main goroutine):$`)
 
 	// gotRaceOperationHeader
-	reRacePreviousOperationHeader = regexp.MustCompile(`^Previous (read|write) at (0x[0-9a-f]+) by goroutine (\d+):$`)
+	reRacePreviousOperationHeader = regexp.MustCompile(`^Previous (read|write) at (0x[0-9a-f]+) by (?:goroutine (\d+)|main goroutine):$`)
+
+	// gotRaceHeapHeader
+	//
+	// The race detector used by Go prints "Heap block", the C++ one prints
+	// "Location is heap block".
+	reRaceHeap = regexp.MustCompile(`^(?:Heap block|Location is heap block) of size (\d+) at (0x[0-9a-f]+) allocated by (?:goroutine (\d+)|main goroutine):$`)
+
+	// gotRaceGlobal
+	reRaceGlobal = regexp.MustCompile(`^Global var (.+) of size (\d+) at (0x[0-9a-f]+) declared at (.+):(\d+)$`)
 
 	// gotRaceGoroutineHeader
 	reRaceGoroutine = regexp.MustCompile(`^Goroutine (\d+) \((running|finished)\) created at:$`)
-
-	// TODO(maruel): Use it.
-	//reRacePreviousOperationMainHeader = regexp.MustCompile("^Previous (read|write) at (0x[0-9a-f]+) by main goroutine:$")
 )
 
 // state is the state of the scan to detect and process a stack trace.
@@ -338,45 +637,90 @@ const (
 
 	// Signature: ""
 	// An empty line between goroutines.
-	// from: gotFileCreated, gotFileFunc
-	// to: gotRoutineHeader, done
+	// from: gotFileCreated, gotFileFunc, gotUnavail, gotRegister,
+	// gotSignalSeparator, gotSignalPC, gotStackError, gotStackDump
+	// to: gotRoutineHeader, gotRegister, gotSignalSeparator, gotSignal,
+	// gotStackError, done
 	betweenRoutine
-	// Regexp: reRoutineHeader
+	// Matcher: matchRoutineHeader
 	// Signature: "goroutine 1 [running]:"
 	// Goroutine header was found.
 	// from: looking
 	// to: gotUnavail, gotFunc
 	gotRoutineHeader
-	// Regexp: reFunc
+	// Matcher: matchFunc, matchGccgoFunc
 	// Signature: "main.main()"
+	// Signature: "main.main" (gccgo)
 	// Function call line was found.
 	// from: gotRoutineHeader
 	// to: gotFileFunc
 	gotFunc
-	// Regexp: reCreated
+	// Matcher: matchCreated
 	// Signature: "created by main.glob..func4"
 	// Goroutine creation line was found.
-	// from: gotFileFunc
+	// from: gotFileFunc, gotStackError, gotStackDump
 	// to: gotFileCreated
 	gotCreated
-	// Regexp: reFile
+	// Matcher: matchFile
 	// Signature: "\t/foo/bar/baz.go:116 +0x35"
 	// File header was found.
 	// from: gotFunc
-	// to: gotFunc, gotCreated, betweenRoutine, done
+	// to: gotFunc, gotCreated, betweenRoutine, gotSignal, gotStackError, done
 	gotFileFunc
-	// Regexp: reFile
+	// Matcher: matchFile
 	// Signature: "\t/foo/bar/baz.go:116 +0x35"
 	// File header was found.
 	// from: gotCreated
-	// to: betweenRoutine, done
+	// to: betweenRoutine, gotSignal, done
 	gotFileCreated
-	// Regexp: reUnavail
+	// Matcher: matchUnavail
 	// Signature: "goroutine running on other thread; stack unavailable"
-	// State when the goroutine stack is instead is reUnavail.
+	// State when the goroutine stack is unavailable.
 	// from: gotRoutineHeader
 	// to: betweenRoutine, gotCreated
 	gotUnavail
+	// Regexp: reStackError, reStackFatal
+	// Signature: "runtime: g 1: unexpected return pc for main.f called from 0xdeadbeef"
+	// The runtime failed to unwind the stack, which is likely corrupted.
+	// from: gotFileFunc, betweenRoutine, gotStackError, gotStackDump
+	// to: gotStackError, gotStackDump, gotCreated, betweenRoutine, done
+	gotStackError
+	// Regexp: reStackDump
+	// Signature: "stack: frame={sp:0xc000045f48, fp:0xc000045f58} stack=[0xc000044000,0xc000046000)"
+	// Hexdump of the stack printed after the error.
+	// from: gotStackError, gotStackDump
+	// to: gotStackError, gotStackDump, gotCreated, betweenRoutine, done
+	gotStackDump
+
+	// GOTRACEBACK=crash:
+
+	// Regexp: reSignal
+	// Signature: "SIGQUIT: quit"
+	// Signal received by a thread, printed before its goroutines.
+	// from: betweenRoutine, gotFileFunc, gotFileCreated
+	// to: gotSignalPC, done
+	gotSignal
+	// Regexp: reSignalPC
+	// Signature: "PC=0x46ad21 m=2 sigcode=0"
+	// Constant: cgoSignal
+	// Signature: "signal arrived during cgo execution"
+	// Program counter of the thread that received the signal.
+	// from: gotSignal, gotSignalPC
+	// to: gotSignalPC, betweenRoutine, done
+	gotSignalPC
+	// Regexp: reRegister
+	// Signature: "rax    0x0"
+	// Register dump of the thread that received the signal, printed after its
+	// goroutines.
+	// from: betweenRoutine, gotRegister
+	// to: gotRegister, betweenRoutine, done
+	gotRegister
+	// Constant: signalSeparator
+	// Signature: "-----"
+	// Separator printed before the next thread dumps its goroutines.
+	// from: betweenRoutine
+	// to: betweenRoutine, done
+	gotSignalSeparator
 
 	// Race detector:
 
@@ -394,43 +738,75 @@ const (
 	// Signature: "Read at 0x00c0000e4030 by goroutine 7:"
 	// A race operation was found.
 	// from: gotRaceHeader2
-	// to: done, gotRaceOperationFunc
+	// to: done, gotRaceOperationFunc, gotRaceOperationFile
 	gotRaceOperationHeader
-	// Regexp: reFunc
+	// Matcher: matchFunc
 	// Signature: "  main.panicRace.func1()"
 	// Function that caused the race.
 	// from: gotRaceOperationHeader
 	// to: done, gotRaceOperationFile
 	gotRaceOperationFunc
-	// Regexp: reFile
+	// Matcher: matchFile
 	// Signature: "\t/foo/bar/baz.go:116 +0x35"
+	// Constant: raceFailedStack
+	// Signature: "  [failed to restore the stack]"
 	// File header that caused the race.
-	// from: gotRaceOperationFunc
+	// from: gotRaceOperationHeader, gotRaceOperationFunc
 	// to: done, betweenRaceOperations, gotRaceOperationFunc
 	gotRaceOperationFile
 	// Signature: ""
 	// Empty line between race operations or just after.
 	// from: gotRaceOperationFile
-	// to: done, gotRaceOperationHeader, gotRaceGoroutineHeader
+	// to: done, gotRaceOperationHeader, gotRaceHeapHeader, gotRaceGlobal,
+	// gotRaceGoroutineHeader
 	betweenRaceOperations
 
+	// Regexp: reRaceHeap
+	// Signature: "Heap block of size 8 at 0x00c0000b4010 allocated by goroutine 6:"
+	// Memory location of the race.
+	// from: betweenRaceOperations
+	// to: done, gotRaceHeapFunc, gotRaceHeapFile
+	gotRaceHeapHeader
+	// Matcher: matchFunc
+	// Signature: "  main.newFoo()"
+	// Function that allocated the heap block.
+	// from: gotRaceHeapHeader, gotRaceHeapFile
+	// to: done, gotRaceHeapFile
+	gotRaceHeapFunc
+	// Matcher: matchFile
+	// Signature: "\t/foo/bar/baz.go:116 +0x35"
+	// Constant: raceFailedStack
+	// Signature: "  [failed to restore the stack]"
+	// File that allocated the heap block.
+	// from: gotRaceHeapHeader, gotRaceHeapFunc
+	// to: done, gotRaceHeapFunc, betweenRaceGoroutines
+	gotRaceHeapFile
+	// Regexp: reRaceGlobal
+	// Signature: "Global var main.x of size 8 at 0x0000005f1e40 declared at /foo/bar/baz.go:12"
+	// Memory location of the race.
+	// from: betweenRaceOperations
+	// to: done, betweenRaceGoroutines
+	gotRaceGlobal
+
 	// Regexp: reRaceGoroutine
 	// Signature: "Goroutine 7 (running) created at:"
 	// Goroutine header.
 	// from: betweenRaceOperations, betweenRaceGoroutines
-	// to: done, gotRaceOperationHeader
+	// to: done, gotRaceGoroutineFunc, gotRaceGoroutineFile
 	gotRaceGoroutineHeader
-	// Regexp: reFunc
+	// Matcher: matchFunc
 	// Signature: "  main.panicRace.func1()"
 	// Function that caused the race.
 	// from: gotRaceGoroutineHeader
 	// to: done, gotRaceGoroutineFile
 	gotRaceGoroutineFunc
-	// Regexp: reFile
+	// Matcher: matchFile
 	// Signature: "\t/foo/bar/baz.go:116 +0x35"
+	// Constant: raceFailedStack
+	// Signature: "  [failed to restore the stack]"
 	// File header that caused the race.
-	// from: gotRaceGoroutineFunc
-	// to: done, betweenRaceGoroutines
+	// from: gotRaceGoroutineHeader, gotRaceGoroutineFunc
+	// to: done, betweenRaceGoroutines, gotRaceGoroutineFunc
 	gotRaceGoroutineFile
 	// Signature: ""
 	// Empty line between race stack traces.
@@ -446,16 +822,71 @@ type scanningState struct {
 	state          state
 	prefix         []byte
 	goroutineIndex int
+	// raceLocation is the memory location of the data race, if reported.
+	raceLocation *RaceLocation
+	// signal is the last signal found. signalPending is set until the next
+	// goroutine, which received it, is found and stored in signaled.
+	signal        string
+	signalPending bool
+	signaled      *Goroutine
+	// stackErrors are the corrupted stack diagnostics found before the
+	// goroutine they are about.
+	stackErrors []pendingStackError
+	// yielded is the number of goroutines of this snapshot that were removed
+	// from Goroutines by a Scanner.
+	yielded int
+	// names deduplicates the function names, file paths and goroutine states.
+	names interner
+	// line is the number of the line being scanned, starting at 1.
+	line int
+	// offset is the byte offset of the line being scanned.
+	offset int64
+	// keepRaw is Opts.KeepRaw.
+	keepRaw bool
+	// lines is the line number of the header of each goroutine, for the
+	// diagnostics.
+	lines map[*Goroutine]int
+	// unresolved are the source paths already reported as unresolved.
+	unresolved map[string]bool
+	// goMinor is the minor version of RemoteGoMinVersion.
+	goMinor int
+	// elided is set once frames elided by the runtime were reported.
+	elided bool
+}
+
+// pendingStackError is a corrupted stack diagnostic found before the goroutine
+// it is about.
+type pendingStackError struct {
+	// id is the goroutine ID if printed, otherwise -1.
+	id  int
+	msg string
+}
+
+func newScanningState(opts *Opts, bi *BuildInfo) scanningState {
+	return scanningState{
+		Snapshot: &Snapshot{
+			LocalGOROOT:          opts.LocalGOROOT,
+			LocalGOPATHs:         opts.LocalGOPATHs,
+			LocalGOMODCACHE:      opts.LocalGOMODCACHE,
+			LocalBazelOutputBase: opts.LocalBazelOutputBase,
+			RemoteGOOS:           opts.RemoteGOOS,
+			BuildInfo:            bi,
+		},
+		state:      looking,
+		line:       opts.InputLine,
+		offset:     opts.InputOffset,
+		keepRaw:    opts.KeepRaw,
+		lines:      map[*Goroutine]int{},
+		unresolved: map[string]bool{},
+	}
 }
 
 // scan scans one line, updates goroutines and move to the next state.
 //
 // Returns true if the line was processed and thus should not be printed out.
 //
-// TODO(maruel): Handle corrupted stack cases:
-// - missed stack barrier
-// - found next stack barrier at 0x123; expected
-// - runtime: unexpected return pc for FUNC_NAME called from 0x123
+// The runtime diagnostics about a corrupted stack are stored in
+// Goroutine.StackErrors and the scan continues.
 func (s *scanningState) scan(line []byte) (bool, error) {
 	/* This is very useful to debug issues in the state machine.
 	defer func() {
@@ -503,57 +934,108 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 
 	case betweenRoutine:
 		// Look for a goroutine header.
-		if match := reRoutineHeader.FindSubmatch(trimmed); match != nil {
-			if id, ok := atou(match[2]); ok {
-				// See runtime/traceback.go.
-				// "<state>, \d+ minutes, locked to thread"
-				items := bytes.Split(match[3], commaSpace)
+		if indent, rawID, info, rawState, ok := matchRoutineHeader(trimmed); ok {
+			if id, ok := atou(rawID); ok {
+				// See goroutineheader() in runtime/traceback.go.
+				// "<state>, \d+ minutes, locked to thread, synctest bubble \d+"
+				state, items := cutCommaSpace(rawState)
 				sleep := 0
 				locked := false
-				for i := 1; i < len(items); i++ {
-					if bytes.Equal(items[i], lockedToThread) {
+				bubble := 0
+				for len(items) != 0 {
+					var item []byte
+					item, items = cutCommaSpace(items)
+					if bytes.Equal(item, lockedToThread) {
 						locked = true
 						continue
 					}
 					// Look for duration, if any.
-					if match2 := reMinutes.FindSubmatch(items[i]); match2 != nil {
-						sleep, _ = atou(match2[1])
+					if n := bytes.TrimSuffix(item, minutes); len(n) != len(item) && isDigits(n) {
+						sleep, _ = atou(n)
+						continue
+					}
+					if match2 := reSynctest.FindSubmatch(item); match2 != nil {
+						bubble, _ = atou(match2[1])
+						s.requireGo(goSynctest)
 					}
 				}
 				g := &Goroutine{
 					Signature: Signature{
-						State:    string(items[0]),
+						State:    s.names.str(state),
 						SleepMin: sleep,
 						SleepMax: sleep,
 						Locked:   locked,
 					},
-					ID:    id,
-					First: len(s.Goroutines) == 0,
+					ID:       id,
+					First:    len(s.Goroutines)+s.yielded == 0,
+					Synctest: bubble,
+				}
+				if err := g.parseThreadInfo(info); err != nil {
+					return false, err
+				}
+				if len(info) != 0 {
+					s.requireGo(goThreadInfo)
 				}
 				// Increase performance by always allocating 4 goroutines minimally.
 				if s.Goroutines == nil {
 					s.Goroutines = make([]*Goroutine, 0, 4)
 				}
+				if s.signalPending || g.First {
+					g.Signal = s.signal
+					s.signaled = g
+					s.signalPending = false
+				}
 				s.Goroutines = append(s.Goroutines, g)
+				s.lines[g] = s.line
 				s.state = gotRoutineHeader
-				s.prefix = append([]byte{}, match[1]...)
+				s.prefix = append([]byte{}, indent...)
 				return true, nil
 			}
 		}
 		// Switch to race detection mode.
 		if bytes.Equal(trimmed, raceHeaderFooter) {
+			if s.state != looking {
+				// A data race report after goroutines starts a new snapshot.
+				s.state = done
+				return false, nil
+			}
 			// TODO(maruel): We should buffer it in case the next line is not a
 			// WARNING so we can output it back.
 			s.state = gotRaceHeader1
 			return true, nil
 		}
-		if s.state != looking {
-			s.state = done
+		if s.state == looking {
+			// The signal line of a fatal signal is printed before the first
+			// goroutine. Keep it as junk but remember it.
+			if reSignal.Match(trimmed) {
+				s.signal = string(trimmed)
+				s.signalPending = true
+			}
+			// Same for a throw while unwinding a stack, e.g. during garbage
+			// collection.
+			if id, ok := stackErrorID(trimmed); ok {
+				s.stackErrors = append(s.stackErrors, pendingStackError{id: id, msg: string(trimmed)})
+			}
+			return false, nil
+		}
+		if s.parseStackError(trimmed, cur) {
+			return true, nil
+		}
+		if s.parseSignal(trimmed) {
+			return true, nil
+		}
+		if match := reRegister.FindSubmatch(trimmed); match != nil {
+			return s.parseRegister(match)
+		}
+		if bytes.Equal(trimmed, signalSeparator) {
+			s.state = gotSignalSeparator
+			return true, nil
 		}
+		s.state = done
 		return false, nil
 
 	case gotRoutineHeader:
-		if reUnavail.Match(trimmed) {
+		if matchUnavail(trimmed) {
 			// Generate a fake stack entry.
 			cur.Stack.Calls = []Call{{RemoteSrcPath: "<unavailable>"}}
 			// Next line is expected to be an empty line.
@@ -561,7 +1043,7 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			return true, nil
 		}
 		c := Call{}
-		if found, err := parseFunc(&c, trimmed); found {
+		if found, err := parseFunc(&c, trimmed, &s.names); found {
 			// Increase performance by always allocating 4 calls minimally.
 			if cur.Stack.Calls == nil {
 				cur.Stack.Calls = make([]Call, 0, 4)
@@ -570,11 +1052,19 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			s.state = gotFunc
 			return err == nil, err
 		}
+		// gccgo prints the function name alone. Since a function is always
+		// expected after a goroutine header, this is where it is detected.
+		if found, err := parseGccgoFunc(&c, trimmed, &s.names); found {
+			s.Gccgo = true
+			cur.Stack.Calls = append(cur.Stack.Calls, c)
+			s.state = gotFunc
+			return err == nil, err
+		}
 		return false, fmt.Errorf("expected a function after a goroutine header, got: %q", bytes.TrimSpace(trimmed))
 
 	case gotFunc:
 		// cur.Stack.Calls is guaranteed to have at least one item.
-		if found, err := parseFile(&cur.Stack.Calls[len(cur.Stack.Calls)-1], trimmed); err != nil {
+		if found, err := parseFile(&cur.Stack.Calls[len(cur.Stack.Calls)-1], trimmed, &s.names); err != nil {
 			return false, err
 		} else if !found {
 			return false, fmt.Errorf("expected a file after a function, got: %q", bytes.TrimSpace(trimmed))
@@ -583,7 +1073,7 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 		return true, nil
 
 	case gotCreated:
-		if found, err := parseFile(&cur.CreatedBy.Calls[0], trimmed); err != nil {
+		if found, err := parseFile(&cur.CreatedBy.Calls[0], trimmed, &s.names); err != nil {
 			return false, err
 		} else if !found {
 			return false, fmt.Errorf("expected a file after a created line, got: %q", trimmed)
@@ -592,9 +1082,16 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 		return true, nil
 
 	case gotFileFunc:
-		if match := reCreated.FindSubmatch(trimmed); match != nil {
+		if name, ok := matchCreated(trimmed); ok {
+			if s.Gccgo {
+				name = demangleGccgo(name)
+			}
+			if bytes.Contains(name, inGoroutine) {
+				s.requireGo(goCreatedByGoroutine)
+			}
 			cur.CreatedBy.Calls = make([]Call, 1)
-			if err := cur.CreatedBy.Calls[0].Func.Init(string(match[1])); err != nil {
+			var err error
+			if cur.CreatedBy.Calls[0].Func, err = s.names.fn(name); err != nil {
 				cur.CreatedBy.Calls = nil
 				return false, err
 			}
@@ -603,13 +1100,21 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			s.state = gotCreated
 			return true, nil
 		}
-		if bytes.Equal(trimmed, framesElided) {
+		if bytes.Equal(trimmed, framesElided) || reFramesElided.Match(trimmed) {
+			if trimmed[3] != 'a' {
+				s.requireGo(goFramesElidedCount)
+			}
 			cur.Stack.Elided = true
+			if !s.elided {
+				// Only report the first one, Stack.Elided is set on the others.
+				s.elided = true
+				s.diagnose(Truncated, s.line, "", fmt.Sprintf("goroutine %d: frames elided by the runtime", cur.ID))
+			}
 			// TODO(maruel): New state.
 			return true, nil
 		}
 		c := Call{}
-		if found, err := parseFunc(&c, trimmed); found {
+		if found, err := parseFunc(&c, trimmed, &s.names); found {
 			// Increase performance by always allocating 4 calls minimally.
 			if cur.Stack.Calls == nil {
 				cur.Stack.Calls = make([]Call, 0, 4)
@@ -618,10 +1123,25 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			s.state = gotFunc
 			return err == nil, err
 		}
+		if s.Gccgo {
+			if found, err := parseGccgoFunc(&c, trimmed, &s.names); found {
+				cur.Stack.Calls = append(cur.Stack.Calls, c)
+				s.state = gotFunc
+				return err == nil, err
+			}
+		}
 		if len(trimmed) == 0 {
 			s.state = betweenRoutine
 			return true, nil
 		}
+		// With GOTRACEBACK=crash, the signal is printed right after the last
+		// goroutine.
+		if s.parseSignal(trimmed) {
+			return true, nil
+		}
+		if s.parseStackError(trimmed, cur) {
+			return true, nil
+		}
 		s.state = done
 		return false, nil
 
@@ -630,6 +1150,9 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			s.state = betweenRoutine
 			return true, nil
 		}
+		if s.parseSignal(trimmed) {
+			return true, nil
+		}
 		s.state = done
 		return false, nil
 
@@ -638,9 +1161,16 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			s.state = betweenRoutine
 			return true, nil
 		}
-		if match := reCreated.FindSubmatch(trimmed); match != nil {
+		if name, ok := matchCreated(trimmed); ok {
+			if s.Gccgo {
+				name = demangleGccgo(name)
+			}
+			if bytes.Contains(name, inGoroutine) {
+				s.requireGo(goCreatedByGoroutine)
+			}
 			cur.CreatedBy.Calls = make([]Call, 1)
-			if err := cur.CreatedBy.Calls[0].Func.Init(string(match[1])); err != nil {
+			var err error
+			if cur.CreatedBy.Calls[0].Func, err = s.names.fn(name); err != nil {
 				cur.CreatedBy.Calls = nil
 				return false, err
 			}
@@ -649,6 +1179,73 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 		}
 		return false, fmt.Errorf("expected empty line after unavailable stack, got: %q", bytes.TrimSpace(trimmed))
 
+	case gotStackError, gotStackDump:
+		if len(trimmed) == 0 {
+			s.state = betweenRoutine
+			return true, nil
+		}
+		if reStackDump.Match(trimmed) {
+			s.state = gotStackDump
+			return true, nil
+		}
+		if s.parseStackError(trimmed, cur) {
+			return true, nil
+		}
+		// The runtime still prints the creator after a failed unwind.
+		if name, ok := matchCreated(trimmed); ok {
+			cur.CreatedBy.Calls = make([]Call, 1)
+			var err error
+			if cur.CreatedBy.Calls[0].Func, err = s.names.fn(name); err != nil {
+				cur.CreatedBy.Calls = nil
+				return false, err
+			}
+			cur.CreatedBy.Calls[0].init("", 0)
+			s.state = gotCreated
+			return true, nil
+		}
+		s.state = done
+		return false, nil
+
+		// GOTRACEBACK=crash.
+
+	case gotSignal:
+		if reSignalPC.Match(trimmed) {
+			s.state = gotSignalPC
+			return true, nil
+		}
+		s.state = done
+		return false, nil
+
+	case gotSignalPC:
+		if len(trimmed) == 0 {
+			s.state = betweenRoutine
+			return true, nil
+		}
+		if bytes.Equal(trimmed, cgoSignal) {
+			return true, nil
+		}
+		s.state = done
+		return false, nil
+
+	case gotRegister:
+		if len(trimmed) == 0 {
+			s.state = betweenRoutine
+			return true, nil
+		}
+		if match := reRegister.FindSubmatch(trimmed); match != nil {
+			return s.parseRegister(match)
+		}
+		s.state = done
+		return false, nil
+
+	case gotSignalSeparator:
+		if len(trimmed) == 0 {
+			s.state = betweenRoutine
+			return true, nil
+		}
+		s.state = done
+		return false, nil
+
 		// Race detector.
 
 	case gotRaceHeader1:
@@ -671,7 +1268,7 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			if err != nil {
 				return false, fmt.Errorf("failed to parse address on line: %q", bytes.TrimSpace(trimmed))
 			}
-			id, ok := atou(match[3])
+			id, ok := raceGoroutineID(match[3])
 			if !ok {
 				return false, fmt.Errorf("failed to parse goroutine id on line: %q", bytes.TrimSpace(trimmed))
 			}
@@ -686,8 +1283,14 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 		return false, fmt.Errorf("expected race condition, got: %q", bytes.TrimSpace(trimmed))
 
 	case gotRaceOperationHeader:
+		if bytes.Equal(trimLeftSpace(trimmed), raceFailedStack) {
+			// Generate a fake stack entry.
+			cur.Stack.Calls = []Call{{RemoteSrcPath: "<unavailable>"}}
+			s.state = gotRaceOperationFile
+			return true, nil
+		}
 		c := Call{}
-		if found, err := parseFunc(&c, trimLeftSpace(trimmed)); found {
+		if found, err := parseFunc(&c, trimLeftSpace(trimmed), &s.names); found {
 			// Increase performance by always allocating 4 calls minimally.
 			if cur.Stack.Calls == nil {
 				cur.Stack.Calls = make([]Call, 0, 4)
@@ -699,7 +1302,7 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 		return false, fmt.Errorf("expected a function after a race operation, got: %q", trimmed)
 
 	case gotRaceOperationFunc:
-		if found, err := parseFile(&cur.Stack.Calls[len(cur.Stack.Calls)-1], trimmed); err != nil {
+		if found, err := parseFile(&cur.Stack.Calls[len(cur.Stack.Calls)-1], trimmed, &s.names); err != nil {
 			return false, err
 		} else if !found {
 			return false, fmt.Errorf("expected a file after a race function, got: %q", trimmed)
@@ -712,8 +1315,12 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			s.state = betweenRaceOperations
 			return true, nil
 		}
+		if bytes.Equal(trimmed, raceHeaderFooter) {
+			s.state = done
+			return true, nil
+		}
 		c := Call{}
-		if found, err := parseFunc(&c, trimLeftSpace(trimmed)); found {
+		if found, err := parseFunc(&c, trimLeftSpace(trimmed), &s.names); found {
 			cur.Stack.Calls = append(cur.Stack.Calls, c)
 			s.state = gotRaceOperationFunc
 			return err == nil, err
@@ -728,7 +1335,7 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			if err != nil {
 				return false, fmt.Errorf("failed to parse address on line: %q", bytes.TrimSpace(trimmed))
 			}
-			id, ok := atou(match[3])
+			id, ok := raceGoroutineID(match[3])
 			if !ok {
 				return false, fmt.Errorf("failed to parse goroutine id on line: %q", bytes.TrimSpace(trimmed))
 			}
@@ -737,6 +1344,46 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 			s.state = gotRaceOperationHeader
 			return true, nil
 		}
+		// Look for the memory location.
+		if match := reRaceHeap.FindSubmatch(trimmed); match != nil {
+			size, err := strconv.ParseUint(string(match[1]), 10, 64)
+			if err != nil {
+				return false, fmt.Errorf("failed to parse size on line: %q", bytes.TrimSpace(trimmed))
+			}
+			addr, err := strconv.ParseUint(string(match[2]), 0, 64)
+			if err != nil {
+				return false, fmt.Errorf("failed to parse address on line: %q", bytes.TrimSpace(trimmed))
+			}
+			id, ok := raceGoroutineID(match[3])
+			if !ok {
+				return false, fmt.Errorf("failed to parse goroutine id on line: %q", bytes.TrimSpace(trimmed))
+			}
+			s.raceLocation = &RaceLocation{Size: size, Addr: addr, AllocatedBy: id}
+			s.state = gotRaceHeapHeader
+			return true, nil
+		}
+		if match := reRaceGlobal.FindSubmatch(trimmed); match != nil {
+			size, err := strconv.ParseUint(string(match[2]), 10, 64)
+			if err != nil {
+				return false, fmt.Errorf("failed to parse size on line: %q", bytes.TrimSpace(trimmed))
+			}
+			addr, err := strconv.ParseUint(string(match[3]), 0, 64)
+			if err != nil {
+				return false, fmt.Errorf("failed to parse address on line: %q", bytes.TrimSpace(trimmed))
+			}
+			line, ok := atou(match[5])
+			if !ok {
+				return false, fmt.Errorf("failed to parse int on line: %q", bytes.TrimSpace(trimmed))
+			}
+			c := Call{}
+			if err := c.Func.Init(string(match[1])); err != nil {
+				return false, err
+			}
+			c.init(s.names.path(match[4]), line)
+			s.raceLocation = &RaceLocation{Global: string(match[1]), Size: size, Addr: addr, Stack: Stack{Calls: []Call{c}}}
+			s.state = gotRaceGlobal
+			return true, nil
+		}
 		fallthrough
 
 	case betweenRaceGoroutines:
@@ -762,11 +1409,66 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 		}
 		return false, fmt.Errorf("expected an operator or goroutine, got: %q", trimmed)
 
+		// Race memory location
+
+	case gotRaceHeapHeader:
+		if bytes.Equal(trimLeftSpace(trimmed), raceFailedStack) {
+			// Generate a fake stack entry.
+			s.raceLocation.Stack.Calls = []Call{{RemoteSrcPath: "<unavailable>"}}
+			s.state = gotRaceHeapFile
+			return true, nil
+		}
+		c := Call{}
+		if found, err := parseFunc(&c, trimLeftSpace(trimmed), &s.names); found {
+			s.raceLocation.Stack.Calls = append(make([]Call, 0, 4), c)
+			s.state = gotRaceHeapFunc
+			return err == nil, err
+		}
+		return false, fmt.Errorf("expected a function after a heap block, got: %q", trimmed)
+
+	case gotRaceHeapFunc:
+		c := s.raceLocation.Stack.Calls
+		if found, err := parseFile(&c[len(c)-1], trimmed, &s.names); err != nil {
+			return false, err
+		} else if !found {
+			return false, fmt.Errorf("expected a file after a heap block function, got: %q", trimmed)
+		}
+		s.state = gotRaceHeapFile
+		return true, nil
+
+	case gotRaceHeapFile:
+		if len(trimmed) == 0 {
+			s.state = betweenRaceGoroutines
+			return true, nil
+		}
+		if bytes.Equal(trimmed, raceHeaderFooter) {
+			s.state = done
+			return true, nil
+		}
+		c := Call{}
+		if found, err := parseFunc(&c, trimLeftSpace(trimmed), &s.names); found {
+			s.raceLocation.Stack.Calls = append(s.raceLocation.Stack.Calls, c)
+			s.state = gotRaceHeapFunc
+			return err == nil, err
+		}
+		return false, fmt.Errorf("expected an empty line after a heap block file, got: %q", trimmed)
+
+	case gotRaceGlobal:
+		if len(trimmed) == 0 {
+			s.state = betweenRaceGoroutines
+			return true, nil
+		}
+		if bytes.Equal(trimmed, raceHeaderFooter) {
+			s.state = done
+			return true, nil
+		}
+		return false, fmt.Errorf("expected an empty line after a global variable, got: %q", trimmed)
+
 		// Race stack traces
 
 	case gotRaceGoroutineFunc:
 		c := s.Goroutines[s.goroutineIndex].CreatedBy.Calls
-		if found, err := parseFile(&c[len(c)-1], trimmed); err != nil {
+		if found, err := parseFile(&c[len(c)-1], trimmed, &s.names); err != nil {
 			return false, err
 		} else if !found {
 			return false, fmt.Errorf("expected a file after a race function, got: %q", trimmed)
@@ -787,8 +1489,13 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 		fallthrough
 
 	case gotRaceGoroutineHeader:
+		if bytes.Equal(trimLeftSpace(trimmed), raceFailedStack) {
+			// Leave CreatedBy empty, like when the creator is unknown.
+			s.state = gotRaceGoroutineFile
+			return true, nil
+		}
 		c := Call{}
-		if found, err := parseFunc(&c, trimLeftSpace(trimmed)); found {
+		if found, err := parseFunc(&c, trimLeftSpace(trimmed), &s.names); found {
 			s.Goroutines[s.goroutineIndex].CreatedBy.Calls = append(s.Goroutines[s.goroutineIndex].CreatedBy.Calls, c)
 			s.state = gotRaceGoroutineFunc
 			return err == nil, err
@@ -800,26 +1507,242 @@ func (s *scanningState) scan(line []byte) (bool, error) {
 	}
 }
 
-// parseFunc only return an error if also returning a Call.
-//
-// Uses reFunc.
-func parseFunc(c *Call, line []byte) (bool, error) {
-	if match := reFunc.FindSubmatch(line); match != nil {
-		if err := c.Func.Init(string(match[1])); err != nil {
-			return true, err
-		}
-		// It is also done in c.init() but do it here in case of a corrupted trace
-		// for the file section.
-		c.ImportPath = c.Func.ImportPath
-		for _, a := range bytes.Split(match[2], commaSpace) {
-			if bytes.Equal(a, threeDots) {
-				c.Args.Elided = true
-				continue
-			}
-			if len(a) == 0 {
-				// Remaining values were dropped.
+// parseStackError processes a corrupted stack diagnostic printed while the
+// stack of g was unwound.
+func (s *scanningState) parseStackError(line []byte, g *Goroutine) bool {
+	if _, ok := stackErrorID(line); !ok {
+		return false
+	}
+	g.StackErrors = append(g.StackErrors, string(line))
+	s.state = gotStackError
+	return true
+}
+
+// attachStackErrors attaches the corrupted stack diagnostics found before the
+// goroutines to the goroutine they are about, or to the first goroutine when
+// the goroutine ID wasn't printed or not found.
+func (s *scanningState) attachStackErrors(goroutines []*Goroutine) {
+	for _, e := range s.stackErrors {
+		g := goroutines[0]
+		for _, g2 := range goroutines {
+			if g2.ID == e.id {
+				g = g2
 				break
 			}
+		}
+		g.StackErrors = append(g.StackErrors, e.msg)
+	}
+	s.stackErrors = nil
+}
+
+// stackErrorID returns true if line is a corrupted stack diagnostic, along
+// with the goroutine ID if printed, otherwise -1.
+func stackErrorID(line []byte) (int, bool) {
+	if match := reStackError.FindSubmatch(line); match != nil {
+		if id, ok := atou(match[1]); ok {
+			return id, true
+		}
+		return -1, true
+	}
+	return -1, reStackFatal.Match(line)
+}
+
+// parseSignal processes a signal line printed with GOTRACEBACK=crash, which
+// precedes the goroutines of the thread that received it.
+func (s *scanningState) parseSignal(line []byte) bool {
+	if !reSignal.Match(line) {
+		return false
+	}
+	s.signal = string(line)
+	s.signalPending = true
+	s.state = gotSignal
+	return true
+}
+
+// parseRegister adds a register from a register dump to the goroutine that
+// received the last signal, or the first goroutine if no signal was found.
+func (s *scanningState) parseRegister(match [][]byte) (bool, error) {
+	v, err := strconv.ParseUint(string(match[2]), 16, 64)
+	if err != nil {
+		s.state = done
+		return false, fmt.Errorf("failed to parse register %s: %q", match[1], match[2])
+	}
+	if g := s.signaled; g != nil {
+		g.Registers = append(g.Registers, Register{Name: string(match[1]), Value: v})
+	}
+	s.state = gotRegister
+	return true, nil
+}
+
+// record extends the input ranges of the snapshot and of the goroutine being
+// parsed with the line d that was just scanned and processed.
+func (s *scanningState) record(d []byte) {
+	r := InputRange{Offset: s.offset, End: s.offset + int64(len(d)), FirstLine: s.line, LastLine: s.line}
+	s.Input.extend(r)
+	switch s.state {
+	case gotRoutineHeader, gotFunc, gotCreated, gotFileFunc, gotFileCreated, gotUnavail,
+		gotStackError, gotStackDump,
+		gotRaceOperationHeader, gotRaceOperationFunc, gotRaceOperationFile:
+		g := s.Goroutines[len(s.Goroutines)-1]
+		g.Input.extend(r)
+		if s.keepRaw {
+			g.Raw = append(g.Raw, d...)
+		}
+	}
+}
+
+// The minor version of the Go releases that introduced a change in the
+// traceback format.
+const (
+	// goFramesElidedCount prints "...N frames elided..." instead of
+	// "...additional frames elided...".
+	goFramesElidedCount = 21
+	// goCreatedByGoroutine prints "created by X in goroutine N".
+	goCreatedByGoroutine = 21
+	// goThreadInfo prints "gp=0x... m=N mp=0x..." with GOTRACEBACK=system.
+	goThreadInfo = 23
+	// goSynctest prints "synctest bubble N" in the goroutine header.
+	goSynctest = 25
+)
+
+// requireGo records that the traceback was printed by go1.<minor> or later.
+func (s *scanningState) requireGo(minor int) {
+	if minor > s.goMinor {
+		s.goMinor = minor
+		s.RemoteGoMinVersion = "go1." + strconv.Itoa(minor)
+	}
+}
+
+// diagnose records an issue found while processing the snapshot.
+func (s *scanningState) diagnose(k DiagnosticKind, line int, text, msg string) {
+	s.Diagnostics = append(s.Diagnostics, Diagnostic{Kind: k, Line: line, Text: text, Msg: msg})
+}
+
+// diagnoseLine records the line that ended the snapshot, with the error
+// returned while scanning it, if any.
+func (s *scanningState) diagnoseLine(line []byte, err error) {
+	msg := "end of snapshot"
+	if err != nil {
+		msg = err.Error()
+	}
+	s.diagnose(UnparsedLine, s.line, string(bytes.TrimRight(line, "\r\n")), msg)
+}
+
+// diagnoseEOF records a trace cut in the middle by the end of the input.
+func (s *scanningState) diagnoseEOF() {
+	switch s.state {
+	case gotRoutineHeader, gotFunc, gotCreated:
+		g := s.Goroutines[len(s.Goroutines)-1]
+		s.diagnose(Truncated, s.line, "", fmt.Sprintf("input ended in the middle of goroutine %d", g.ID))
+	case gotRaceHeader1, gotRaceHeader2, gotRaceOperationHeader, gotRaceOperationFunc,
+		gotRaceOperationFile, betweenRaceOperations, gotRaceHeapHeader, gotRaceHeapFunc,
+		gotRaceHeapFile, gotRaceGlobal, gotRaceGoroutineHeader, gotRaceGoroutineFunc,
+		gotRaceGoroutineFile, betweenRaceGoroutines:
+		s.diagnose(Truncated, s.line, "", "input ended in the middle of the data race report")
+	}
+}
+
+// diagnoseUnresolved records the source paths of goroutines that could not be
+// mapped to local files. Each path is reported once.
+func (s *scanningState) diagnoseUnresolved(goroutines []*Goroutine) {
+	for _, g := range goroutines {
+		for _, st := range []*Stack{&g.Stack, &g.CreatedBy} {
+			for i := range st.Calls {
+				c := &st.Calls[i]
+				if c.LocalSrcPath != "" || s.unresolved[c.RemoteSrcPath] {
+					continue
+				}
+				switch c.RemoteSrcPath {
+				case "", "??", "<autogenerated>", "<unavailable>":
+					continue
+				}
+				s.unresolved[c.RemoteSrcPath] = true
+				s.diagnose(UnresolvedPath, s.lines[g], c.RemoteSrcPath, fmt.Sprintf("first seen in goroutine %d", g.ID))
+			}
+		}
+	}
+}
+
+// diagnoseAugment records a goroutine whose sources failed to be processed.
+func (s *scanningState) diagnoseAugment(g *Goroutine, err error) {
+	s.diagnose(AugmentFailed, s.lines[g], "", fmt.Sprintf("goroutine %d: %v", g.ID, err))
+}
+
+// symbolize resolves the calls with the executable p, recording a diagnostic
+// if it can't be used.
+func (s *scanningState) symbolize(p string) {
+	if err := symbolize(p, s.Goroutines); err != nil {
+		s.diagnose(SymbolizeFailed, 0, p, err.Error())
+	}
+}
+
+// parseThreadInfo parses the " gp=0x... m=N mp=0x..." part of a goroutine
+// header.
+func (g *Goroutine) parseThreadInfo(b []byte) error {
+	for _, f := range bytes.Fields(b) {
+		i := bytes.IndexByte(f, '=')
+		k, v := string(f[:i]), string(f[i+1:])
+		var err error
+		switch k {
+		case "gp":
+			g.GP, err = strconv.ParseUint(v, 0, 64)
+		case "mp":
+			g.MP, err = strconv.ParseUint(v, 0, 64)
+		case "m":
+			if v != "nil" {
+				var ok bool
+				if g.M, ok = atou([]byte(v)); !ok {
+					err = errors.New("invalid m")
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse %s on goroutine %d header: %q", k, g.ID, v)
+		}
+	}
+	return nil
+}
+
+// raceGoroutineID parses the goroutine ID printed by the race detector.
+//
+// The main goroutine is printed without its ID, which is always 1.
+func raceGoroutineID(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 1, true
+	}
+	return atou(b)
+}
+
+// parseFunc only return an error if also returning a Call.
+//
+// Uses matchFunc.
+func parseFunc(c *Call, line []byte, in *interner) (bool, error) {
+	if bytes.Equal(line, nonGoFunction) {
+		// C function printed by the runtime when no cgo symbolizer is registered.
+		// It can be resolved via Opts.Binary.
+		c.Func = Func{Complete: string(nonGoFunction), Name: string(nonGoFunction)}
+		return true, nil
+	}
+	name, args, ok := matchFunc(line)
+	if !ok {
+		return false, nil
+	}
+	var err error
+	if c.Func, err = in.fn(name); err != nil {
+		return true, err
+	}
+	// It is also done in c.init() but do it here in case of a corrupted trace
+	// for the file section.
+	c.ImportPath = c.Func.ImportPath
+	for rest := args; ; {
+		var a []byte
+		a, rest = cutCommaSpace(rest)
+		if bytes.Equal(a, threeDots) {
+			c.Args.Elided = true
+		} else if len(a) == 0 {
+			// Remaining values were dropped.
+			break
+		} else {
 			v, err := strconv.ParseUint(string(a), 0, 64)
 			if err != nil {
 				return true, fmt.Errorf("failed to parse int on line: %q", bytes.TrimSpace(line))
@@ -832,31 +1755,501 @@ func parseFunc(c *Call, line []byte) (bool, error) {
 			// the code processing it.
 			c.Args.Values = append(c.Args.Values, Arg{Value: v, IsPtr: v > pointerFloor && v < pointerCeiling})
 		}
-		return true, nil
+		if rest == nil {
+			break
+		}
 	}
-	return false, nil
+	return true, nil
+}
+
+// parseGccgoFunc is parseFunc for a program built with gccgo.
+//
+// Uses matchGccgoFunc. To not mistake junk for a function, the demangled name
+// must be qualified, a C function or "panic", to which runtime.gopanic is
+// renamed.
+func parseGccgoFunc(c *Call, line []byte, in *interner) (bool, error) {
+	name, ok := matchGccgoFunc(line)
+	if !ok {
+		return false, nil
+	}
+	if name = demangleGccgo(name); !isGccgoFunc(name) {
+		return false, nil
+	}
+	var err error
+	if c.Func, err = in.fn(name); err != nil {
+		return true, err
+	}
+	c.ImportPath = c.Func.ImportPath
+	return true, nil
+}
+
+// demangleGccgo reverts the encoding of the symbol names done by gccgo, so
+// they look like the ones printed by the gc toolchain.
+//
+// See go-encode-id.cc in the gofrontend. The characters that are not valid in
+// a symbol are encoded as "..z" followed by 2 hex digits, or "..u" and "..U"
+// followed by 4 and 8 hex digits for non-ASCII runes, e.g. "net..z2fhttp.Get"
+// is "net/http.Get". Other uses of ".." separate generated functions, e.g.
+// "main.main..func1" is "main.main.func1".
+func demangleGccgo(name []byte) []byte {
+	if bytes.Index(name, dotDot) == -1 {
+		return name
+	}
+	out := make([]byte, 0, len(name))
+	for i := 0; i < len(name); {
+		if !bytes.HasPrefix(name[i:], dotDot) || i+2 == len(name) {
+			out = append(out, name[i])
+			i++
+			continue
+		}
+		n := 0
+		switch name[i+2] {
+		case 'z':
+			n = 2
+		case 'u':
+			n = 4
+		case 'U':
+			n = 8
+		}
+		if n != 0 && i+3+n <= len(name) {
+			if v, ok := atox(name[i+3 : i+3+n]); ok {
+				if n == 2 {
+					out = append(out, byte(v))
+				} else {
+					var b [utf8.UTFMax]byte
+					out = append(out, b[:utf8.EncodeRune(b[:], rune(v))]...)
+				}
+				i += 3 + n
+				continue
+			}
+		}
+		out = append(out, '.')
+		i += 2
+	}
+	return out
+}
+
+// isGccgoFunc returns true if the demangled name looks like a function
+// printed by gccgo: "panic", a C function like "__go_go" or a qualified Go
+// function like "example.com/foo.Type.Method".
+func isGccgoFunc(name []byte) bool {
+	if bytes.Equal(name, gccgoPanic) {
+		return true
+	}
+	i := bytes.LastIndexByte(name, '/')
+	for _, c := range name[:i+1] {
+		if !isPathChar(c) {
+			return false
+		}
+	}
+	parts := bytes.Split(name[i+1:], dot)
+	if len(parts) == 1 {
+		// A C function.
+		return i == -1 && bytes.IndexByte(name, '_') != -1 && isIdent(name)
+	}
+	for _, p := range parts {
+		if !isIdent(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// isIdent returns true if b is a Go identifier.
+func isIdent(b []byte) bool {
+	if len(b) == 0 || (b[0] >= '0' && b[0] <= '9') {
+		return false
+	}
+	for _, c := range b {
+		if c != '_' && c < utf8.RuneSelf && !unicode.IsLetter(rune(c)) && !unicode.IsDigit(rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPathChar returns true if c is valid in an import path.
+func isPathChar(c byte) bool {
+	switch c {
+	case '/', '.', '-', '_', '~':
+		return true
+	}
+	return c >= utf8.RuneSelf || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
 }
 
 // parseFile only return an error if also processing a Call.
 //
-// Uses reFile.
-func parseFile(c *Call, line []byte) (bool, error) {
-	if match := reFile.FindSubmatch(line); match != nil {
-		num, ok := atou(match[2])
+// Uses matchFile and reCgoFile.
+func parseFile(c *Call, line []byte, in *interner) (bool, error) {
+	if src, line2, offset, pc, ok := matchFile(line); ok {
+		num, ok := atou(line2)
 		if !ok {
 			return true, fmt.Errorf("failed to parse int on line: %q", bytes.TrimSpace(line))
 		}
-		c.init(string(match[1]), num)
+		c.init(in.path(src), num)
+		if len(offset) != 0 {
+			if c.PCOffset, ok = atox(offset); !ok {
+				return true, fmt.Errorf("failed to parse pc offset on line: %q", bytes.TrimSpace(line))
+			}
+		}
+		if len(pc) != 0 {
+			if c.PC, ok = atox(pc); !ok {
+				return true, fmt.Errorf("failed to parse pc on line: %q", bytes.TrimSpace(line))
+			}
+		}
+		return true, nil
+	}
+	if match := reCgoFile.FindSubmatch(line); match != nil {
+		src := "??"
+		num := 0
+		if len(match[1]) != 0 {
+			var ok bool
+			if num, ok = atou(match[2]); !ok {
+				return true, fmt.Errorf("failed to parse int on line: %q", bytes.TrimSpace(line))
+			}
+			src = in.path(match[1])
+		}
+		c.init(src, num)
+		var err error
+		if c.PC, err = strconv.ParseUint(string(match[3]), 16, 64); err != nil {
+			return true, fmt.Errorf("failed to parse pc on line: %q", bytes.TrimSpace(line))
+		}
 		return true, nil
 	}
 	return false, nil
 }
 
+// interner deduplicates the strings found in a snapshot.
+//
+// A dump with a large number of goroutines repeats the same functions and
+// files over and over. Returning the same string saves both the allocations
+// and the memory, and parsing a function name is done only once.
+type interner struct {
+	strs  map[string]string
+	funcs map[string]Func
+}
+
+// str returns b as a string.
+func (in *interner) str(b []byte) string {
+	// The compiler doesn't allocate for the lookup.
+	if v, ok := in.strs[string(b)]; ok {
+		return v
+	}
+	if in.strs == nil {
+		in.strs = map[string]string{}
+	}
+	v := string(b)
+	in.strs[v] = v
+	return v
+}
+
+// path returns b as a source path, with "/" as path separator.
+//
+// A Windows path may use "\" as path separator. It is converted so it is
+// classified like the other paths.
+func (in *interner) path(b []byte) string {
+	if v, ok := in.strs[string(b)]; ok {
+		return v
+	}
+	if bytes.IndexByte(b, '\\') == -1 || !isWindowsPath(string(b)) {
+		return in.str(b)
+	}
+	if in.strs == nil {
+		in.strs = map[string]string{}
+	}
+	v := strings.Replace(string(b), "\\", "/", -1)
+	in.strs[string(b)] = v
+	return v
+}
+
+// fn returns the Func initialized from the raw function name b.
+func (in *interner) fn(b []byte) (Func, error) {
+	if f, ok := in.funcs[string(b)]; ok {
+		return f, nil
+	}
+	f := Func{}
+	raw := string(b)
+	if err := f.Init(raw); err != nil {
+		return f, err
+	}
+	if in.funcs == nil {
+		in.funcs = map[string]Func{}
+	}
+	in.funcs[raw] = f
+	return f, nil
+}
+
+// The matchers below are hand written equivalents of regular expressions, as
+// they are run on every line of a goroutine dump. Each documents the regexp it
+// implements.
+
+// matchRoutineHeader matches:
+//
+//	^([ \t]*)goroutine (\d+)((?: [a-z]+=[^ \[]+)*) \[([^\]]+)\]:$
+//
+// Go 1.23+ prints "gp=0x... m=N mp=0x..." or "gp=0x... m=nil" after the
+// goroutine ID with GOTRACEBACK=system or higher; it is returned as info.
+func matchRoutineHeader(line []byte) (indent, id, info, state []byte, ok bool) {
+	i := 0
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	indent = line[:i]
+	if !bytes.HasPrefix(line[i:], goroutine) {
+		return
+	}
+	i += len(goroutine)
+	start := i
+	i = skipDigits(line, i)
+	if i == start {
+		return
+	}
+	id = line[start:i]
+	start = i
+	for i+1 < len(line) && line[i] == ' ' && isLower(line[i+1]) {
+		i++
+		for i < len(line) && isLower(line[i]) {
+			i++
+		}
+		if i == len(line) || line[i] != '=' {
+			return
+		}
+		i++
+		v := i
+		for i < len(line) && line[i] != ' ' && line[i] != '[' {
+			i++
+		}
+		if i == v {
+			return
+		}
+	}
+	info = line[start:i]
+	if !bytes.HasPrefix(line[i:], []byte(" [")) || !bytes.HasSuffix(line, []byte("]:")) {
+		return
+	}
+	state = line[i+2 : len(line)-2]
+	if len(state) == 0 || bytes.IndexByte(state, ']') != -1 {
+		return
+	}
+	ok = true
+	return
+}
+
+// matchUnavail matches:
+//
+//	^(?:\t| +)goroutine running on other thread; stack unavailable
+func matchUnavail(line []byte) bool {
+	rest, ok := cutIndent(line)
+	return ok && bytes.HasPrefix(rest, unavail)
+}
+
+// matchCreated matches:
+//
+//	^created by (.+)$
+//
+// Sadly, it doesn't note the goroutine number so we could cascade them per
+// parenthood.
+func matchCreated(line []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(line, createdBy) {
+		return nil, false
+	}
+	name := line[len(createdBy):]
+	return name, len(name) != 0 && bytes.IndexByte(name, '\n') == -1
+}
+
+// matchFunc matches:
+//
+//	^(.+)\((.*)\)$
+//
+// The name is everything up to the last opening parenthesis.
+func matchFunc(line []byte) (name, args []byte, ok bool) {
+	l := len(line)
+	if l < 3 || line[l-1] != ')' || bytes.IndexByte(line, '\n') != -1 {
+		return
+	}
+	i := bytes.LastIndexByte(line[:l-1], '(')
+	if i < 1 {
+		return
+	}
+	return line[:i], line[i+1 : l-1], true
+}
+
+// matchGccgoFunc matches:
+//
+//	^([^\s()]+)$
+//
+// gccgo prints the function name without the arguments. See printtrace() in
+// libgo/go/runtime/traceback_gccgo.go.
+func matchGccgoFunc(line []byte) ([]byte, bool) {
+	if len(line) == 0 {
+		return nil, false
+	}
+	for _, c := range line {
+		switch c {
+		case ' ', '\t', '\n', '\f', '\r', '(', ')':
+			return nil, false
+		}
+	}
+	return line, true
+}
+
+// matchFile matches:
+//
+//	^(?:\t| +)(\?\?|<autogenerated>|.+\.(?:c|go|s)):(\d+)(?:| \+0x([0-9a-f]+))(?:| fp=0x[0-9a-f]+ sp=0x[0-9a-f]+(?:| pc=0x([0-9a-f]+)))$
+//
+// See gentraceback() in src/runtime/traceback.go for more information.
+//   - Sometimes the source file comes up as "<autogenerated>". It is the
+//     compiler than generated these, not the runtime.
+//   - The tab may be replaced with spaces when a user copy-paste it, handle
+//     this transparently.
+//   - "runtime.gopanic" is explicitly replaced with "panic" by gentraceback().
+//   - The +0x123 byte offset is printed when frame.pc > _func.entry. _func is
+//     generated by the linker.
+//   - The +0x123 byte offset is not included with generated code, e.g. unnamed
+//     functions "func·006()" which is generally go func() { ... }()
+//     statements. Since the _func is generated at runtime, it's probably why
+//     _func.entry is not set.
+//   - C calls may have fp=0x123 sp=0x123 appended. I think it normally happens
+//     when a signal is not correctly handled. It is printed with m.throwing>0.
+//     The fp and sp values are discarded, pc is kept in Call.PC.
+//   - For cgo, the source file may be "??".
+func matchFile(line []byte) (src, num, offset, pc []byte, ok bool) {
+	rest, ok1 := cutIndent(line)
+	if !ok1 {
+		return
+	}
+	// The suffix doesn't contain a colon, so the path ends at the last one.
+	i := bytes.LastIndexByte(rest, ':')
+	if i == -1 {
+		return
+	}
+	src = rest[:i]
+	if !isSrcPath(src) {
+		// The regexp backtracks into the indentation when the path is only an
+		// extension, e.g. "  .go:1".
+		n := len(line) - len(rest)
+		if n < 2 || !isSrcPath(line[n-1:n+i]) {
+			return
+		}
+		src = line[n-1 : n+i]
+	}
+	i++
+	start := i
+	if i = skipDigits(rest, i); i == start {
+		return
+	}
+	num = rest[start:i]
+	if bytes.HasPrefix(rest[i:], []byte(" +0x")) {
+		i += 4
+		start = i
+		if i = skipHex(rest, i); i == start {
+			return
+		}
+		offset = rest[start:i]
+	}
+	if i != len(rest) {
+		if i = skipHexField(rest, i, " fp=0x"); i == -1 {
+			return
+		}
+		if i = skipHexField(rest, i, " sp=0x"); i == -1 {
+			return
+		}
+		if i != len(rest) {
+			start = i + len(" pc=0x")
+			if i = skipHexField(rest, i, " pc=0x"); i != len(rest) {
+				return
+			}
+			pc = rest[start:]
+		}
+	}
+	ok = true
+	return
+}
+
+// cutIndent removes the indentation of a frame's file line, either a tab or
+// spaces.
+func cutIndent(line []byte) ([]byte, bool) {
+	if len(line) == 0 {
+		return nil, false
+	}
+	if line[0] == '\t' {
+		return line[1:], true
+	}
+	i := 0
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return line[i:], i != 0
+}
+
+// isSrcPath returns true if p is "??", "<autogenerated>" or a non-empty name
+// with a .c, .go or .s extension.
+func isSrcPath(p []byte) bool {
+	if bytes.Equal(p, unknownFile) || bytes.Equal(p, autogenerated) {
+		return true
+	}
+	if bytes.IndexByte(p, '\n') != -1 {
+		return false
+	}
+	l := len(p)
+	return (l > 3 && p[l-3] == '.' && p[l-2] == 'g' && p[l-1] == 'o') ||
+		(l > 2 && p[l-2] == '.' && (p[l-1] == 'c' || p[l-1] == 's'))
+}
+
+// cutCommaSpace returns the bytes before and after the first ", ". after is
+// nil if there is none.
+func cutCommaSpace(b []byte) (before, after []byte) {
+	if i := bytes.Index(b, commaSpace); i != -1 {
+		return b[:i], b[i+len(commaSpace):]
+	}
+	return b, nil
+}
+
+// skipHexField returns the index following prefix and at least one
+// hexadecimal digit starting at b[i:], or -1.
+func skipHexField(b []byte, i int, prefix string) int {
+	if len(b)-i < len(prefix) || string(b[i:i+len(prefix)]) != prefix {
+		return -1
+	}
+	i += len(prefix)
+	j := skipHex(b, i)
+	if j == i {
+		return -1
+	}
+	return j
+}
+
+// skipDigits returns the index of the first non decimal digit in b[i:].
+func skipDigits(b []byte, i int) int {
+	for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// skipHex returns the index of the first non lowercase hexadecimal digit in
+// b[i:].
+func skipHex(b []byte, i int) int {
+	for i < len(b) && (b[i] >= '0' && b[i] <= '9' || b[i] >= 'a' && b[i] <= 'f') {
+		i++
+	}
+	return i
+}
+
+// isDigits returns true if b is a non-empty sequence of decimal digits.
+func isDigits(b []byte) bool {
+	return len(b) != 0 && skipDigits(b, 0) == len(b)
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
 // hasPrefix returns true if any of s is the prefix of p.
-func hasPrefix(p string, s map[string]string) bool {
+func hasPrefix(p string, s map[string]string, fold bool) bool {
 	lp := len(p)
 	for prefix := range s {
-		if l := len(prefix); lp > l+1 && p[:l] == prefix && p[l] == '/' {
+		if l := len(prefix); lp > l+1 && equalPath(p[:l], prefix, fold) && p[l] == '/' {
 			return true
 		}
 	}
@@ -865,22 +2258,47 @@ func hasPrefix(p string, s map[string]string) bool {
 
 // hasSrcPrefix returns true if any of s is the prefix of p with /src/ or
 // /pkg/mod/.
-func hasSrcPrefix(p string, s map[string]string) bool {
+func hasSrcPrefix(p string, s map[string]string, fold bool) bool {
 	lp := len(p)
 	const src = "/src/"
 	const pkgmod = "/pkg/mod/"
 	for prefix := range s {
 		l := len(prefix)
-		if lp > l+len(src) && p[:l] == prefix && p[l:l+len(src)] == src {
+		if lp > l+len(src) && equalPath(p[:l], prefix, fold) && equalPath(p[l:l+len(src)], src, fold) {
 			return true
 		}
-		if lp > l+len(pkgmod) && p[:l] == prefix && p[l:l+len(pkgmod)] == pkgmod {
+		if lp > l+len(pkgmod) && equalPath(p[:l], prefix, fold) && equalPath(p[l:l+len(pkgmod)], pkgmod, fold) {
 			return true
 		}
 	}
 	return false
 }
 
+// equalPath returns true if a and b are the same path, ignoring the case if
+// fold is true.
+func equalPath(a, b string, fold bool) bool {
+	if fold {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// hasFoldPrefix returns true if p starts with prefix, ignoring the case if
+// fold is true.
+func hasFoldPrefix(p, prefix string, fold bool) bool {
+	return len(p) >= len(prefix) && equalPath(p[:len(prefix)], prefix, fold)
+}
+
+// isWindowsPath returns true if p is an absolute Windows path, starting with
+// a drive letter like "C:/" or "C:\", or an UNC path like "\\host\share".
+func isWindowsPath(p string) bool {
+	if len(p) > 2 && p[1] == ':' && (p[2] == '/' || p[2] == '\\') {
+		c := p[0] | 0x20
+		return c >= 'a' && c <= 'z'
+	}
+	return strings.HasPrefix(p, `\\`)
+}
+
 // getFiles returns all the source files deduped and ordered.
 func getFiles(goroutines []*Goroutine) []string {
 	files := map[string]struct{}{}
@@ -944,6 +2362,19 @@ func isRootedIn(root string, parts []string) string {
 	return ""
 }
 
+// reGOROOTVersion matches the Go version in a GOROOT directory name, like
+// "go1.15.2", "go-1.15", "go1.16rc1" or "v0.0.1-go1.21.0.linux-amd64".
+var reGOROOTVersion = regexp.MustCompile(`(?:^|/|-)go-?(1\.\d+(?:\.\d+)?(?:(?:beta|rc)\d+)?)(?:\.[a-z0-9]+-[a-z0-9]+)?$`)
+
+// goVersionFromGOROOT returns the Go version embedded in the GOROOT path, if
+// any.
+func goVersionFromGOROOT(goroot string) string {
+	if m := reGOROOTVersion.FindStringSubmatch(goroot); m != nil {
+		return "go" + m[1]
+	}
+	return ""
+}
+
 // reModule find the module line in a go.mod file. It works even on CRLF file.
 var reModule = regexp.MustCompile(`(?m)^module\s+([^\n\r]+)\r?$`)
 
@@ -959,11 +2390,7 @@ func (g *gomodCache) isGoModule(parts []string) (string, string) {
 			break
 		}
 		(*g)[prefix] = struct{}{}
-		p := pathJoin(prefix, "go.mod")
-		if runtime.GOOS == "windows" {
-			p = strings.Replace(p, "/", pathSeparator, -1)
-		}
-		b, err := ioutil.ReadFile(p)
+		b, err := ioutil.ReadFile(toNativePath(pathJoin(prefix, "go.mod")))
 		if err != nil {
 			continue
 		}
@@ -974,6 +2401,184 @@ func (g *gomodCache) isGoModule(parts []string) (string, string) {
 	return "", ""
 }
 
+// addLocalModules adds to LocalGomods the local go modules that are
+// referenced by the go module at root.
+//
+// These are the "replace" statements pointing to a local directory in its
+// go.mod file, and the "use" and "replace" statements of the go.work file
+// found in root or one of its parent directories.
+//
+// This permits finding sources for modules that are not in a parent
+// directory of another file in the traceback, which is frequent with
+// -trimpath.
+func (s *Snapshot) addLocalModules(root string) {
+	if b, err := ioutil.ReadFile(toNativePath(pathJoin(root, "go.mod"))); err == nil {
+		s.addReplaced(root, parseGoModFile(b))
+	}
+	parts := splitPath(root)
+	for i := len(parts); i > 0; i-- {
+		dir := pathJoin(parts[:i]...)
+		b, err := ioutil.ReadFile(toNativePath(pathJoin(dir, "go.work")))
+		if err != nil {
+			continue
+		}
+		directives := parseGoModFile(b)
+		for _, d := range directives {
+			if d.verb != "use" || len(d.args) != 1 || d.args[0] == "" {
+				continue
+			}
+			p := joinModulePath(dir, d.args[0])
+			if _, ok := s.LocalGomods[p]; ok {
+				continue
+			}
+			if m, err := ioutil.ReadFile(toNativePath(pathJoin(p, "go.mod"))); err == nil {
+				if match := reModule.FindSubmatch(m); match != nil {
+					s.LocalGomods[p] = string(match[1])
+				}
+			}
+		}
+		// Replacements in go.work override the ones in go.mod.
+		s.addReplaced(dir, directives)
+		// Nested workspaces are not supported by the go tool.
+		break
+	}
+}
+
+// addReplaced adds to LocalGomods the "replace" directives pointing to a
+// local directory. Relative paths are relative to dir.
+func (s *Snapshot) addReplaced(dir string, directives []goModDirective) {
+	for _, d := range directives {
+		if d.verb != "replace" {
+			continue
+		}
+		// "old [version] => new [version]"
+		arrow := -1
+		for i, a := range d.args {
+			if a == "=>" {
+				arrow = i
+				break
+			}
+		}
+		if arrow < 1 || arrow+1 >= len(d.args) {
+			continue
+		}
+		// A local directory replacement never has a version.
+		if dst := d.args[arrow+1]; arrow+2 == len(d.args) && isLocalModulePath(dst) {
+			s.LocalGomods[joinModulePath(dir, dst)] = d.args[0]
+		}
+	}
+}
+
+// goModDirective is a directive in a go.mod or go.work file.
+//
+// Block statements are expanded as one directive per line.
+type goModDirective struct {
+	verb string
+	args []string
+}
+
+// parseGoModFile does a minimalist parsing of a go.mod or go.work file.
+//
+// It is not a complete implementation of golang.org/x/mod/modfile but it is
+// sufficient to extract "module", "use" and "replace" statements. It works
+// even on CRLF file.
+func parseGoModFile(b []byte) []goModDirective {
+	var out []goModDirective
+	block := ""
+	for _, line := range strings.Split(string(b), "\n") {
+		if i := strings.Index(line, "//"); i != -1 {
+			line = line[:i]
+		}
+		fields := splitGoModFields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			out = append(out, goModDirective{verb: block, args: fields})
+			continue
+		}
+		if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		out = append(out, goModDirective{verb: fields[0], args: fields[1:]})
+	}
+	return out
+}
+
+// splitGoModFields splits a line in a go.mod file into its fields, handling
+// quoted strings.
+func splitGoModFields(line string) []string {
+	var out []string
+	for {
+		line = strings.TrimLeft(line, " \t\r")
+		if line == "" {
+			return out
+		}
+		if q := line[0]; q == '"' || q == '`' {
+			// Find the closing quote, skipping escaped characters.
+			for i := 1; i < len(line); i++ {
+				if line[i] == '\\' && q == '"' {
+					i++
+					continue
+				}
+				if line[i] == q {
+					if u, err := strconv.Unquote(line[:i+1]); err == nil {
+						out = append(out, u)
+						line = line[i+1:]
+					}
+					break
+				}
+			}
+			if line != "" && line[0] == q {
+				// Unterminated or invalid quoted string.
+				return append(out, line)
+			}
+			continue
+		}
+		i := strings.IndexAny(line, " \t\r")
+		if i == -1 {
+			return append(out, line)
+		}
+		out = append(out, line[:i])
+		line = line[i:]
+	}
+}
+
+// isLocalModulePath returns true if the path in a go.mod "replace" statement
+// refers to a local directory.
+//
+// See https://golang.org/ref/mod#go-mod-file-replace.
+func isLocalModulePath(p string) bool {
+	p = strings.Replace(p, "\\", "/", -1)
+	return strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") || p == "." || p == ".." || strings.HasPrefix(p, "/") || (len(p) > 2 && p[1] == ':' && p[2] == '/')
+}
+
+// joinModulePath returns the absolute path of p relative to dir, using "/"
+// as path separator.
+//
+// p must not be empty.
+func joinModulePath(dir, p string) string {
+	p = strings.Replace(p, "\\", "/", -1)
+	if strings.HasPrefix(p, "/") || (len(p) > 2 && p[1] == ':' && p[2] == '/') {
+		return path.Clean(p)
+	}
+	return path.Clean(dir + "/" + p)
+}
+
+// toNativePath converts a path using "/" as path separator to the local
+// format.
+func toNativePath(p string) string {
+	if runtime.GOOS == "windows" {
+		return strings.Replace(p, "/", pathSeparator, -1)
+	}
+	return p
+}
+
 // findRoots sets member RemoteGOROOT, RemoteGOPATHs and LocalGomods.
 //
 // This causes disk I/O as it checks for file presence.
@@ -983,23 +2588,52 @@ func (s *Snapshot) findRoots() int {
 	// TODO(maruel): Reduce memory allocations in this function.
 	s.RemoteGOPATHs = map[string]string{}
 	s.LocalGomods = map[string]string{}
+	return s.addRoots(s.Goroutines)
+}
+
+// addRoots is findRoots() for the goroutines, keeping the roots already
+// found.
+func (s *Snapshot) addRoots(goroutines []*Goroutine) int {
 	missing := 0
 	gmc := gomodCache{}
-	for _, f := range getFiles(s.Goroutines) {
+	files := getFiles(goroutines)
+	if s.RemoteGOOS == "" {
+		for _, f := range files {
+			if isWindowsPath(f) {
+				s.RemoteGOOS = "windows"
+				break
+			}
+		}
+	}
+	fold := s.RemoteGOOS == "windows"
+	for _, f := range files {
 		// TODO(maruel): Could a stack dump have mixed cases? I think it's
 		// possible, need to confirm and handle.
 		//log.Printf("  Analyzing %s", f)
 
 		// First checks skip file I/O.
-		if s.RemoteGOROOT != "" && strings.HasPrefix(f, s.RemoteGOROOT+"/src/") {
+		if s.RemoteGOROOT != "" && hasFoldPrefix(f, s.RemoteGOROOT+"/src/", fold) {
 			// stdlib.
 			continue
 		}
-		if hasSrcPrefix(f, s.RemoteGOPATHs) {
+		if hasSrcPrefix(f, s.RemoteGOPATHs, fold) {
 			// $GOPATH/src or go.mod dependency in $GOPATH/pkg/mod.
 			continue
 		}
-		if hasPrefix(f, s.LocalGomods) {
+		if hasPrefix(f, s.LocalGomods, fold) {
+			continue
+		}
+		if isLibgoPath(f) {
+			// gccgo's standard library is in the GCC sources, which are not
+			// laid out like a GOROOT.
+			missing++
+			continue
+		}
+		if isTrimmedPath(f) {
+			if !s.findTrimmedRoot(f, gmc) {
+				//log.Printf("Failed to find locally: %s", f)
+				missing++
+			}
 			continue
 		}
 
@@ -1039,6 +2673,7 @@ func (s *Snapshot) findRoots() int {
 			// Search upward looking for a go.mod.
 			if root, path := gmc.isGoModule(parts[:len(parts)-1]); root != "" {
 				s.LocalGomods[root] = path
+				s.addLocalModules(root)
 				continue
 			}
 		}
@@ -1055,6 +2690,152 @@ func (s *Snapshot) findRoots() int {
 	return missing
 }
 
+// findTrimmedRoot looks up the local file for a path that is not rooted, as
+// generated by "go build -trimpath" or by Bazel.
+//
+// It initializes LocalBazelExecRoot and LocalGomods as needed.
+//
+// Returns true if the file was found locally.
+func (s *Snapshot) findTrimmedRoot(f string, gmc gomodCache) bool {
+	if strings.HasPrefix(f, "bazel-out/") && s.LocalBazelExecRoot == "" && s.LocalBazelOutputBase != "" {
+		// The execution root is "<output_base>/execroot/<workspace name>". The
+		// workspace name is not known, so try them all.
+		if entries, err := ioutil.ReadDir(s.LocalBazelOutputBase + "/execroot"); err == nil {
+			for _, e := range entries {
+				if r := s.LocalBazelOutputBase + "/execroot/" + e.Name(); isFile(pathJoin(r, f)) {
+					s.LocalBazelExecRoot = r
+					break
+				}
+			}
+		}
+	}
+	// The main module of a -trimpath executable is printed as its import path,
+	// which may not contain a dot. Try the module containing the current
+	// working directory, since it is frequently where the executable was
+	// built.
+	if !strings.Contains(f, "@") && !strings.HasPrefix(f, "external/") && !strings.HasPrefix(f, "bazel-out/") && !strings.HasPrefix(f, "GOROOT/") {
+		found := false
+		for _, imp := range s.LocalGomods {
+			if strings.HasPrefix(f, imp+"/") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			// Only use it if it is the module of the file.
+			if wd := s.wdModule(gmc); wd.root != "" && strings.HasPrefix(f, wd.importPath+"/") {
+				if _, ok := s.LocalGomods[wd.root]; !ok {
+					s.LocalGomods[wd.root] = wd.importPath
+					s.addLocalModules(wd.root)
+				}
+			}
+		}
+	}
+	c := Call{RemoteSrcPath: f}
+	return c.updateTrimmedLocations(s.roots()) && isFile(c.LocalSrcPath)
+}
+
+// localModule is a go module in the local file system.
+type localModule struct {
+	root       string
+	importPath string
+}
+
+// wdModule returns the go module containing the current working directory,
+// if any.
+//
+// It is looked up once per snapshot.
+func (s *Snapshot) wdModule(gmc gomodCache) localModule {
+	if s.wd == nil {
+		s.wd = &localModule{}
+		if wd, err := os.Getwd(); err == nil {
+			if runtime.GOOS == "windows" {
+				wd = strings.Replace(wd, pathSeparator, "/", -1)
+			}
+			s.wd.root, s.wd.importPath = gmc.isGoModule(splitPath(wd))
+		}
+	}
+	return *s.wd
+}
+
+// isTrimmedPath returns true if the path is not rooted, as generated by "go
+// build -trimpath" or by Bazel.
+//
+// Uses "/" as path separator.
+func isTrimmedPath(p string) bool {
+	if p == "" || p[0] == '/' || p[0] == '<' || strings.IndexByte(p, '/') <= 0 {
+		// Includes "??", "<autogenerated>" and "<unavailable>".
+		return false
+	}
+	// Windows absolute path.
+	return !(len(p) > 2 && p[1] == ':' && p[2] == '/')
+}
+
+// isLibgoPath returns true if the path is in gccgo's runtime or standard
+// library, in the libgo directory of the GCC sources. The path is either
+// relative to the GCC build directory, e.g.
+// "../../../src/libgo/go/runtime/panic.go", or inside a GCC source tree, e.g.
+// "/usr/src/gcc-13.2.0/libgo/go/runtime/panic.go".
+//
+// Uses "/" as path separator.
+func isLibgoPath(p string) bool {
+	i := strings.Index(p, libgoDir)
+	if i == -1 || (i != 0 && p[i-1] != '/') {
+		return false
+	}
+	if i == 0 || strings.HasPrefix(p, "../") {
+		return true
+	}
+	for _, d := range strings.Split(p[:i-1], "/") {
+		if strings.HasPrefix(d, "gcc") {
+			return true
+		}
+	}
+	return false
+}
+
+// libgoDir is the directory of the Go sources in the GCC sources.
+const libgoDir = "libgo/go/"
+
+// escapeModulePath escapes a path inside the go module cache.
+//
+// Upper case letters are replaced with "!" followed by the lower case letter,
+// like golang.org/x/mod/module.EscapePath does.
+func escapeModulePath(p string) string {
+	if strings.IndexFunc(p, unicode.IsUpper) == -1 {
+		return p
+	}
+	b := strings.Builder{}
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// getGOMODCACHE returns GOMODCACHE or its default, using "/" as path
+// separator.
+func getGOMODCACHE(gopaths []string) string {
+	p := os.Getenv("GOMODCACHE")
+	if p == "" {
+		if len(gopaths) == 0 {
+			return ""
+		}
+		return gopaths[0] + "/pkg/mod"
+	}
+	if runtime.GOOS == "windows" {
+		p = strings.Replace(p, pathSeparator, "/", -1)
+	}
+	// Trim trailing "/".
+	if l := len(p); p[l-1] == '/' {
+		p = p[:l-1]
+	}
+	return p
+}
+
 // getGOPATHs returns parsed GOPATH or its default, using "/" as path separator.
 func getGOPATHs() []string {
 	var out []string
@@ -1115,6 +2896,29 @@ func atou(s []byte) (int, bool) {
 	return 0, false
 }
 
+// atox is the hexadecimal equivalent of atou for lowercase digits without
+// prefix.
+//
+// It fails on overflow.
+func atox(s []byte) (uint64, bool) {
+	if len(s) == 0 || len(s) > 16 {
+		return 0, false
+	}
+	var n uint64
+	for _, ch := range s {
+		switch {
+		case ch >= '0' && ch <= '9':
+			ch -= '0'
+		case ch >= 'a' && ch <= 'f':
+			ch -= 'a' - 10
+		default:
+			return 0, false
+		}
+		n = n<<4 | uint64(ch)
+	}
+	return n, true
+}
+
 // trimLeftSpace is the faster equivalent of bytes.TrimLeft(s, "\t ").
 func trimLeftSpace(s []byte) []byte {
 	for i, ch := range s {
@@ -7,6 +7,7 @@ package stack
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -30,6 +31,8 @@ func TestScanSnapshotErr(t *testing.T) {
 		nil,
 		{LocalGOROOT: "\\"},
 		{LocalGOPATHs: []string{"\\"}},
+		{LocalGOMODCACHE: "\\"},
+		{LocalBazelOutputBase: "\\"},
 	}
 	for _, opts := range data {
 		if _, _, err := ScanSnapshot(&bytes.Buffer{}, ioutil.Discard, opts); err == nil {
@@ -93,29 +96,30 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "running",
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"github.com/cockroachdb/cockroach/storage/engine._Cfunc_DBIterSeek",
-									Args{}, "??", 0),
-								newCall(
+									Args{}, "??", 0, 0x6d),
+								newCallOffset(
 									"gopkg.in/yaml%2ev2.handleErr",
 									Args{Values: []Arg{{Value: 0x433b20, IsPtr: true}}},
 									"/gopath/src/gopkg.in/yaml.v2/yaml.go",
-									153),
-								newCall(
+									153, 0xc6),
+								newCallOffset(
 									"reflect.Value.assignTo",
 									Args{Values: []Arg{{Value: 0x570860, IsPtr: true}, {Value: 0xc20803f3e0, IsPtr: true}, {Value: 0x15}}},
 									"/goroot/src/reflect/value.go",
-									2125),
-								newCall(
+									2125, 0x368),
+								newCallOffset(
 									"main.main",
 									Args{},
 									"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-									428),
+									428, 0x27),
 							},
 						},
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 65573, End: 65937, FirstLine: 4, LastLine: 12},
 				},
 			},
 		},
@@ -148,16 +152,17 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						SleepMax: 100,
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"gopkg.in/yaml%2ev2.handleErr",
 									Args{Values: []Arg{{Value: 0x433b20, IsPtr: true}}},
 									"/gopath/src/gopkg.in/yaml.v2/yaml.go",
-									153),
+									153, 0xc6),
 							},
 						},
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 13, End: 138, FirstLine: 3, LastLine: 5},
 				},
 				{
 					Signature: Signature{
@@ -165,15 +170,16 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						Locked: true,
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"gopkg.in/yaml%2ev2.handleErr",
 									Args{Values: []Arg{{Value: 0x8033b21, Name: "#1", IsPtr: true}}},
 									"/gopath/src/gopkg.in/yaml.v2/yaml.go",
-									153),
+									153, 0xc6),
 							},
 						},
 					},
-					ID: 2,
+					ID:    2,
+					Input: InputRange{Offset: 139, End: 270, FirstLine: 7, LastLine: 9},
 				},
 				{
 					Signature: Signature{
@@ -182,16 +188,17 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						SleepMax: 101,
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"gopkg.in/yaml%2ev2.handleErr",
 									Args{Values: []Arg{{Value: 0x8033b22, Name: "#2", IsPtr: true}}},
 									"/gopath/src/gopkg.in/yaml.v2/yaml.go",
-									153),
+									153, 0xc6),
 							},
 						},
 						Locked: true,
 					},
-					ID: 3,
+					ID:    3,
+					Input: InputRange{Offset: 271, End: 415, FirstLine: 11, LastLine: 13},
 				},
 			},
 		},
@@ -224,6 +231,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    16,
 					First: true,
+					Input: InputRange{Offset: 35, End: 159, FirstLine: 3, LastLine: 5},
 				},
 			},
 		},
@@ -246,16 +254,17 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "garbage collection",
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallPC(
 									"runtime.switchtoM",
 									Args{},
 									"/goroot/src/runtime/asm_amd64.s",
-									198),
+									198, 0, 0x5007be),
 							},
 						},
 					},
 					ID:    16,
 					First: true,
+					Input: InputRange{Offset: 35, End: 171, FirstLine: 3, LastLine: 5},
 				},
 			},
 		},
@@ -285,6 +294,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 35, End: 113, FirstLine: 3, LastLine: 4},
 				},
 			},
 		},
@@ -321,6 +331,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 35, End: 200, FirstLine: 3, LastLine: 6},
 				},
 			},
 		},
@@ -351,6 +362,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 35, End: 58, FirstLine: 3, LastLine: 3},
 				},
 			},
 		},
@@ -377,6 +389,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 0, End: 82, FirstLine: 1, LastLine: 2},
 				},
 			},
 		},
@@ -402,6 +415,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					Signature: Signature{State: "garbage collection"},
 					ID:        16,
 					First:     true,
+					Input:     InputRange{Offset: 35, End: 70, FirstLine: 3, LastLine: 3},
 				},
 			},
 		},
@@ -427,16 +441,16 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "garbage collection",
 						CreatedBy: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"testing.RunTests",
 									Args{},
 									"/goroot/src/testing/testing.go",
-									555),
+									555, 0xa8b),
 							},
 						},
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"github.com/maruel/panicparse/stack/stack.recurseType",
 									Args{
 										Values: []Arg{
@@ -448,13 +462,14 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 										},
 									},
 									"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-									53),
+									53, 0x845),
 							},
 							Elided: true,
 						},
 					},
 					ID:    16,
 					First: true,
+					Input: InputRange{Offset: 35, End: 394, FirstLine: 3, LastLine: 8},
 				},
 			},
 		},
@@ -485,16 +500,16 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "syscall",
 						CreatedBy: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"os/signal.init·1",
 									Args{},
 									"/goroot/src/os/signal/signal_unix.go",
-									27),
+									27, 0x35),
 							},
 						},
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"runtime.notetsleepg",
 									Args{
 										Values: []Arg{
@@ -504,27 +519,28 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 										},
 									},
 									"/goroot/src/runtime/lock_futex.go",
-									201),
-								newCall(
+									201, 0x52),
+								newCallOffset(
 									"runtime.signal_recv",
 									Args{Values: []Arg{{}}},
 									"/goroot/src/runtime/sigqueue.go",
-									109),
-								newCall(
+									109, 0x135),
+								newCallOffset(
 									"os/signal.loop",
 									Args{},
 									"/goroot/src/os/signal/signal_unix.go",
-									21),
-								newCall(
+									21, 0x1f),
+								newCallOffset(
 									"runtime.goexit",
 									Args{},
 									"/goroot/src/runtime/asm_amd64.s",
-									2232),
+									2232, 0x1),
 							},
 						},
 					},
 					ID:    5,
 					First: true,
+					Input: InputRange{Offset: 35, End: 555, FirstLine: 3, LastLine: 13},
 				},
 			},
 		},
@@ -548,11 +564,11 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "running",
 						CreatedBy: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"github.com/maruel/panicparse/stack.New",
 									Args{},
 									"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-									131),
+									131, 0x381),
 							},
 						},
 						Stack: Stack{
@@ -561,6 +577,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    24,
 					First: true,
+					Input: InputRange{Offset: 35, End: 231, FirstLine: 3, LastLine: 6},
 				},
 			},
 		},
@@ -587,6 +604,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    24,
 					First: true,
+					Input: InputRange{Offset: 35, End: 113, FirstLine: 3, LastLine: 4},
 				},
 			},
 		},
@@ -613,6 +631,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    24,
 					First: true,
+					Input: InputRange{Offset: 35, End: 113, FirstLine: 3, LastLine: 4},
 				},
 			},
 		},
@@ -637,11 +656,11 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "runnable",
 						CreatedBy: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"github.com/maruel/panicparse/stack.New",
 									Args{},
 									"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-									113),
+									113, 0x43b),
 							},
 						},
 						Stack: Stack{
@@ -656,6 +675,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    37,
 					First: true,
+					Input: InputRange{Offset: 42, End: 293, FirstLine: 3, LastLine: 7},
 				},
 			},
 		},
@@ -677,6 +697,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					Signature: Signature{State: "running"},
 					ID:        1,
 					First:     true,
+					Input:     InputRange{Offset: 35, End: 58, FirstLine: 3, LastLine: 3},
 				},
 			},
 		},
@@ -706,6 +727,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 35, End: 105, FirstLine: 3, LastLine: 4},
 				},
 			},
 		},
@@ -732,11 +754,11 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "running",
 						CreatedBy: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"github.com/maruel/panicparse/stack.New",
 									Args{},
 									"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-									131),
+									131, 0x381),
 							},
 						},
 						Stack: Stack{
@@ -751,6 +773,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 35, End: 284, FirstLine: 3, LastLine: 7},
 				},
 			},
 		},
@@ -791,6 +814,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 35, End: 216, FirstLine: 3, LastLine: 6},
 				},
 			},
 		},
@@ -824,7 +848,7 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "idle",
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"runtime.epollwait",
 									Args{
 										Values: []Arg{
@@ -842,33 +866,35 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 										Elided: true,
 									},
 									"/goroot/src/runtime/sys_linux_amd64.s",
-									400),
-								newCall(
+									400, 0x19),
+								newCallOffset(
 									"runtime.netpoll",
 									Args{Values: []Arg{{Value: 0x901b01, IsPtr: true}, {}}},
 									"/goroot/src/runtime/netpoll_epoll.go",
-									68),
-								newCall(
+									68, 0xa3),
+								newCallOffset(
 									"findrunnable",
 									Args{Values: []Arg{{Value: 0xc208012000, IsPtr: true}}},
 									"/goroot/src/runtime/proc.c",
-									1472),
-								newCall("schedule", Args{}, "/goroot/src/runtime/proc.c", 1575),
-								newCall(
+									1472, 0x485),
+								newCallOffset("schedule", Args{}, "/goroot/src/runtime/proc.c", 1575, 0x151),
+								newCallOffset(
 									"runtime.park_m",
 									Args{Values: []Arg{{Value: 0xc2080017a0, IsPtr: true}}},
 									"/goroot/src/runtime/proc.c",
-									1654),
-								newCall(
+									1654, 0x113),
+								newCallOffset(
 									"runtime.mcall",
 									Args{Values: []Arg{{Value: 0x432684, IsPtr: true}}},
 									"/goroot/src/runtime/asm_amd64.s",
-									186),
+									186, 0x5a),
 							},
 						},
 					},
-					ID:    0,
-					First: true,
+					ID:     0,
+					First:  true,
+					Signal: "SIGQUIT: quit",
+					Input:  InputRange{Offset: 27, End: 584, FirstLine: 4, LastLine: 16},
 				},
 			},
 		},
@@ -894,31 +920,32 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "running",
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"github.com/cockroachdb/cockroach/storage/engine._Cfunc_DBIterSeek",
 									Args{},
 									"??",
-									0),
-								newCall(
+									0, 0x6d),
+								newCallOffset(
 									"gopkg.in/yaml%2ev2.handleErr",
 									Args{Values: []Arg{{Value: 0x433b20, IsPtr: true}}},
 									"/gopath/src/gopkg.in/yaml.v2/yaml.go",
-									153),
-								newCall(
+									153, 0xc6),
+								newCallOffset(
 									"reflect.Value.assignTo",
 									Args{Values: []Arg{{Value: 0x570860, IsPtr: true}, {Value: 0xc20803f3e0, IsPtr: true}, {Value: 0x15}}},
 									"/goroot/src/reflect/value.go",
-									2125),
-								newCall(
+									2125, 0x368),
+								newCallOffset(
 									"main.main",
 									Args{},
 									"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
-									428),
+									428, 0x27),
 							},
 						},
 					},
 					ID:    1,
 					First: true,
+					Input: InputRange{Offset: 0, End: 364, FirstLine: 1, LastLine: 9},
 				},
 			},
 		},
@@ -963,35 +990,36 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "running",
 						CreatedBy: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"testing.(*T).Run",
 									Args{},
 									"/home/maruel/golang/go/src/testing/testing.go",
-									916),
+									916, 0x35a),
 							},
 						},
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"foo/bar.TestArchiveFail.func1.2",
 									Args{},
 									"/home/maruel/go/foo/bar_test.go",
-									209),
-								newCall(
+									209, 0x469),
+								newCallOffset(
 									"foo/bar.TestArchiveFail",
 									Args{Values: []Arg{{Value: 0x3382000, Name: "#1", IsPtr: true}}},
 									"/home/maruel/go/src/foo/bar_test.go",
-									155),
-								newCall(
+									155, 0xf1),
+								newCallOffset(
 									"testing.tRunner",
 									Args{Values: []Arg{{Value: 0x3382000, Name: "#1", IsPtr: true}, {Value: 0x1615bf8, IsPtr: true}}},
 									"/home/maruel/golang/go/src/testing/testing.go",
-									865),
+									865, 0xc0),
 							},
 						},
 					},
 					ID:    8,
 					First: true,
+					Input: InputRange{Offset: 160, End: 562, FirstLine: 8, LastLine: 16},
 				},
 			},
 		},
@@ -1006,77 +1034,79 @@ func TestScanSnapshotSynthetic(t *testing.T) {
 						State: "running",
 						CreatedBy: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"main.panicRace",
 									Args{},
 									"/go/src/github.com/maruel/panicparse/cmd/panic/main.go",
-									153,
+									153, 0xa1,
 								),
-								newCall(
+								newCallOffset(
 									"main.main",
 									Args{},
 									"/go/src/github.com/maruel/panicparse/cmd/panic/main.go",
-									54,
+									54, 0x6c8,
 								),
 							},
 						},
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"main.panicDoRaceRead",
 									Args{},
 									"/go/src/github.com/maruel/panicparse/cmd/panic/main.go",
-									137,
+									137, 0x3a,
 								),
-								newCall(
+								newCallOffset(
 									"main.panicRace.func2",
 									Args{},
 									"/go/src/github.com/maruel/panicparse/cmd/panic/main.go",
-									154),
+									154, 0x38),
 							},
 						},
 					},
 					ID:       8,
 					First:    true,
 					RaceAddr: 0xc000014100,
+					Input:    InputRange{Offset: 55, End: 286, FirstLine: 5, LastLine: 9},
 				},
 				{
 					Signature: Signature{
 						State: "running",
 						CreatedBy: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"main.panicRace",
 									Args{},
 									"/go/src/github.com/maruel/panicparse/cmd/panic/main.go",
-									150,
+									150, 0x7f,
 								),
-								newCall(
+								newCallOffset(
 									"main.main",
 									Args{},
 									"/go/src/github.com/maruel/panicparse/cmd/panic/main.go",
-									54,
+									54, 0x6c8,
 								),
 							},
 						},
 						Stack: Stack{
 							Calls: []Call{
-								newCall(
+								newCallOffset(
 									"main.panicDoRaceWrite",
 									Args{},
 									"/go/src/github.com/maruel/panicparse/cmd/panic/main.go",
-									132),
-								newCall(
+									132, 0x41),
+								newCallOffset(
 									"main.panicRace.func1",
 									Args{},
 									"/go/src/github.com/maruel/panicparse/cmd/panic/main.go",
-									151),
+									151, 0x38),
 							},
 						},
 					},
 					ID:        7,
 					RaceWrite: true,
 					RaceAddr:  0xc000014100,
+					Input:     InputRange{Offset: 287, End: 529, FirstLine: 11, LastLine: 15},
 				},
 			},
 		},
@@ -1187,7 +1217,7 @@ func TestScanSnapshotSyntheticTwoSnapshots(t *testing.T) {
 			First: true,
 		},
 	}
-	compareGoroutines(t, want, s.Goroutines)
+	similarGoroutines(t, want, s.Goroutines)
 	compareString(t, "Ya\nGOTRACEBACK=all\npanic: simple\n\n", prefix.String())
 
 	prefix.Reset()
@@ -1228,7 +1258,7 @@ func TestScanSnapshotSyntheticTwoSnapshots(t *testing.T) {
 			First: true,
 		},
 	}
-	compareGoroutines(t, want, s.Goroutines)
+	similarGoroutines(t, want, s.Goroutines)
 	compareString(t, "Ye\nGOTRACEBACK=all\npanic: 42\n\n", prefix.String())
 	compareString(t, "Yo\n", string(suffix))
 }
@@ -1380,9 +1410,13 @@ func TestGomoduleComplex(t *testing.T) {
 
 	// Local go module search is on the path with symlink evaluated on MacOS.
 	// This is kind of confusing because it is the "remote" path.
+	//
+	// pkg3 is found via the "replace" statement in pkg1/go.mod. Its sources are
+	// still considered in GOPATH since GOPATH takes precedence.
 	wantGomods := map[string]string{
-		pathJoin(rootRemote, "pkg1"): "example.com/pkg1",
-		pathJoin(rootRemote, "pkg2"): "example.com/pkg2",
+		pathJoin(rootRemote, "pkg1"):                    "example.com/pkg1",
+		pathJoin(rootRemote, "pkg2"):                    "example.com/pkg2",
+		pathJoin(rootRemote, "go/src/example.com/pkg3"): "example.com/pkg3",
 	}
 	if diff := cmp.Diff(s.LocalGomods, wantGomods); diff != "" {
 		t.Fatalf("+want/-got: %s", diff)
@@ -1456,7 +1490,7 @@ func TestGomoduleComplex(t *testing.T) {
 	similarGoroutines(t, want, s.Goroutines)
 }
 
-func TestGoRun(t *testing.T) {
+func TestFindRootsTrimmed(t *testing.T) {
 	t.Parallel()
 	root, err := ioutil.TempDir("", "stack")
 	if err != nil {
@@ -1467,141 +1501,1216 @@ func TestGoRun(t *testing.T) {
 			t.Error(err)
 		}
 	}()
+	root = strings.Replace(root, pathSeparator, "/", -1)
+	createTree(t, root, map[string]string{
+		"goroot/src/runtime/panic.go":                               "package runtime\n",
+		"modcache/github.com/!burnt!sushi/toml@v0.3.1/decode.go":    "package toml\n",
+		"bazel/external/com_github_foo_bar/baz.go":                  "package bar\n",
+		"bazel/execroot/ws/bazel-out/k8-fastbuild/bin/proto/foo.go": "package proto\n",
+		"myapp/go.mod":   "module myapp\n",
+		"myapp/cmd/x.go": "package main\n",
+	})
+	s := Snapshot{
+		LocalGOROOT:          root + "/goroot",
+		LocalGOMODCACHE:      root + "/modcache",
+		LocalBazelOutputBase: root + "/bazel",
+		// The executable was built from the working directory. The main module
+		// path doesn't have a dot, like the standard library.
+		wd: &localModule{root: root + "/myapp", importPath: "myapp"},
+		Goroutines: []*Goroutine{
+			{
+				Signature: Signature{
+					Stack: Stack{
+						Calls: []Call{
+							newCall("runtime.gopanic", Args{}, "runtime/panic.go", 1),
+							newCall("github.com/BurntSushi/toml.Decode", Args{}, "github.com/BurntSushi/toml@v0.3.1/decode.go", 1),
+							newCall("github.com/foo/bar.Baz", Args{}, "external/com_github_foo_bar/baz.go", 1),
+							newCall("example.com/foo/proto.init", Args{}, "bazel-out/k8-fastbuild/bin/proto/foo.go", 1),
+							newCall("main.main", Args{}, "myapp/cmd/x.go", 1),
+						},
+					},
+				},
+			},
+		},
+	}
+	if !s.guessPaths() {
+		t.Error("expected success")
+	}
+	compareString(t, root+"/bazel/execroot/ws", s.LocalBazelExecRoot)
+	want := []string{
+		root + "/goroot/src/runtime/panic.go",
+		root + "/modcache/github.com/!burnt!sushi/toml@v0.3.1/decode.go",
+		root + "/bazel/external/com_github_foo_bar/baz.go",
+		root + "/bazel/execroot/ws/bazel-out/k8-fastbuild/bin/proto/foo.go",
+		root + "/myapp/cmd/x.go",
+	}
+	for i, c := range s.Goroutines[0].Stack.Calls {
+		compareString(t, want[i], c.LocalSrcPath)
+	}
+	if l := s.Goroutines[0].Stack.Calls[4].Location; l != GoMod {
+		t.Errorf("want GoMod, got %s", l)
+	}
 
-	p := filepath.Join(root, "main.go")
-	content := "package main\nfunc main() { panic(42) }\n"
-	if err = ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+	// Missing files are reported as such.
+	s.Goroutines[0].Stack.Calls = append(s.Goroutines[0].Stack.Calls, newCall("net.Dial", Args{}, "net/dial.go", 1))
+	if s.guessPaths() {
+		t.Error("expected failure")
+	}
+
+	// The working directory module is not used for another module.
+	s = Snapshot{
+		wd: &localModule{root: root + "/myapp", importPath: "myapp"},
+		Goroutines: []*Goroutine{
+			{Signature: Signature{Stack: Stack{Calls: []Call{newCall("example.com/other.O", Args{}, "example.com/other/o.go", 1)}}}},
+		},
+	}
+	if s.guessPaths() {
+		t.Error("expected failure")
+	}
+	if len(s.LocalGomods) != 0 {
+		t.Errorf("unexpected LocalGomods: %v", s.LocalGomods)
+	}
+}
+
+func TestFindRootsWindows(t *testing.T) {
+	t.Parallel()
+	root, err := ioutil.TempDir("", "stack")
+	if err != nil {
 		t.Fatal(err)
 	}
-	c := exec.Command("go", "run", p)
-	out, err := c.CombinedOutput()
-	if err == nil {
-		t.Fatal("expected failure")
+	defer func() {
+		if err = os.RemoveAll(root); err != nil {
+			t.Error(err)
+		}
+	}()
+	root = strings.Replace(root, pathSeparator, "/", -1)
+	createTree(t, root, map[string]string{
+		"goroot/src/runtime/asm_amd64.s":         "",
+		"gopath/src/example.com/foo/foo.go":      "package foo\n",
+		"gopath/src/example.com/foo/cmd/main.go": "package main\n",
+	})
+	// A snapshot from a Windows host, analyzed independently of the local OS.
+	// The drive letter case varies, which happens when the executable and its
+	// dependencies were not built from the same shell.
+	in := strings.Join([]string{
+		"goroutine 1 [running]:",
+		"example.com/foo.Crash()",
+		"\tC:/Users/Bob/go/src/example.com/foo/foo.go:5 +0x25",
+		"main.main()",
+		"\tc:/users/bob/go/src/example.com/foo/cmd/main.go:8 +0x25",
+		"",
+		"goroutine 2 [chan receive]:",
+		"runtime.goexit()",
+		"\tC:\\Program Files\\Go\\src\\runtime\\asm_amd64.s:1700 +0x1",
+		"runtime.gopark()",
+		"\tc:/program files/go/src/runtime/proc.go:398 +0xce",
+		"",
+	}, "\n")
+	opts := &Opts{
+		LocalGOROOT:  root + "/goroot",
+		LocalGOPATHs: []string{root + "/gopath"},
+		GuessPaths:   true,
+	}
+	s, _, err := ScanSnapshot(strings.NewReader(in), ioutil.Discard, opts)
+	if err != io.EOF {
+		t.Fatal(err)
 	}
-	prefix := bytes.Buffer{}
-	s, suffix, err := ScanSnapshot(bytes.NewReader(out), &prefix, defaultOpts())
-	compareErr(t, nil, err)
-	compareString(t, "panic: 42\n\n", prefix.String())
-	compareString(t, "exit status 2\n", string(suffix))
-	if s == nil {
-		t.Fatal("expected snapshot")
+	compareString(t, "windows", s.RemoteGOOS)
+	compareString(t, "C:/Program Files/Go", s.RemoteGOROOT)
+	if diff := cmp.Diff(map[string]string{"C:/Users/Bob/go": root + "/gopath"}, s.RemoteGOPATHs); diff != "" {
+		t.Fatalf("RemoteGOPATHs mismatch (-want +got):\n%s", diff)
 	}
-	if runtime.GOOS == "windows" {
-		// On Windows, we must make the path to be POSIX style.
-		p = strings.Replace(p, pathSeparator, "/", -1)
+	want := []struct {
+		remote, local string
+		loc           Location
+	}{
+		{"C:/Users/Bob/go/src/example.com/foo/foo.go", root + "/gopath/src/example.com/foo/foo.go", GOPATH},
+		{"c:/users/bob/go/src/example.com/foo/cmd/main.go", root + "/gopath/src/example.com/foo/cmd/main.go", GOPATH},
+		{"C:/Program Files/Go/src/runtime/asm_amd64.s", root + "/goroot/src/runtime/asm_amd64.s", Stdlib},
+		{"c:/program files/go/src/runtime/proc.go", root + "/goroot/src/runtime/proc.go", Stdlib},
 	}
+	var got []Call
+	for _, g := range s.Goroutines {
+		got = append(got, g.Stack.Calls...)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected calls: %v", got)
+	}
+	for i, c := range got {
+		if c.RemoteSrcPath != want[i].remote || c.LocalSrcPath != want[i].local || c.Location != want[i].loc {
+			t.Errorf("#%d: want %s %s %s, got %s %s %s", i, want[i].remote, want[i].local, want[i].loc, c.RemoteSrcPath, c.LocalSrcPath, c.Location)
+		}
+	}
+	compareString(t, "asm_amd64.s", got[2].SrcName)
 
-	want := []*Goroutine{
-		{
-			Signature: Signature{
-				State: "running",
-				Stack: Stack{
-					Calls: []Call{
-						{
-							Func: Func{
-								Complete:   "main.main",
-								ImportPath: "main",
-								DirName:    "main",
-								Name:       "main",
-								IsExported: true,
-								IsPkgMain:  true,
-							},
-							RemoteSrcPath: p,
-							Line:          2,
-							SrcName:       "main.go",
-							DirSrc:        path.Base(path.Dir(p)) + "/main.go",
-							ImportPath:    "main",
-							Location:      LocationUnknown,
+	// The case is significant when the remote OS is not Windows.
+	opts.RemoteGOOS = "linux"
+	if s, _, err = ScanSnapshot(strings.NewReader(in), ioutil.Discard, opts); err != io.EOF {
+		t.Fatal(err)
+	}
+	compareString(t, "linux", s.RemoteGOOS)
+	if c := s.Goroutines[1].Stack.Calls[1]; c.LocalSrcPath != "" {
+		t.Fatalf("unexpected match: %s", c.LocalSrcPath)
+	}
+}
+
+func TestIsWindowsPath(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in   string
+		want bool
+	}{
+		{"C:/foo/bar.go", true},
+		{"c:\\foo\\bar.go", true},
+		{"\\\\host\\share\\bar.go", true},
+		{"/foo/bar.go", false},
+		{"foo/bar.go", false},
+		{"C:", false},
+		{"1:/foo", false},
+	}
+	for i, line := range data {
+		if got := isWindowsPath(line.in); got != line.want {
+			t.Errorf("#%d: isWindowsPath(%q) = %t", i, line.in, got)
+		}
+	}
+}
+
+func TestFindRootsGoWork(t *testing.T) {
+	t.Parallel()
+	root, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = os.RemoveAll(root); err != nil {
+			t.Error(err)
+		}
+	}()
+	root = strings.Replace(root, pathSeparator, "/", -1)
+	createTree(t, root, map[string]string{
+		"ws/go.work": "go 1.18\n" +
+			"\n" +
+			"use (\n" +
+			"\t./a\n" +
+			"\t\"./b\" // Quoted.\n" +
+			"\t\"\" // Invalid.\n" +
+			")\n" +
+			"replace example.com/d v1.0.0 => ../d\n" +
+			"replace example.com/e => \"\"\n",
+		"ws/a/go.mod":   "module example.com/a\r\nreplace example.com/c => ../../c\r\n",
+		"ws/a/a.go":     "package a\n",
+		"ws/b/go.mod":   "module example.com/b\n",
+		"ws/b/sub/b.go": "package sub\n",
+		"c/go.mod":      "module example.com/c\n",
+		"c/c.go":        "package c\n",
+		"d/go.mod":      "module example.com/fork/d\n",
+		"d/d.go":        "package d\n",
+	})
+	s := Snapshot{
+		Goroutines: []*Goroutine{
+			{
+				Signature: Signature{
+					Stack: Stack{
+						Calls: []Call{
+							newCall("example.com/a.A", Args{}, root+"/ws/a/a.go", 1),
+							// Files as printed by an executable built with -trimpath.
+							newCall("example.com/b/sub.B", Args{}, "example.com/b/sub/b.go", 1),
+							newCall("example.com/c.C", Args{}, "example.com/c/c.go", 1),
+							newCall("example.com/d.D", Args{}, "example.com/d/d.go", 1),
 						},
 					},
 				},
 			},
-			ID:    1,
-			First: true,
 		},
 	}
-	similarGoroutines(t, want, s.Goroutines)
-
 	if !s.guessPaths() {
 		t.Error("expected success")
 	}
-	want[0].Stack.Calls[0].LocalSrcPath = p
-	want[0].Stack.Calls[0].RelSrcPath = "main.go"
-	// This is not technically true, when using go run there's no need for a
-	// go.mod file, but I don't think it's worth handling specifically.
-	want[0].Stack.Calls[0].Location = GoMod
-	similarGoroutines(t, want, s.Goroutines)
+	want := map[string]string{
+		root + "/ws/a": "example.com/a",
+		root + "/ws/b": "example.com/b",
+		root + "/c":    "example.com/c",
+		root + "/d":    "example.com/d",
+	}
+	if diff := cmp.Diff(want, s.LocalGomods); diff != "" {
+		t.Fatalf("-want, +got:\n%s", diff)
+	}
+	wantSrc := []string{
+		root + "/ws/a/a.go",
+		root + "/ws/b/sub/b.go",
+		root + "/c/c.go",
+		root + "/d/d.go",
+	}
+	wantImport := []string{"example.com/a", "example.com/b/sub", "example.com/c", "example.com/d"}
+	for i, c := range s.Goroutines[0].Stack.Calls {
+		compareString(t, wantSrc[i], c.LocalSrcPath)
+		compareString(t, wantImport[i], c.ImportPath)
+		if c.Location != GoMod {
+			t.Errorf("%d: want GoMod, got %s", i, c.Location)
+		}
+	}
 }
 
-// TestPanic runs github.com/maruel/panicparse/v2/cmd/panic with every
-// supported panic modes.
-func TestPanic(t *testing.T) {
+func TestParseGoModFile(t *testing.T) {
 	t.Parallel()
-	cmds := internaltest.PanicOutputs()
-	want := map[string]int{
-		"chan_receive":              2,
-		"chan_send":                 2,
-		"goroutine_1":               2,
-		"goroutine_dedupe_pointers": 101,
-		"goroutine_100":             101,
+	in := "module example.com/foo // comment\r\n" +
+		"\r\n" +
+		"require (\r\n" +
+		"\texample.com/bar v1.0.0\r\n" +
+		")\r\n" +
+		"replace example.com/bar => \"../my bar\"\r\n"
+	want := []goModDirective{
+		{verb: "module", args: []string{"example.com/foo"}},
+		{verb: "require", args: []string{"example.com/bar", "v1.0.0"}},
+		{verb: "replace", args: []string{"example.com/bar", "=>", "../my bar"}},
+	}
+	if diff := cmp.Diff(want, parseGoModFile([]byte(in)), cmp.AllowUnexported(goModDirective{})); diff != "" {
+		t.Fatalf("-want, +got:\n%s", diff)
 	}
+}
 
-	panicParseDir := getPanicParseDir(t)
-	ppDir := pathJoin(panicParseDir, "cmd", "panic")
+func TestIsTrimmedPath(t *testing.T) {
+	t.Parallel()
+	data := map[string]bool{
+		"":                        false,
+		"??":                      false,
+		"<autogenerated>":         false,
+		"/goroot/src/fmt/x.go":    false,
+		"c:/goroot/src/fmt/x.go":  false,
+		"main.go":                 false,
+		"fmt/print.go":            true,
+		"GOROOT/src/fmt/x.go":     true,
+		"example.com/foo@v1/x.go": true,
+	}
+	for p, want := range data {
+		if got := isTrimmedPath(p); got != want {
+			t.Errorf("isTrimmedPath(%q) = %t", p, got)
+		}
+	}
+}
 
-	// Test runtime code. For those not in "custom", just assert that they
-	// succeed.
-	custom := map[string]func(*testing.T, *Snapshot, *bytes.Buffer, string){
-		"args_elided": testPanicArgsElided,
-		"mismatched":  testPanicMismatched,
-		"race":        testPanicRace,
-		"str":         testPanicStr,
-		"utf8":        testPanicUTF8,
+func TestIsLibgoPath(t *testing.T) {
+	t.Parallel()
+	data := map[string]bool{
+		"":                                        false,
+		"../../../src/libgo/go/runtime/panic.go":  true,
+		"libgo/go/runtime/panic.go":               true,
+		"/usr/src/gcc-13.2.0/libgo/go/fmt/x.go":   true,
+		"/build/gcc/src/libgo/go/fmt/x.go":        true,
+		"/home/user/src/libgo/go/x.go":            false,
+		"/gopath/src/example.com/libgo/x.go":      false,
+		"/gopath/src/example.com/mylibgo/go/x.go": false,
+	}
+	for p, want := range data {
+		if got := isLibgoPath(p); got != want {
+			t.Errorf("isLibgoPath(%q) = %t", p, got)
+		}
 	}
-	// Make sure all custom handlers are showing up in cmds.
-	for n := range custom {
-		if _, ok := cmds[n]; !ok {
-			t.Fatalf("untested mode: %q in:\n%v", n, cmds)
+}
+
+func TestIsGccgoFunc(t *testing.T) {
+	t.Parallel()
+	data := map[string]bool{
+		"panic":                          true,
+		"__go_go":                        true,
+		"main.main":                      true,
+		"main.main.func1":                true,
+		"example.com/foo.Type.Method":    true,
+		"gopkg.in/yaml.v2.Unmarshal":     true,
+		"":                               false,
+		"FAIL":                           false,
+		"main":                           false,
+		"main.":                          false,
+		"http://example.com/foo.go":      false,
+		"example.com/foo.Type.Method:12": false,
+		"=====":                          false,
+	}
+	for name, want := range data {
+		if got := isGccgoFunc([]byte(name)); got != want {
+			t.Errorf("isGccgoFunc(%q) = %t", name, got)
 		}
 	}
+}
 
-	for cmd, data := range cmds {
-		cmd := cmd
-		data := data
-		t.Run(cmd, func(t *testing.T) {
+func TestScanSnapshotPC(t *testing.T) {
+	t.Parallel()
+	in := strings.Join([]string{
+		"goroutine 1 [running]:",
+		"non-Go function",
+		"\tpc=0x4b6ac2",
+		"non-Go function",
+		"\t/src/foo.c:12 pc=0x4b6a10",
+		"main._Cfunc_crash()",
+		"\t_cgo_gotypes.go:40 +0x49 fp=0xc000047f50 sp=0xc000047f28 pc=0x4b6a29",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:8 +0x25",
+		"",
+	}, "\n")
+	s, _, err := ScanSnapshot(bytes.NewBufferString(in), ioutil.Discard, &Opts{})
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if s == nil || len(s.Goroutines) != 1 {
+		t.Fatalf("unexpected snapshot %#v", s)
+	}
+	type loc struct {
+		Func     string
+		Src      string
+		Line     int
+		PCOffset uint64
+		PC       uint64
+	}
+	want := []loc{
+		{"non-Go function", "??", 0, 0, 0x4b6ac2},
+		{"non-Go function", "/src/foo.c", 12, 0, 0x4b6a10},
+		{"main._Cfunc_crash", "_cgo_gotypes.go", 40, 0x49, 0x4b6a29},
+		{"main.main", "/gopath/src/foo/main.go", 8, 0x25, 0},
+	}
+	var got []loc
+	for _, c := range s.Goroutines[0].Stack.Calls {
+		got = append(got, loc{c.Func.Complete, c.RemoteSrcPath, c.Line, c.PCOffset, c.PC})
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestScanSnapshotLogPrefix(t *testing.T) {
+	t.Parallel()
+	trace := []string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:8 +0x25",
+		"exit status 2",
+	}
+	data := []struct {
+		name   string
+		re     *regexp.Regexp
+		prefix string
+	}{
+		{"CRI", LogPrefixCRI, "2024-01-02T03:04:05.123456789Z stderr F "},
+		{"RFC3339", LogPrefixRFC3339, "2024-01-02T03:04:05+02:00 "},
+		{"Journald", LogPrefixSyslog, "Jan 02 03:04:05 host app[123]: "},
+		{"Syslog", LogPrefixSyslog, "<11>Jan  2 03:04:05 host app: "},
+		{"RFC5424", LogPrefixSyslog, "<11>1 2024-01-02T03:04:05Z host app 123 - - "},
+		{"AutoCRI", LogPrefixAuto, "2024-01-02T03:04:05Z stdout F "},
+		{"AutoSyslog", LogPrefixAuto, "Jan 02 03:04:05 host app[123]: "},
+		{"Custom", regexp.MustCompile(`^\[\d+\] `), "[42] "},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
 			t.Parallel()
+			in := ""
+			for _, l := range trace {
+				in += line.prefix + l + "\n"
+			}
 			prefix := bytes.Buffer{}
-			s, suffix, err := ScanSnapshot(bytes.NewReader(data), &prefix, defaultOpts())
-			if err != nil && err != io.EOF {
+			s, suffix, err := ScanSnapshot(strings.NewReader(in), &prefix, &Opts{LogPrefix: line.re})
+			if err != nil {
 				t.Fatal(err)
 			}
-			if s == nil {
-				t.Fatal("context is nil")
-			}
-			if !s.guessPaths() {
-				t.Fatal("expected GuessPaths to work")
-			}
-			if f := custom[cmd]; f != nil {
-				f(t, s, &prefix, ppDir)
-				return
-			}
-			e := want[cmd]
-			if e == 0 {
-				e = 1
-			}
-			if got := len(s.Goroutines); got != e {
-				t.Fatalf("unexpected Goroutines; want %d, got %d", e, got)
+			// Lines that are not part of the stack trace are not modified.
+			compareString(t, line.prefix+"panic: oh no\n"+line.prefix+"\n", prefix.String())
+			compareString(t, line.prefix+"exit status 2\n", string(suffix))
+			// The position includes the prefixes.
+			start := strings.Index(in, line.prefix+"goroutine 1 ")
+			end := strings.Index(in, line.prefix+"exit status 2")
+			want := []*Goroutine{
+				{
+					Signature: Signature{
+						State: "running",
+						Stack: Stack{Calls: []Call{newCallOffset("main.main", Args{}, "/gopath/src/foo/main.go", 8, 0x25)}},
+					},
+					ID:    1,
+					First: true,
+					Input: InputRange{Offset: int64(start), End: int64(end), FirstLine: 3, LastLine: 5},
+				},
 			}
-			compareString(t, "", string(suffix))
+			compareGoroutines(t, want, s.Goroutines)
 		})
 	}
 }
 
-func testPanicArgsElided(t *testing.T, s *Snapshot, b *bytes.Buffer, ppDir string) {
-	if s.RemoteGOROOT != "" {
-		t.Fatalf("RemoteGOROOT is %q", s.RemoteGOROOT)
+func TestScanSnapshotExtendedHeader(t *testing.T) {
+	t.Parallel()
+	in := strings.Join([]string{
+		"goroutine 1 gp=0xc000002380 m=0 mp=0x5f8b20 [running]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:8 +0x25",
+		"",
+		"goroutine 5 gp=0xc000007a40 m=nil [sync.Mutex.Lock, 3 minutes]:",
+		"main.lock()",
+		"\t/gopath/src/foo/main.go:12 +0x25",
+		"",
+		"goroutine 7 [chan receive (durable), 1 minutes, synctest bubble 6]:",
+		"main.wait()",
+		"\t/gopath/src/foo/main.go:16 +0x25",
+		"",
+	}, "\n")
+	s, _, err := ScanSnapshot(strings.NewReader(in), ioutil.Discard, &Opts{})
+	if err != io.EOF {
+		t.Fatal(err)
 	}
-	if b.String() != "GOTRACEBACK=all\npanic: 1\n\n" {
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{Calls: []Call{newCallOffset("main.main", Args{}, "/gopath/src/foo/main.go", 8, 0x25)}},
+			},
+			ID:    1,
+			First: true,
+			GP:    0xc000002380,
+			M:     0,
+			MP:    0x5f8b20,
+			Input: InputRange{Offset: 0, End: 100, FirstLine: 1, LastLine: 3},
+		},
+		{
+			Signature: Signature{
+				State:    "sync.Mutex.Lock",
+				SleepMin: 3,
+				SleepMax: 3,
+				Stack:    Stack{Calls: []Call{newCallOffset("main.lock", Args{}, "/gopath/src/foo/main.go", 12, 0x25)}},
+			},
+			ID:    5,
+			GP:    0xc000007a40,
+			Input: InputRange{Offset: 101, End: 211, FirstLine: 5, LastLine: 7},
+		},
+		{
+			Signature: Signature{
+				State:    "chan receive (durable)",
+				SleepMin: 1,
+				SleepMax: 1,
+				Stack:    Stack{Calls: []Call{newCallOffset("main.wait", Args{}, "/gopath/src/foo/main.go", 16, 0x25)}},
+			},
+			ID:       7,
+			Synctest: 6,
+			Input:    InputRange{Offset: 212, End: 326, FirstLine: 9, LastLine: 11},
+		},
+	}
+	compareGoroutines(t, want, s.Goroutines)
+}
+
+func TestScanSnapshotCrash(t *testing.T) {
+	t.Parallel()
+	// Output of a panic with GOTRACEBACK=crash, trimmed down.
+	in := strings.Join([]string{
+		"panic: oh no",
+		"",
+		"goroutine 1 gp=0xc000002380 m=0 mp=0x5b4520 [running]:",
+		"panic(0x45e0a0, 0x4a8b58)",
+		"\t/goroot/src/runtime/panic.go:811 +0x168 fp=0xc00006af40 sp=0xc00006ae90 pc=0x4620c8",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:8 +0x25 fp=0xc00006af50 sp=0xc00006af40 pc=0x4893a5",
+		"SIGABRT: abort",
+		"PC=0x46de01 m=0 sigcode=18446744073709551610",
+		"",
+		"goroutine 0 gp=0x5b3a40 m=0 mp=0x5b4520 [idle]:",
+		"runtime.raise()",
+		"\t/goroot/src/runtime/sys_linux_amd64.s:154 +0x21 fp=0x7ffc8a0b1d38 sp=0x7ffc8a0b1d30 pc=0x46de01",
+		"",
+		"rax    0x0",
+		"rip    0x46de01",
+		"rflags 0x286",
+		"",
+		"-----",
+		"",
+		"SIGQUIT: quit",
+		"PC=0x46e2a3 m=2 sigcode=0",
+		"",
+		"goroutine 0 gp=0xc000006c40 m=2 mp=0xc000080008 [idle]:",
+		"runtime.futex()",
+		"\t/goroot/src/runtime/sys_linux_amd64.s:557 +0x23 fp=0x7f1d39ffac18 sp=0x7f1d39ffac10 pc=0x46e2a3",
+		"",
+		"rax    0xca",
+		"rip    0x46e2a3",
+		"",
+		"exit status 2",
+		"",
+	}, "\n")
+	prefix := bytes.Buffer{}
+	s, suffix, err := ScanSnapshot(strings.NewReader(in), &prefix, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "panic: oh no\n\n", prefix.String())
+	compareString(t, "exit status 2\n", string(suffix))
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						newCallPC("panic", Args{Values: []Arg{{Value: 0x45e0a0, IsPtr: true}, {Value: 0x4a8b58, IsPtr: true}}}, "/goroot/src/runtime/panic.go", 811, 0x168, 0x4620c8),
+						newCallPC("main.main", Args{}, "/gopath/src/foo/main.go", 8, 0x25, 0x4893a5),
+					},
+				},
+			},
+			ID:    1,
+			First: true,
+			GP:    0xc000002380,
+			MP:    0x5b4520,
+			Input: InputRange{Offset: 14, End: 269, FirstLine: 3, LastLine: 7},
+		},
+		{
+			Signature: Signature{
+				State: "idle",
+				Stack: Stack{Calls: []Call{newCallPC("runtime.raise", Args{}, "/goroot/src/runtime/sys_linux_amd64.s", 154, 0x21, 0x46de01)}},
+			},
+			GP:        0x5b3a40,
+			MP:        0x5b4520,
+			Signal:    "SIGABRT: abort",
+			Registers: []Register{{Name: "rax"}, {Name: "rip", Value: 0x46de01}, {Name: "rflags", Value: 0x286}},
+			Input:     InputRange{Offset: 330, End: 491, FirstLine: 11, LastLine: 13},
+		},
+		{
+			Signature: Signature{
+				State: "idle",
+				Stack: Stack{Calls: []Call{newCallPC("runtime.futex", Args{}, "/goroot/src/runtime/sys_linux_amd64.s", 557, 0x23, 0x46e2a3)}},
+			},
+			GP:        0xc000006c40,
+			M:         2,
+			MP:        0xc000080008,
+			Signal:    "SIGQUIT: quit",
+			Registers: []Register{{Name: "rax", Value: 0xca}, {Name: "rip", Value: 0x46e2a3}},
+			Input:     InputRange{Offset: 581, End: 750, FirstLine: 24, LastLine: 26},
+		},
+	}
+	compareGoroutines(t, want, s.Goroutines)
+	if !s.Goroutines[1].Stack.Calls[0].Func.IsRuntime || s.Goroutines[0].Stack.Calls[0].Func.IsRuntime {
+		t.Fatal("unexpected IsRuntime")
+	}
+}
+
+func TestScanSnapshotGccgo(t *testing.T) {
+	t.Parallel()
+	// Output of a panic in a program built with gccgo. The arguments and the
+	// program counter offsets are not printed and the names are mangled.
+	in := strings.Join([]string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"panic",
+		"\t../../../src/libgo/go/runtime/panic.go:588",
+		"main.crash",
+		"\t/gopath/src/foo/main.go:12",
+		"main.main",
+		"\t/gopath/src/foo/main.go:8",
+		"",
+		"goroutine 18 [chan receive, 2 minutes]:",
+		"main.main..func1",
+		"\t/gopath/src/foo/main.go:6",
+		"created by main.main",
+		"\t/gopath/src/foo/main.go:5",
+		"",
+		"goroutine 19 [IO wait]:",
+		"net..z2fhttp.Server.Serve",
+		"\t../../../src/libgo/go/net/http/server.go:2927",
+		"example..z2ecom..z2fbar.Run",
+		"\t/gopath/src/example.com/bar/bar.go:20",
+		"created by example..z2ecom..z2fbar.Start",
+		"\t/gopath/src/example.com/bar/bar.go:15",
+		"",
+		"exit status 2",
+		"",
+	}, "\n")
+	prefix := bytes.Buffer{}
+	s, suffix, err := ScanSnapshot(strings.NewReader(in), &prefix, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Gccgo {
+		t.Fatal("expected gccgo to be detected")
+	}
+	compareString(t, "panic: oh no\n\n", prefix.String())
+	compareString(t, "exit status 2\n", string(suffix))
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						newCall("panic", Args{}, "../../../src/libgo/go/runtime/panic.go", 588),
+						newCall("main.crash", Args{}, "/gopath/src/foo/main.go", 12),
+						newCall("main.main", Args{}, "/gopath/src/foo/main.go", 8),
+					},
+				},
+			},
+			ID:    1,
+			First: true,
+			Input: InputRange{Offset: 14, End: 163, FirstLine: 3, LastLine: 9},
+		},
+		{
+			Signature: Signature{
+				State:     "chan receive",
+				CreatedBy: Stack{Calls: []Call{newCall("main.main", Args{}, "/gopath/src/foo/main.go", 5)}},
+				SleepMin:  2,
+				SleepMax:  2,
+				Stack:     Stack{Calls: []Call{newCall("main.main.func1", Args{}, "/gopath/src/foo/main.go", 6)}},
+			},
+			ID:    18,
+			Input: InputRange{Offset: 164, End: 296, FirstLine: 11, LastLine: 15},
+		},
+		{
+			Signature: Signature{
+				State:     "IO wait",
+				CreatedBy: Stack{Calls: []Call{newCall("example.com/bar.Start", Args{}, "/gopath/src/example.com/bar/bar.go", 15)}},
+				Stack: Stack{
+					Calls: []Call{
+						newCall("net/http.Server.Serve", Args{}, "../../../src/libgo/go/net/http/server.go", 2927),
+						newCall("example.com/bar.Run", Args{}, "/gopath/src/example.com/bar/bar.go", 20),
+					},
+				},
+			},
+			ID:    19,
+			Input: InputRange{Offset: 297, End: 541, FirstLine: 17, LastLine: 23},
+		},
+	}
+	compareGoroutines(t, want, s.Goroutines)
+
+	// The gccgo standard library is not confused with a local GOROOT.
+	opts := DefaultOpts()
+	opts.AnalyzeSources = false
+	s, _, err = ScanSnapshot(strings.NewReader(in), ioutil.Discard, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.RemoteGOROOT != "" {
+		t.Fatalf("unexpected GOROOT %q", s.RemoteGOROOT)
+	}
+	if c := s.Goroutines[2].Stack.Calls[0]; c.Location != Stdlib || c.ImportPath != "net/http" {
+		t.Fatalf("expected libgo to be stdlib, got %s %q", c.Location, c.ImportPath)
+	}
+}
+
+func TestScanSnapshotGccgoJunk(t *testing.T) {
+	t.Parallel()
+	// A line without spaces that isn't a function ends the snapshot.
+	in := "goroutine 1 [running]:\nmain.main\n\t/gopath/src/foo/main.go:8\nFAIL\nexit status 2\n"
+	s, suffix, err := ScanSnapshot(strings.NewReader(in), ioutil.Discard, &Opts{})
+	if s == nil {
+		t.Fatal(err)
+	}
+	if !s.Gccgo {
+		t.Fatal("expected gccgo to be detected")
+	}
+	compareString(t, "FAIL\nexit status 2\n", string(suffix))
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{Calls: []Call{newCall("main.main", Args{}, "/gopath/src/foo/main.go", 8)}},
+			},
+			ID:    1,
+			First: true,
+			Input: InputRange{Offset: 0, End: 60, FirstLine: 1, LastLine: 3},
+		},
+	}
+	compareGoroutines(t, want, s.Goroutines)
+}
+
+func TestScanSnapshotNotGccgo(t *testing.T) {
+	t.Parallel()
+	// A gc traceback is not confused with gccgo's.
+	in := "goroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:8 +0x25\nfoo\n"
+	s, suffix, err := ScanSnapshot(strings.NewReader(in), ioutil.Discard, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Gccgo {
+		t.Fatal("unexpected gccgo")
+	}
+	compareString(t, "foo\n", string(suffix))
+}
+
+func TestScanSnapshotStackOverflow(t *testing.T) {
+	t.Parallel()
+	lines := []string{
+		"runtime: goroutine stack exceeds 1000000000-byte limit",
+		"fatal error: stack overflow",
+		"",
+		"goroutine 1 [running]:",
+	}
+	for i := 0; i < 3; i++ {
+		lines = append(lines,
+			"main.a()",
+			"\t/gopath/src/foo/main.go:4 +0x25",
+			"main.b()",
+			"\t/gopath/src/foo/main.go:8 +0x25")
+	}
+	lines = append(lines, "...1234 frames elided...")
+	for i := 0; i < 2; i++ {
+		lines = append(lines,
+			"main.a()",
+			"\t/gopath/src/foo/main.go:4 +0x25",
+			"main.b()",
+			"\t/gopath/src/foo/main.go:8 +0x25")
+	}
+	lines = append(lines, "main.main()", "\t/gopath/src/foo/main.go:12 +0x25", "")
+	s, _, err := ScanSnapshot(strings.NewReader(strings.Join(lines, "\n")), ioutil.Discard, &Opts{})
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if len(s.Goroutines) != 1 {
+		t.Fatalf("unexpected goroutines: %d", len(s.Goroutines))
+	}
+	st := &s.Goroutines[0].Stack
+	if !st.Elided || len(st.Calls) != 11 {
+		t.Fatalf("unexpected stack: %d calls, elided %t", len(st.Calls), st.Elided)
+	}
+	c := st.Cycles()
+	if len(c) != 1 {
+		t.Fatalf("unexpected cycles: %v", c)
+	}
+	compareString(t, "main.a → main.b ×5", c[0].String())
+}
+
+func TestScanSnapshotStackErrors(t *testing.T) {
+	t.Parallel()
+	in := strings.Join([]string{
+		"runtime: found next stack barrier at 0xc42003bf80; expected [*0xc42003bfc8=0x4541a0]",
+		"fatal error: missed stack barrier",
+		"",
+		"goroutine 1 [running]:",
+		"main.f()",
+		"\t/gopath/src/foo/main.go:8 +0x25",
+		"runtime: g 1: unexpected return pc for main.f called from 0xdeadbeef",
+		"stack: frame={sp:0xc000045f48, fp:0xc000045f58} stack=[0xc000044000,0xc000046000)",
+		"0x000000c000045e48:  0x0000000000000000  0x0000000000000000 ",
+		"0x000000c000045f48: <0x0000000000000001  0x00000000deadbeef ",
+		"",
+		"goroutine 6 [chan receive]:",
+		"main.g()",
+		"\t/gopath/src/foo/main.go:12 +0x25",
+		"runtime: unexpected return pc for main.g called from 0x0",
+		"created by main.main",
+		"\t/gopath/src/foo/main.go:20 +0x25",
+		"",
+		"goroutine 7 [chan receive]:",
+		"main.h()",
+		"\t/gopath/src/foo/main.go:16 +0x25",
+		"",
+	}, "\n")
+	prefix := bytes.Buffer{}
+	s, _, err := ScanSnapshot(strings.NewReader(in), &prefix, &Opts{})
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	compareString(t, "runtime: found next stack barrier at 0xc42003bf80; expected [*0xc42003bfc8=0x4541a0]\nfatal error: missed stack barrier\n\n", prefix.String())
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{Calls: []Call{newCallOffset("main.f", Args{}, "/gopath/src/foo/main.go", 8, 0x25)}},
+			},
+			ID:    1,
+			First: true,
+			StackErrors: []string{
+				"runtime: g 1: unexpected return pc for main.f called from 0xdeadbeef",
+				"runtime: found next stack barrier at 0xc42003bf80; expected [*0xc42003bfc8=0x4541a0]",
+				"fatal error: missed stack barrier",
+			},
+			Input: InputRange{Offset: 120, End: 458, FirstLine: 4, LastLine: 10},
+		},
+		{
+			Signature: Signature{
+				State:     "chan receive",
+				CreatedBy: Stack{Calls: []Call{newCallOffset("main.main", Args{}, "/gopath/src/foo/main.go", 20, 0x25)}},
+				Stack:     Stack{Calls: []Call{newCallOffset("main.g", Args{}, "/gopath/src/foo/main.go", 12, 0x25)}},
+			},
+			ID:          6,
+			StackErrors: []string{"runtime: unexpected return pc for main.g called from 0x0"},
+			Input:       InputRange{Offset: 459, End: 642, FirstLine: 12, LastLine: 17},
+		},
+		{
+			Signature: Signature{
+				State: "chan receive",
+				Stack: Stack{Calls: []Call{newCallOffset("main.h", Args{}, "/gopath/src/foo/main.go", 16, 0x25)}},
+			},
+			ID:    7,
+			Input: InputRange{Offset: 643, End: 714, FirstLine: 19, LastLine: 21},
+		},
+	}
+	compareGoroutines(t, want, s.Goroutines)
+}
+
+func TestScanSnapshotDiagnostics(t *testing.T) {
+	t.Parallel()
+	root, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = os.RemoveAll(root); err != nil {
+			t.Error(err)
+		}
+	}()
+	root = strings.Replace(root, pathSeparator, "/", -1)
+	createTree(t, root, map[string]string{"foo/main.go": "not go\n"})
+	in := strings.Join([]string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.main(0x1)",
+		"\t" + root + "/foo/main.go:3 +0x25",
+		"",
+		"goroutine 5 [chan receive]:",
+		"main.recv()",
+		"\t/nonexistent/foo/recv.go:12 +0x25",
+		"...additional frames elided...",
+		"main.loop()",
+		"\t/nonexistent/foo/recv.go:20 +0x25",
+		"",
+		"goroutine 6 [chan receive]:",
+		"main.recv()",
+		"\t/nonexistent/foo/recv.go:12 +0x25",
+		"...additional frames elided...",
+		"exit status 2",
+		"",
+	}, "\n")
+	opts := &Opts{GuessPaths: true, AnalyzeSources: true}
+	s, suffix, err := ScanSnapshot(strings.NewReader(in), ioutil.Discard, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "exit status 2\n", string(suffix))
+	var got []string
+	for _, d := range s.Diagnostics {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"line 10: Truncated: goroutine 5: frames elided by the runtime",
+		"line 18: UnparsedLine \"exit status 2\": end of snapshot",
+		"line 7: UnresolvedPath \"/nonexistent/foo/recv.go\": first seen in goroutine 5",
+		"line 3: AugmentFailed: goroutine 1: failed to parse " + root + "/foo/main.go:1:1: expected 'package', found not",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Diagnostics mismatch (-want +got):\n%s", diff)
+	}
+
+	// The input ends in the middle of a goroutine.
+	in = "goroutine 1 [running]:\nmain.main()\n"
+	if s, _, err = ScanSnapshot(strings.NewReader(in), ioutil.Discard, &Opts{}); err != io.EOF {
+		t.Fatal(err)
+	}
+	want = []string{"line 2: Truncated: input ended in the middle of goroutine 1"}
+	got = nil
+	for _, d := range s.Diagnostics {
+		got = append(got, d.String())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Diagnostics mismatch (-want +got):\n%s", diff)
+	}
+	// The executable can't be used to symbolize.
+	st := newScanningState(&Opts{}, nil)
+	st.Goroutines = s.Goroutines
+	st.symbolize(root + "/foo/main.go")
+	if len(st.Diagnostics) != 1 || st.Diagnostics[0].Kind != SymbolizeFailed || st.Diagnostics[0].Text != root+"/foo/main.go" {
+		t.Fatalf("unexpected diagnostics: %v", st.Diagnostics)
+	}
+}
+
+func TestScanSnapshotInput(t *testing.T) {
+	t.Parallel()
+	g1 := "goroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:8 +0x25\n"
+	g5 := "goroutine 5 [chan receive]:\nmain.recv()\n\t/gopath/src/foo/main.go:12 +0x25\n" +
+		"created by main.main\n\t/gopath/src/foo/main.go:7 +0x25\n"
+	in := "panic: oh no\n\n" + g1 + "\n" + g5 + "exit status 2\n"
+	opts := &Opts{InputOffset: 1000, InputLine: 10, KeepRaw: true}
+	s, _, err := ScanSnapshot(strings.NewReader(in), ioutil.Discard, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o1 := int64(1000 + strings.Index(in, g1))
+	o5 := int64(1000 + strings.Index(in, g5))
+	want := []InputRange{
+		{Offset: o1, End: o1 + int64(len(g1)), FirstLine: 13, LastLine: 15},
+		{Offset: o5, End: o5 + int64(len(g5)), FirstLine: 17, LastLine: 21},
+	}
+	var got []InputRange
+	for _, g := range s.Goroutines {
+		got = append(got, g.Input)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Input mismatch (-want +got):\n%s", diff)
+	}
+	compareString(t, g1, string(s.Goroutines[0].Raw))
+	compareString(t, g5, string(s.Goroutines[1].Raw))
+	if diff := cmp.Diff(InputRange{Offset: o1, End: o5 + int64(len(g5)), FirstLine: 13, LastLine: 21}, s.Input); diff != "" {
+		t.Fatalf("Input mismatch (-want +got):\n%s", diff)
+	}
+	// The diagnostics use the same line numbers.
+	if len(s.Diagnostics) != 1 || s.Diagnostics[0].Line != 22 {
+		t.Fatalf("unexpected diagnostics: %v", s.Diagnostics)
+	}
+	b := s.Aggregate(AnyPointer).Buckets
+	if len(b) != 2 || b[0].Input != want[0] || b[1].Input != want[1] {
+		t.Fatalf("unexpected buckets: %v", b)
+	}
+
+	// The positions are the same with the Scanner.
+	sc, err := NewScanner(context.Background(), strings.NewReader(in), ioutil.Discard, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for sc.Scan() {
+		got = append(got, sc.Goroutine().Input)
+	}
+	if err = sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Input mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGoVersionFromGOROOT(t *testing.T) {
+	t.Parallel()
+	data := map[string]string{
+		"":                        "",
+		"/goroot":                 "",
+		"/usr/local/go":           "",
+		"/usr/local/go1.15":       "go1.15",
+		"/usr/local/go1.15.2":     "go1.15.2",
+		"/home/user/sdk/go1.16.3": "go1.16.3",
+		"/usr/lib/go-1.15":        "go1.15",
+		"c:/go1.17rc1":            "go1.17rc1",
+		"/home/user/go/pkg/mod/golang.org/toolchain@v0.0.1-go1.21.0.linux-amd64": "go1.21.0",
+		"/src/example.com/go1.15/foo":                                            "",
+	}
+	for p, want := range data {
+		if got := goVersionFromGOROOT(p); got != want {
+			t.Errorf("goVersionFromGOROOT(%q) = %q; want %q", p, got, want)
+		}
+	}
+}
+
+func TestScanSnapshotGoVersion(t *testing.T) {
+	t.Parallel()
+	in := strings.Join([]string{
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:8 +0x25",
+		"runtime.main()",
+		"\t/usr/local/go1.15.2/src/runtime/proc.go:204 +0x209",
+		"",
+	}, "\n")
+	for _, guess := range []bool{false, true} {
+		opts := defaultOpts()
+		opts.GuessPaths = guess
+		opts.AnalyzeSources = false
+		s, _, err := ScanSnapshot(bytes.NewBufferString(in), ioutil.Discard, opts)
+		if err != io.EOF {
+			t.Fatal(err)
+		}
+		if s.RemoteGoVersion != "go1.15.2" {
+			t.Fatalf("GuessPaths=%t: RemoteGoVersion = %q", guess, s.RemoteGoVersion)
+		}
+		want := ""
+		if guess {
+			want = "go1.15.2"
+		}
+		if got := s.Goroutines[0].Stack.Calls[1].ModuleVersion; got != want {
+			t.Fatalf("GuessPaths=%t: ModuleVersion = %q", guess, got)
+		}
+	}
+}
+
+func TestScanSnapshotGoMinVersion(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		name string
+		in   []string
+		want string
+	}{
+		{
+			"none",
+			[]string{"goroutine 1 [running]:", "main.main()", "\t/a/main.go:8 +0x25", "...additional frames elided...", ""},
+			"",
+		},
+		{
+			"FramesElided",
+			[]string{"goroutine 1 [running]:", "main.main()", "\t/a/main.go:8 +0x25", "...12 frames elided...", ""},
+			"go1.21",
+		},
+		{
+			"CreatedBy",
+			[]string{"goroutine 5 [chan receive]:", "main.recv()", "\t/a/main.go:12 +0x25", "created by main.main in goroutine 1", "\t/a/main.go:7 +0x25", ""},
+			"go1.21",
+		},
+		{
+			"ThreadInfo",
+			[]string{"goroutine 1 gp=0xc000002380 m=0 mp=0x5b4520 [running]:", "main.main()", "\t/a/main.go:8 +0x25", "...12 frames elided...", ""},
+			"go1.23",
+		},
+		{
+			"Synctest",
+			[]string{"goroutine 1 [running, synctest bubble 3]:", "main.main()", "\t/a/main.go:8 +0x25", ""},
+			"go1.25",
+		},
+	}
+	for _, line := range data {
+		line := line
+		t.Run(line.name, func(t *testing.T) {
+			t.Parallel()
+			s, _, err := ScanSnapshot(strings.NewReader(strings.Join(line.in, "\n")), ioutil.Discard, &Opts{})
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			compareString(t, line.want, s.RemoteGoMinVersion)
+		})
+	}
+}
+
+func TestGoRun(t *testing.T) {
+	t.Parallel()
+	root, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err = os.RemoveAll(root); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	p := filepath.Join(root, "main.go")
+	content := "package main\nfunc main() { panic(42) }\n"
+	if err = ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := exec.Command("go", "run", p)
+	out, err := c.CombinedOutput()
+	if err == nil {
+		t.Fatal("expected failure")
+	}
+	prefix := bytes.Buffer{}
+	s, suffix, err := ScanSnapshot(bytes.NewReader(out), &prefix, defaultOpts())
+	compareErr(t, nil, err)
+	compareString(t, "panic: 42\n\n", prefix.String())
+	compareString(t, "exit status 2\n", string(suffix))
+	if s == nil {
+		t.Fatal("expected snapshot")
+	}
+	if runtime.GOOS == "windows" {
+		// On Windows, we must make the path to be POSIX style.
+		p = strings.Replace(p, pathSeparator, "/", -1)
+	}
+
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						{
+							Func: Func{
+								Complete:   "main.main",
+								ImportPath: "main",
+								DirName:    "main",
+								Name:       "main",
+								IsExported: true,
+								IsPkgMain:  true,
+							},
+							RemoteSrcPath: p,
+							Line:          2,
+							SrcName:       "main.go",
+							DirSrc:        path.Base(path.Dir(p)) + "/main.go",
+							ImportPath:    "main",
+							Location:      LocationUnknown,
+						},
+					},
+				},
+			},
+			ID:    1,
+			First: true,
+		},
+	}
+	similarGoroutines(t, want, s.Goroutines)
+
+	if !s.guessPaths() {
+		t.Error("expected success")
+	}
+	want[0].Stack.Calls[0].LocalSrcPath = p
+	want[0].Stack.Calls[0].RelSrcPath = "main.go"
+	// This is not technically true, when using go run there's no need for a
+	// go.mod file, but I don't think it's worth handling specifically.
+	want[0].Stack.Calls[0].Location = GoMod
+	similarGoroutines(t, want, s.Goroutines)
+}
+
+// TestPanic runs github.com/maruel/panicparse/v2/cmd/panic with every
+// supported panic modes.
+func TestPanic(t *testing.T) {
+	t.Parallel()
+	cmds := internaltest.PanicOutputs()
+	want := map[string]int{
+		"chan_receive":              2,
+		"chan_send":                 2,
+		"goroutine_1":               2,
+		"goroutine_dedupe_pointers": 101,
+		"goroutine_100":             101,
+	}
+
+	panicParseDir := getPanicParseDir(t)
+	ppDir := pathJoin(panicParseDir, "cmd", "panic")
+
+	// Test runtime code. For those not in "custom", just assert that they
+	// succeed.
+	custom := map[string]func(*testing.T, *Snapshot, *bytes.Buffer, string){
+		"args_elided": testPanicArgsElided,
+		"mismatched":  testPanicMismatched,
+		"race":        testPanicRace,
+		"str":         testPanicStr,
+		"utf8":        testPanicUTF8,
+	}
+	// Make sure all custom handlers are showing up in cmds.
+	for n := range custom {
+		if _, ok := cmds[n]; !ok {
+			t.Fatalf("untested mode: %q in:\n%v", n, cmds)
+		}
+	}
+
+	for cmd, data := range cmds {
+		cmd := cmd
+		data := data
+		t.Run(cmd, func(t *testing.T) {
+			t.Parallel()
+			prefix := bytes.Buffer{}
+			s, suffix, err := ScanSnapshot(bytes.NewReader(data), &prefix, defaultOpts())
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			if s == nil {
+				t.Fatal("context is nil")
+			}
+			if !s.guessPaths() {
+				t.Fatal("expected GuessPaths to work")
+			}
+			if f := custom[cmd]; f != nil {
+				f(t, s, &prefix, ppDir)
+				return
+			}
+			e := want[cmd]
+			if e == 0 {
+				e = 1
+			}
+			if got := len(s.Goroutines); got != e {
+				t.Fatalf("unexpected Goroutines; want %d, got %d", e, got)
+			}
+			compareString(t, "", string(suffix))
+		})
+	}
+}
+
+func testPanicArgsElided(t *testing.T, s *Snapshot, b *bytes.Buffer, ppDir string) {
+	if s.RemoteGOROOT != "" {
+		t.Fatalf("RemoteGOROOT is %q", s.RemoteGOROOT)
+	}
+	if b.String() != "GOTRACEBACK=all\npanic: 1\n\n" {
 		t.Fatalf("output: %q", b.String())
 	}
 	want := []*Goroutine{
@@ -1940,6 +3049,275 @@ func TestTrimLeftSpace(t *testing.T) {
 	}
 }
 
+func TestAtox(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in   string
+		want uint64
+		ok   bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"2a", 0x2a, true},
+		{"ffffffffffffffff", 0xffffffffffffffff, true},
+		{"10000000000000000", 0, false},
+		{"2A", 0, false},
+		{"0x2a", 0, false},
+	}
+	for i, line := range data {
+		if got, ok := atox([]byte(line.in)); got != line.want || ok != line.ok {
+			t.Errorf("#%d: atox(%q) = %d, %t", i, line.in, got, ok)
+		}
+	}
+}
+
+// TestMatchers ensures the hand written matchers behave exactly like the
+// regexps they replaced.
+func TestMatchers(t *testing.T) {
+	t.Parallel()
+	reRoutineHeader := regexp.MustCompile("^([ \t]*)goroutine (\\d+)((?: [a-z]+=[^ \\[]+)*) \\[([^\\]]+)\\]\\:$")
+	reUnavail := regexp.MustCompile("^(?:\t| +)goroutine running on other thread; stack unavailable")
+	reCreated := regexp.MustCompile("^created by (.+)$")
+	reFunc := regexp.MustCompile(`^(.+)\((.*)\)$`)
+	reGccgoFunc := regexp.MustCompile(`^([^\s()]+)$`)
+	reFile := regexp.MustCompile("^(?:\t| +)(\\?\\?|\\<autogenerated\\>|.+\\.(?:c|go|s))\\:(\\d+)(?:| \\+0x([0-9a-f]+))(?:| fp=0x[0-9a-f]+ sp=0x[0-9a-f]+(?:| pc=0x([0-9a-f]+)))$")
+
+	lines := []string{
+		"",
+		"goroutine 1 [running]:",
+		"  goroutine 1 [running]:",
+		"\tgoroutine 12 [chan receive, 5 minutes, locked to thread]:",
+		"goroutine 1 gp=0xc000002380 m=0 mp=0x5a0ac0 [running]:",
+		"goroutine 1 gp=0xc000002380 m=nil [running]:",
+		"goroutine 1 gp= [running]:",
+		"goroutine 1 Gp=0x1 [running]:",
+		"goroutine 1 [running]:x",
+		"goroutine 1 []:",
+		"goroutine 1 [a]b]:",
+		"goroutine 1 [a[b]:",
+		"goroutine  1 [running]:",
+		"goroutine x [running]:",
+		"goroutine 1 [running]",
+		"\tgoroutine running on other thread; stack unavailable",
+		"  goroutine running on other thread; stack unavailable, or not",
+		"goroutine running on other thread; stack unavailable",
+		"created by main.main",
+		"created by main.main in goroutine 1",
+		"created by ",
+		"created by a\nb",
+		"main.main()",
+		"main.f(0x1, 0x2, ...)",
+		"main.(*T).f(0x1)",
+		"main.f(0x1)(0x2)",
+		"main.f(0x1) ",
+		"(0x1)",
+		"()",
+		"a()",
+		"a(",
+		"a\n()",
+		"main.main..func1",
+		"net..z2fhttp.Get",
+		"main.main ",
+		"a\fb",
+		"\t/foo/bar/baz.go:116 +0x35",
+		"\t/foo/bar/baz.go:116",
+		"    /foo/bar/baz.go:116 +0x35",
+		"\t/foo/bar:baz.go:116 +0x35",
+		"\t/foo/bar/baz.s:1 fp=0xc000044f58 sp=0xc000044f48 pc=0x45b9a1",
+		"\t/foo/bar/baz.c:1 +0x1 fp=0xc000044f58 sp=0xc000044f48",
+		"\t/foo/bar/baz.c:1 +0x1 fp=0xc000044f58 sp=0xc000044f48 pc=",
+		"\t/foo/bar/baz.c:1 +0x1 fp=0xc000044f58",
+		"\t/foo/bar/baz.go:116 +0x",
+		"\t/foo/bar/baz.go:116 +0x3F",
+		"\t/foo/bar/baz.go:",
+		"\t/foo/bar/baz.goo:1",
+		"\t??:0 +0x1",
+		"\t<autogenerated>:1",
+		"\t.go:1",
+		"  .go:1",
+		" .go:1",
+		"\t\t.go:1",
+		"\t a.go:1",
+		"/foo/bar/baz.go:1",
+	}
+	for _, l := range strings.Split(string(internaltest.StaticPanicwebOutput()), "\n") {
+		lines = append(lines, strings.TrimSuffix(l, "\r"))
+	}
+	str := func(b []byte) string {
+		if b == nil {
+			return "<nil>"
+		}
+		return string(b)
+	}
+	for _, l := range lines {
+		line := []byte(l)
+		want := ""
+		if m := reRoutineHeader.FindSubmatch(line); m != nil {
+			want = fmt.Sprintf("%q %q %q %q", m[1], m[2], m[3], m[4])
+		}
+		got := ""
+		if indent, id, info, state, ok := matchRoutineHeader(line); ok {
+			got = fmt.Sprintf("%q %q %q %q", indent, id, info, state)
+		}
+		if want != got {
+			t.Errorf("matchRoutineHeader(%q): want %s, got %s", l, want, got)
+		}
+
+		if w, g := reUnavail.Match(line), matchUnavail(line); w != g {
+			t.Errorf("matchUnavail(%q): want %t, got %t", l, w, g)
+		}
+
+		want = ""
+		if m := reCreated.FindSubmatch(line); m != nil {
+			want = string(m[1])
+		}
+		got = ""
+		if name, ok := matchCreated(line); ok {
+			got = string(name)
+		}
+		if want != got {
+			t.Errorf("matchCreated(%q): want %q, got %q", l, want, got)
+		}
+
+		want = ""
+		if m := reFunc.FindSubmatch(line); m != nil {
+			want = fmt.Sprintf("%q %q", m[1], m[2])
+		}
+		got = ""
+		if name, args, ok := matchFunc(line); ok {
+			got = fmt.Sprintf("%q %q", name, args)
+		}
+		if want != got {
+			t.Errorf("matchFunc(%q): want %s, got %s", l, want, got)
+		}
+
+		want = ""
+		if m := reGccgoFunc.FindSubmatch(line); m != nil {
+			want = string(m[1])
+		}
+		got = ""
+		if name, ok := matchGccgoFunc(line); ok {
+			got = string(name)
+		}
+		if want != got {
+			t.Errorf("matchGccgoFunc(%q): want %q, got %q", l, want, got)
+		}
+
+		want = ""
+		if m := reFile.FindSubmatch(line); m != nil {
+			want = fmt.Sprintf("%q %q %q %q", m[1], m[2], str(m[3]), str(m[4]))
+		}
+		got = ""
+		if src, num, offset, pc, ok := matchFile(line); ok {
+			got = fmt.Sprintf("%q %q %q %q", src, num, str(offset), str(pc))
+		}
+		if want != got {
+			t.Errorf("matchFile(%q): want %s, got %s", l, want, got)
+		}
+	}
+}
+
+func TestDemangleGccgo(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in, want string
+	}{
+		{"main.main", "main.main"},
+		{"main.main..func1", "main.main.func1"},
+		{"net..z2fhttp.Get", "net/http.Get"},
+		{"gopkg.in..z2fyaml..z2ev2.Unmarshal", "gopkg.in/yaml.v2.Unmarshal"},
+		{"main.caf..u00e9", "main.café"},
+		{"main.f..U0001f600", "main.f\U0001f600"},
+		{"main..thunk0", "main.thunk0"},
+		// Invalid encodings are kept as is.
+		{"main.f..zzz", "main.f.zzz"},
+		{"main.f..", "main.f.."},
+	}
+	for i, line := range data {
+		if got := string(demangleGccgo([]byte(line.in))); got != line.want {
+			t.Errorf("#%d: demangleGccgo(%q) = %q, want %q", i, line.in, got, line.want)
+		}
+	}
+}
+
+func TestInterner(t *testing.T) {
+	t.Parallel()
+	in := interner{}
+	in.str([]byte("/gopath/src/foo/main.go"))
+	if a := in.str([]byte("/gopath/src/foo/main.go")); a != "/gopath/src/foo/main.go" || len(in.strs) != 1 {
+		t.Fatalf("unexpected %q %v", a, in.strs)
+	}
+	f, err := in.fn([]byte("main.main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Complete != "main.main" || !f.IsPkgMain {
+		t.Fatalf("unexpected %#v", f)
+	}
+	if _, err := in.fn([]byte("a/b")); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(in.funcs) != 1 {
+		t.Fatalf("unexpected %v", in.funcs)
+	}
+}
+
+func BenchmarkParseFunc(b *testing.B) {
+	b.ReportAllocs()
+	line := []byte("github.com/maruel/panicparse/v2/cmd/panicweb/internal.(*Handler).URL1Handler(0xc0000a4000, 0x7f2e1c, 0x3, ...)")
+	in := interner{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := Call{}
+		if found, err := parseFunc(&c, line, &in); !found || err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseFile(b *testing.B) {
+	b.ReportAllocs()
+	line := []byte("\t/home/user/go/src/github.com/maruel/panicparse/cmd/panicweb/internal/internal.go:116 +0x35")
+	in := interner{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := Call{}
+		if found, err := parseFile(&c, line, &in); !found || err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkScanSnapshot_Large measures a dump with a large number of similar
+// goroutines, like a server leaking goroutines.
+func BenchmarkScanSnapshot_Large(b *testing.B) {
+	b.ReportAllocs()
+	buf := bytes.Buffer{}
+	buf.WriteString("panic: oh no\n\ngoroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:8 +0x25\n")
+	for i := 2; i < 10000; i++ {
+		fmt.Fprintf(&buf, "\ngoroutine %d [chan receive, %d minutes]:\n", i, i%7)
+		buf.WriteString("github.com/foo/bar/internal.(*Handler).recv(0xc0000a4000, 0x7f2e1c)\n")
+		buf.WriteString("\t/gopath/src/github.com/foo/bar/internal/handler.go:42 +0x3c\n")
+		buf.WriteString("github.com/foo/bar/internal.(*Handler).loop(0xc0000a4000)\n")
+		buf.WriteString("\t/gopath/src/github.com/foo/bar/internal/handler.go:21 +0x1a5\n")
+		buf.WriteString("created by github.com/foo/bar/internal.New\n")
+		buf.WriteString("\t/gopath/src/github.com/foo/bar/internal/handler.go:12 +0x7d\n")
+	}
+	data := buf.Bytes()
+	opts := &Opts{}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, _, err := ScanSnapshot(bytes.NewReader(data), ioutil.Discard, opts)
+		if err != io.EOF {
+			b.Fatal(err)
+		}
+		if s == nil || len(s.Goroutines) != 9999 {
+			b.Fatal("unexpected snapshot")
+		}
+	}
+}
+
 func BenchmarkScanSnapshot_Guess(b *testing.B) {
 	b.ReportAllocs()
 	data := internaltest.StaticPanicwebOutput()
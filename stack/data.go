@@ -6,7 +6,7 @@ import (
 	"html/template"
 )
 
-const indexHTML = "<!DOCTYPE html>\n{{- /* Join a list */ -}}\n{{- define \"Join\" -}}\n{{- if . -}}\n{{- $l := len . -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := . -}}\n{{- $e -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if $isNotLast}}, {{end -}}\n{{- end -}}\n{{- end -}}\n{{- end -}}\n{{- /* Accepts a Args */ -}}\n{{- define \"RenderArgs\" -}}\n<span class=\"args\"><span>\n{{- $elided := .Elided -}}\n{{- if .Processed -}}\n{{- $l := len .Processed -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := .Processed -}}\n{{- $e -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if or $elided $isNotLast}}, {{end -}}\n{{- end -}}\n{{- else -}}\n{{- $l := len .Values -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := .Values -}}\n{{- $e.String -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if or $elided $isNotLast}}, {{end -}}\n{{- end -}}\n{{- end -}}\n{{- if $elided}}…{{end -}}\n</span></span>\n{{- end -}}\n{{- /* Accepts a Call */ -}}\n{{- define \"RenderCreatedBy\" -}}\n<span class=\"call hastooltip\"><span class=\"tooltip\">\n{{- if and .LocalSrcPath (ne .RemoteSrcPath .LocalSrcPath) -}}\nRemoteSrcPath: {{.RemoteSrcPath}}\n<br>LocalSrcPath: {{.LocalSrcPath}}\n{{- else -}}\nSrcPath: {{.RemoteSrcPath}}\n{{- end -}}\n<br>Func: {{.Func.Complete}}\n<br>Location: {{.Location}}\n</span><a href=\"{{srcURL .}}\">{{.SrcName}}:{{.Line}}</a> <span class=\"{{funcClass .}}\">\n<a href=\"{{pkgURL .}}\">{{.Func.DirName}}.{{.Func.Name}}</a></span>()\n</span>\n{{- end -}}\n{{- /* Accepts a Stack */ -}}\n{{- define \"RenderCalls\" -}}\n<table class=\"stack\">\n{{- range $i, $e := .Calls -}}\n<tr>\n<td>{{$i}}</td>\n<td>\n<a href=\"{{pkgURL $e}}\">{{$e.Func.DirName}}</a>\n</td>\n<td class=\"hastooltip\">\n<span class=\"tooltip\">\n{{- if and $e.LocalSrcPath (ne $e.RemoteSrcPath $e.LocalSrcPath) -}}\nRemoteSrcPath: {{$e.RemoteSrcPath}}\n<br>LocalSrcPath: {{$e.LocalSrcPath}}\n{{- else -}}\nSrcPath: {{$e.RemoteSrcPath}}\n{{- end -}}\n<br>Func: {{$e.Func.Complete}}\n<br>Location: {{$e.Location}}\n</span>\n<a href=\"{{srcURL $e}}\">{{$e.SrcName}}:{{$e.Line}}</a>\n</td>\n<td>\n<span class=\"{{funcClass $e}}\"><a href=\"{{pkgURL $e}}\">{{$e.Func.Name}}</a></span>({{template \"RenderArgs\" $e.Args}})\n</td>\n</tr>\n{{- end -}}\n{{- if .Elided}}<tr><td>(…)</td><tr>{{end -}}\n</table>\n{{- end -}}\n<meta charset=\"UTF-8\">\n<meta name=\"author\" content=\"Marc-Antoine Ruel\" >\n<meta name=\"generator\" content=\"https://github.com/maruel/panicparse\" >\n<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n<title>PanicParse</title>\n<link rel=\"shortcut icon\" type=\"image/gif\" href=\"data:image/gif;base64,{{.Favicon}}\"/>\n<style>\n{{- /* Minimal CSS reset */ -}}\n* {\nfont-family: inherit;\nfont-size: 1em;\nmargin: 0;\npadding: 0;\n}\nhtml {\nbox-sizing: border-box;\nfont-size: 62.5%;\n}\n*, *:before, *:after {\nbox-sizing: inherit;\n}\nh1, h2 {\nmargin-bottom: 0.2em;\nmargin-top: 0.8em;\n}\nh1 {\nfont-size: 1.4em;\n}\nh2 {\nfont-size: 1.2em;\n}\nbody {\nfont-size: 1.6em;\nmargin: 2px;\n}\nli {\nmargin-left: 2.5em;\n}\na {\ncolor: inherit;\ntext-decoration: inherit;\n}\nol, ul {\nmargin-bottom: 0.5em;\nmargin-top: 0.5em;\n}\np {\nmargin-bottom: 2em;\n}\ntable {\nmargin: 0.6em;\n}\ntable tr:nth-child(odd) {\nbackground-color: #F0F0F0;\n}\ntable tr:hover {\nbackground-color: #DDD !important;\n}\ntable td {\nfont-family: monospace;\npadding: 0.2em 0.4em 0.2em;\n}\n.call {\nfont-family: monospace;\n}\n@media screen and (max-width: 500px) {\nh1 {\nfont-size: 1.3em;\n}\n}\n@media screen and (max-width: 500px) and (orientation: portrait) {\n.args span {\ndisplay: none;\n}\n.args::after {\ncontent: '…';\n}\n}\n.created {\nwhite-space: nowrap;\n}\n.race {\nfont-weight: 700;\ncolor: #600;\n}\n#content {\nwidth: 100%;\n}\n.hastooltip:hover .tooltip {\nbackground: #fffAF0;\nborder: 1px solid #DCA;\nborder-radius: 6px;\nbox-shadow: 5px 5px 8px #CCC;\ncolor: #111;\ndisplay: inline;\nposition: absolute;\n}\n.tooltip {\ndisplay: none;\nline-height: 16px;\nmargin-left: 1rem;\nmargin-top: 2.5rem;\npadding: 1rem;\nz-index: 10;\n}\n.bottom-padding {\nmargin-top: 5em;\n}\n{{- /* Highlights based on stack.Location value. */ -}}\n.FuncMain {\ncolor: #880;\n}\n.FuncLocationUnknown {\ncolor: #888;\n}\n.FuncGoMod {\ncolor: #800;\n}\n.FuncGOPATH {\ncolor: #109090;\n}\n.FuncGoPkg {\ncolor: #008;\n}\n.FuncStdlib {\ncolor: #080;\n}\n.Exported {\nfont-weight: 700;\n}\n</style>\n<div id=\"content\">\n{{- if .Aggregated -}}\n{{- range $i, $e := .Aggregated.Buckets -}}\n{{$l := len $e.IDs}}\n<h1>Signature #{{$i}}: {{$l}} routine{{if ne 1 $l}}s{{end}}: <span class=\"state\">{{$e.State}}</span>\n{{- if $e.SleepMax -}}\n{{- if ne $e.SleepMin $e.SleepMax}} <span class=\"sleep\">[{{$e.SleepMin}}~{{$e.SleepMax}} mins]</span>\n{{- else}} <span class=\"sleep\">[{{$e.SleepMax}} mins]</span>\n{{- end -}}\n{{- end -}}\n</h1>\n{{if $e.Locked}} <span class=\"locked\">[locked]</span>\n{{- end -}}\n{{- if $e.CreatedBy.Calls}} <span class=\"created\">Created by: {{template \"RenderCreatedBy\" index $e.CreatedBy.Calls 0}}</span>\n{{- end -}}\n{{template \"RenderCalls\" $e.Signature.Stack}}\n{{- end -}}\n{{- else -}}\n{{- range $i, $e := .Snapshot.Goroutines -}}\n<h1>Routine {{$e.ID}}: <span class=\"state\">{{$e.State}}</span>\n{{- if $e.SleepMax -}}\n{{- if ne $e.SleepMin $e.SleepMax}} <span class=\"sleep\">[{{$e.SleepMin}}~{{$e.SleepMax}} mins]</span>\n{{- else}} <span class=\"sleep\">[{{$e.SleepMax}} mins]</span>\n{{- end -}}\n{{- end -}}\n</h1>\n{{if $e.Locked}} <span class=\"locked\">[locked]</span>\n{{- end -}}\n{{if $e.RaceAddr}} <span class=\"race\">Race {{if $e.RaceWrite}}write{{else}}read{{end}} @ {{printf \"0x%08X\" $e.RaceAddr}}</span><br>\n{{- end -}}\n{{- if $e.CreatedBy.Calls}} <span class=\"created\">Created by: {{template \"RenderCreatedBy\" index $e.CreatedBy.Calls 0}}</span>\n{{- end -}}\n{{template \"RenderCalls\" $e.Signature.Stack}}\n{{- end -}}\n{{- end -}}\n</div>\n<h2>Metadata</h2>\n<ul>\n<li>Created on {{.Now.String}}</li>\n<li>{{.Version}}</li>\n{{- if and .Snapshot.LocalGOROOT (ne .Snapshot.RemoteGOROOT .Snapshot.LocalGOROOT) -}}\n<li>GOROOT (remote): {{.Snapshot.RemoteGOROOT}}</li>\n<li>GOROOT (local): {{.Snapshot.LocalGOROOT}}</li>\n{{- else -}}\n<li>GOROOT: {{.Snapshot.RemoteGOROOT}}</li>\n{{- end -}}\n<li>GOPATH: {{template \"Join\" .Snapshot.LocalGOPATHs}}</li>\n{{- if .Snapshot.LocalGomods -}}\n<li>go modules (local):\n<ul>\n{{- range $path, $import := .Snapshot.LocalGomods -}}\n<li>{{$path}}: {{$import}}</li>\n{{- end -}}\n</ul>\n</li>\n{{- end -}}\n<li>GOMAXPROCS: {{.GOMAXPROCS}}</li>\n</ul>\n<h2>Legend</h2>\n<table class=\"legend\">\n<thead>\n<th>Type</th>\n<th>Exported</th>\n<th>Private</th>\n</thead>\n<tr class=\"call hastooltip\">\n<td>\nPackage main\n<span class=\"tooltip\">Sources that are in the main package.</span>\n</td>\n<td class=\"FuncMain\">main.Foo()</td>\n<td class=\"FuncMain\">main.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\nGo module\n<span class=\"tooltip\">Sources located inside a directory containing a\n<strong>go.mod</strong> file but outside $GOPATH.</span>\n</td>\n<td class=\"FuncGoMod Exported\">pkg.Foo()</td>\n<td class=\"FuncGoMod\">pkg.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\n$GOPATH/src/...\n<span class=\"tooltip\">Sources located inside the traditional $GOPATH/src\ndirectory.</span>\n</td>\n<td class=\"FuncGOPATH Exported\">pkg.Foo()</td>\n<td class=\"FuncGOPATH\">pkg.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\n$GOPATH/pkg/mod/...\n<span class=\"tooltip\">Sources located inside the go module dependency\ncache under $GOPATH/pkg/mod. These files are unmodified third parties.</span>\n</td>\n<td class=\"FuncGoPkg Exported\">pkg.Foo()</td>\n<td class=\"FuncGoPkg\">pkg.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\nStandard library\n<span class=\"tooltip\">Sources from the Go standard library under\n$GOROOT/src/.</span>\n</td>\n<td class=\"FuncStdlib Exported\">pkg.Foo()</td>\n<td class=\"FuncStdlib\">pkg.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\nUnknown source location\n<span class=\"tooltip\">Sources which location was not successfully\ndetermined.</span>\n</td>\n<td class=\"FuncLocationUnknown Exported\">pkg.Foo()</td>\n<td class=\"FuncLocationUnknown\">pkg.foo()</td>\n</tr>\n</table>\n{{- .Footer -}}\n{{- /* Add unnecessary bottom spacing so the last tooltip from the legend is visible. */ -}}\n<div class=\"bottom-padding\"></div>\n"
+const indexHTML = "<!DOCTYPE html>\n{{- /* Join a list */ -}}\n{{- define \"Join\" -}}\n{{- if . -}}\n{{- $l := len . -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := . -}}\n{{- $e -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if $isNotLast}}, {{end -}}\n{{- end -}}\n{{- end -}}\n{{- end -}}\n{{- /* Accepts a Args */ -}}\n{{- define \"RenderArgs\" -}}\n<span class=\"args\"><span>\n{{- $elided := .Elided -}}\n{{- if .Processed -}}\n{{- $l := len .Processed -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := .Processed -}}\n{{- $e -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if or $elided $isNotLast}}, {{end -}}\n{{- end -}}\n{{- else -}}\n{{- $l := len .Values -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := .Values -}}\n{{- $e.String -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if or $elided $isNotLast}}, {{end -}}\n{{- end -}}\n{{- end -}}\n{{- if $elided}}…{{end -}}\n</span></span>\n{{- end -}}\n{{- /* Accepts a Call */ -}}\n{{- define \"RenderCreatedBy\" -}}\n<span class=\"call hastooltip\"><span class=\"tooltip\">\n{{- if and .LocalSrcPath (ne .RemoteSrcPath .LocalSrcPath) -}}\nRemoteSrcPath: {{.RemoteSrcPath}}\n<br>LocalSrcPath: {{.LocalSrcPath}}\n{{- else -}}\nSrcPath: {{.RemoteSrcPath}}\n{{- end -}}\n<br>Func: {{.Func.Complete}}\n<br>Location: {{.Location}}\n</span><a href=\"{{srcURL .}}\">{{.SrcName}}:{{.Line}}</a> <span class=\"{{funcClass .}}\">\n<a href=\"{{pkgURL .}}\">{{.Func.DirName}}.{{.Func.Name}}</a></span>()\n</span>\n{{- end -}}\n{{- /* Accepts a Stack */ -}}\n{{- define \"ImportPaths\" -}}\n{{- range .Calls}}{{.ImportPath}} {{end -}}\n{{- end -}}\n{{- /* Accepts a Stack */ -}}\n{{- define \"RenderCalls\" -}}\n<table class=\"stack\">\n{{- range $c := .Compact -}}\n{{- if gt $c.Count 1}}\n<tr class=\"cycle\"><td colspan=\"4\">Recursion: {{$c.String}}</td></tr>\n{{- end -}}\n{{- range $j, $e := $c.Calls -}}\n<tr{{if eq $e.Location.String \"Stdlib\"}} class=\"stdlib{{if gt $c.Count 1}} cycle{{end}}\"{{else if gt $c.Count 1}} class=\"cycle\"{{end}}>\n<td>{{add $c.Start $j}}</td>\n<td>\n<a href=\"{{pkgURL $e}}\">{{$e.Func.DirName}}</a>\n</td>\n<td class=\"hastooltip\">\n<span class=\"tooltip\">\n{{- if and $e.LocalSrcPath (ne $e.RemoteSrcPath $e.LocalSrcPath) -}}\nRemoteSrcPath: {{$e.RemoteSrcPath}}\n<br>LocalSrcPath: {{$e.LocalSrcPath}}\n{{- else -}}\nSrcPath: {{$e.RemoteSrcPath}}\n{{- end -}}\n<br>Func: {{$e.Func.Complete}}\n<br>Location: {{$e.Location}}\n</span>\n<a href=\"{{srcURL $e}}\">{{$e.SrcName}}:{{$e.Line}}</a>\n</td>\n<td>\n<span class=\"{{funcClass $e}}\"><a href=\"{{pkgURL $e}}\">{{$e.Func.Name}}</a></span>({{template \"RenderArgs\" $e.Args}})\n</td>\n</tr>\n{{- end -}}\n{{- end -}}\n{{- if .Elided}}<tr><td>(…)</td><tr>{{end -}}\n</table>\n{{- end -}}\n<meta charset=\"UTF-8\">\n<meta name=\"author\" content=\"Marc-Antoine Ruel\" >\n<meta name=\"generator\" content=\"https://github.com/maruel/panicparse\" >\n<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n<title>{{.Title}}</title>\n<link rel=\"shortcut icon\" type=\"image/gif\" href=\"data:image/gif;base64,{{.Favicon}}\"/>\n<style>\n{{- /* Minimal CSS reset */ -}}\n* {\nfont-family: inherit;\nfont-size: 1em;\nmargin: 0;\npadding: 0;\n}\nhtml {\nbox-sizing: border-box;\nfont-size: 62.5%;\n}\n*, *:before, *:after {\nbox-sizing: inherit;\n}\nh1, h2 {\nmargin-bottom: 0.2em;\nmargin-top: 0.8em;\n}\nh1 {\nfont-size: 1.4em;\n}\nh2 {\nfont-size: 1.2em;\n}\n{{- /* Colors, overridden in dark mode. */ -}}\n:root {\n--bg: #FFF;\n--fg: #000;\n--row-odd: #F0F0F0;\n--row-hover: #DDD;\n--tooltip-bg: #FFFAF0;\n--tooltip-border: #DCA;\n--tooltip-shadow: #CCC;\n--tooltip-fg: #111;\n--race: #600;\n--shared: #FFF3C4;\n--cycle: #E6EEFF;\n--main: #880;\n--unknown: #888;\n--gomod: #800;\n--gopath: #109090;\n--gopkg: #008;\n--stdlib: #080;\n}\nbody.dark {\n--bg: #1E1E1E;\n--fg: #DDD;\n--row-odd: #282828;\n--row-hover: #3A3A3A;\n--tooltip-bg: #2A2A20;\n--tooltip-border: #665;\n--tooltip-shadow: #000;\n--tooltip-fg: #EEE;\n--race: #F66;\n--shared: #4A4220;\n--cycle: #23304A;\n--main: #DD4;\n--unknown: #AAA;\n--gomod: #F66;\n--gopath: #4CC;\n--gopkg: #88F;\n--stdlib: #6C6;\n}\nbody {\nbackground-color: var(--bg);\ncolor: var(--fg);\nfont-size: 1.6em;\nmargin: 2px;\n}\nli {\nmargin-left: 2.5em;\n}\na {\ncolor: inherit;\ntext-decoration: inherit;\n}\nol, ul {\nmargin-bottom: 0.5em;\nmargin-top: 0.5em;\n}\np {\nmargin-bottom: 2em;\n}\ntable {\nmargin: 0.6em;\n}\ntable tr:nth-child(odd) {\nbackground-color: var(--row-odd);\n}\ntable tr:hover {\nbackground-color: var(--row-hover) !important;\n}\ntable td {\nfont-family: monospace;\npadding: 0.2em 0.4em 0.2em;\n}\n.call {\nfont-family: monospace;\n}\n@media screen and (max-width: 500px) {\nh1 {\nfont-size: 1.3em;\n}\n}\n@media screen and (max-width: 500px) and (orientation: portrait) {\n.args span {\ndisplay: none;\n}\n.args::after {\ncontent: '…';\n}\n}\n.created {\nwhite-space: nowrap;\n}\n.race {\nfont-weight: 700;\ncolor: var(--race);\n}\n#content {\nwidth: 100%;\n}\n.racepair > tbody > tr > td {\nfont-family: inherit;\nvertical-align: top;\n}\n.racepair > tbody > tr:nth-child(odd) {\nbackground-color: inherit;\n}\ntable tr.shared {\nbackground-color: var(--shared);\n}\ntable tr.cycle {\nbackground-color: var(--cycle);\n}\n.hastooltip:hover .tooltip {\nbackground: var(--tooltip-bg);\nborder: 1px solid var(--tooltip-border);\nborder-radius: 6px;\nbox-shadow: 5px 5px 8px var(--tooltip-shadow);\ncolor: var(--tooltip-fg);\ndisplay: inline;\nposition: absolute;\n}\n.tooltip {\ndisplay: none;\nline-height: 16px;\nmargin-left: 1rem;\nmargin-top: 2.5rem;\npadding: 1rem;\nz-index: 10;\n}\n.bottom-padding {\nmargin-top: 5em;\n}\n{{- /* Interactive features, only shown when JavaScript is enabled. */ -}}\n#toolbar {\nbackground-color: var(--bg);\nborder-bottom: 1px solid var(--row-hover);\ndisplay: none;\npadding: 0.4em;\nposition: sticky;\ntop: 0;\nz-index: 20;\n}\n.js #toolbar {\ndisplay: block;\n}\n#toolbar input, #toolbar select, #toolbar button {\nbackground-color: var(--bg);\nborder: 1px solid var(--unknown);\ncolor: var(--fg);\nmargin-right: 0.6em;\npadding: 0.1em 0.3em;\n}\n#toolbar input[type=number] {\nwidth: 4em;\n}\n.bucket h1 {\ncursor: pointer;\n}\n.js .bucket h1::before {\ncontent: '▾ ';\n}\n.js .bucket.collapsed h1::before {\ncontent: '▸ ';\n}\n.bucket.collapsed .details {\ndisplay: none;\n}\n.bucket.hidden, .hidestdlib tr.stdlib {\ndisplay: none;\n}\n.permalink {\nmargin-left: 0.4em;\nvisibility: hidden;\n}\n.bucket h1:hover .permalink {\nvisibility: visible;\n}\n.bucket:target h1 {\ntext-decoration: underline;\n}\n{{- /* Highlights based on stack.Location value. */ -}}\n.FuncMain {\ncolor: var(--main);\n}\n.FuncLocationUnknown {\ncolor: var(--unknown);\n}\n.FuncGoMod {\ncolor: var(--gomod);\n}\n.FuncGOPATH {\ncolor: var(--gopath);\n}\n.FuncGoPkg {\ncolor: var(--gopkg);\n}\n.FuncStdlib {\ncolor: var(--stdlib);\n}\n.Exported {\nfont-weight: 700;\n}\n{{- .CSS -}}\n</style>\n{{- .Header -}}\n<div id=\"toolbar\">\n<input id=\"search\" type=\"search\" placeholder=\"Search\" title=\"Full text search\">\n<select id=\"state\" title=\"Goroutine state\"><option value=\"\">All states</option></select>\n<input id=\"pkg\" type=\"search\" placeholder=\"Package\" title=\"Import path prefix of any call\">\n<input id=\"sleep\" type=\"number\" min=\"0\" placeholder=\"Mins\" title=\"Minimum sleep in minutes\">\n<button id=\"collapse\">Collapse all</button>\n<button id=\"expand\">Expand all</button>\n<label><input id=\"hidestdlib\" type=\"checkbox\">Hide stdlib</label>\n<label><input id=\"dark\" type=\"checkbox\">Dark mode</label>\n<span id=\"count\"></span>\n</div>\n<div id=\"content\">\n{{- if .Aggregated -}}\n{{- range $i, $e := .Aggregated.Buckets -}}\n{{$l := len $e.IDs}}\n<div class=\"bucket\" id=\"b{{$i}}\" data-state=\"{{$e.State}}\" data-sleep=\"{{$e.SleepMax}}\" data-pkgs=\"{{template \"ImportPaths\" $e.Signature.Stack}}\"\n{{- if $e.Input.FirstLine}} data-line=\"{{$e.Input.FirstLine}}\" data-offset=\"{{$e.Input.Offset}}\"{{end}}>\n<h1>Signature #{{$i}}: {{$l}} routine{{if ne 1 $l}}s{{end}}: <span class=\"state\">{{$e.State}}</span>\n{{- if $e.SleepMax -}}\n{{- if ne $e.SleepMin $e.SleepMax}} <span class=\"sleep\">[{{$e.SleepMin}}~{{$e.SleepMax}} mins]</span>\n{{- else}} <span class=\"sleep\">[{{$e.SleepMax}} mins]</span>\n{{- end -}}\n{{- end -}}\n<a class=\"permalink\" href=\"#b{{$i}}\" title=\"Permalink\">#</a></h1>\n<div class=\"details\">\n{{if $e.Locked}} <span class=\"locked\">[locked]</span>\n{{- end -}}\n{{- if $e.CreatedBy.Calls}} <span class=\"created\">Created by: {{template \"RenderCreatedBy\" index $e.CreatedBy.Calls 0}}</span>\n{{- end -}}\n{{template \"RenderCalls\" $e.Signature.Stack}}\n</div>\n</div>\n{{- end -}}\n{{- else if .Races -}}\n{{- range $i, $r := .Races.Buckets -}}\n<div class=\"bucket\" id=\"race{{if $i}}{{$i}}{{end}}\" data-state=\"{{$r.Current.State}}\" data-sleep=\"0\" data-pkgs=\"{{range $r.Accesses}}{{template \"ImportPaths\" .Stack}}{{end}}\">\n<h1>Data race @ <span class=\"race\">{{printf \"0x%08X\" $r.Current.RaceAddr}}</span>\n{{- if gt $r.Count 1}} <span class=\"count\">[{{$r.Count}} occurrences]</span>{{end}}\n<a class=\"permalink\" href=\"#race{{if $i}}{{$i}}{{end}}\" title=\"Permalink\">#</a></h1>\n<div class=\"details\">\n<table class=\"racepair\">\n<tr>\n{{- range $i, $e := $r.Accesses -}}\n<td>\n<h2 class=\"race\">\n{{- if $i}}Previous {{if $e.RaceWrite}}write{{else}}read{{end}}\n{{- else}}{{if $e.RaceWrite}}Write{{else}}Read{{end}}{{end}} by goroutine {{$e.ID}}</h2>\n<table class=\"stack\">\n{{- range $j, $c := $e.Stack.Calls -}}\n<tr class=\"{{if $r.Shared $c}}shared{{end}}{{if eq $c.Location.String \"Stdlib\"}} stdlib{{end}}\">\n<td>{{$j}}</td>\n<td><a href=\"{{pkgURL $c}}\">{{$c.Func.DirName}}</a></td>\n<td><a href=\"{{srcURL $c}}\">{{$c.SrcName}}:{{$c.Line}}</a></td>\n<td><span class=\"{{funcClass $c}}\"><a href=\"{{pkgURL $c}}\">{{$c.Func.Name}}</a></span>({{template \"RenderArgs\" $c.Args}})</td>\n</tr>\n{{- end -}}\n</table>\n</td>\n{{- end -}}\n</tr>\n</table>\n{{- with $r.Location -}}\n{{- if .Global -}}\n{{- with index .Stack.Calls 0 -}}\n<h2>Global variable {{$r.Location.Global}} of size {{$r.Location.Size}} at {{printf \"0x%08X\" $r.Location.Addr}} declared at <a href=\"{{srcURL .}}\">{{.SrcName}}:{{.Line}}</a></h2>\n{{- end -}}\n{{- else -}}\n<h2>Heap block of size {{.Size}} at {{printf \"0x%08X\" .Addr}} allocated by goroutine {{.AllocatedBy}}</h2>\n{{template \"RenderCalls\" .Stack}}\n{{- end -}}\n{{- end -}}\n{{- range $r.Accesses -}}\n{{- if .CreatedBy.Calls -}}\n<h2>Goroutine {{.ID}} ({{.State}}) created at</h2>\n{{template \"RenderCalls\" .CreatedBy}}\n{{- end -}}\n{{- end -}}\n</div>\n</div>\n{{- end -}}\n{{- else -}}\n{{- range $i, $e := .Snapshot.Goroutines -}}\n<div class=\"bucket\" id=\"g{{$e.ID}}\" data-state=\"{{$e.State}}\" data-sleep=\"{{$e.SleepMax}}\" data-pkgs=\"{{template \"ImportPaths\" $e.Signature.Stack}}\"\n{{- if $e.Input.FirstLine}} data-line=\"{{$e.Input.FirstLine}}\" data-offset=\"{{$e.Input.Offset}}\"{{end}}>\n<h1>Routine {{$e.ID}}: <span class=\"state\">{{$e.State}}</span>\n{{- if $e.SleepMax -}}\n{{- if ne $e.SleepMin $e.SleepMax}} <span class=\"sleep\">[{{$e.SleepMin}}~{{$e.SleepMax}} mins]</span>\n{{- else}} <span class=\"sleep\">[{{$e.SleepMax}} mins]</span>\n{{- end -}}\n{{- end -}}\n<a class=\"permalink\" href=\"#g{{$e.ID}}\" title=\"Permalink\">#</a></h1>\n<div class=\"details\">\n{{if $e.Locked}} <span class=\"locked\">[locked]</span>\n{{- end -}}\n{{if $e.RaceAddr}} <span class=\"race\">Race {{if $e.RaceWrite}}write{{else}}read{{end}} @ {{printf \"0x%08X\" $e.RaceAddr}}</span><br>\n{{- end -}}\n{{- if $e.CreatedBy.Calls}} <span class=\"created\">Created by: {{template \"RenderCreatedBy\" index $e.CreatedBy.Calls 0}}</span>\n{{- end -}}\n{{template \"RenderCalls\" $e.Signature.Stack}}\n</div>\n</div>\n{{- end -}}\n{{- end -}}\n</div>\n<h2>Metadata</h2>\n<ul>\n<li>Created on {{.Now.String}}</li>\n<li>{{.Version}}</li>\n{{- if .Snapshot.RemoteGoVersion -}}\n<li>Go version (remote): {{.Snapshot.RemoteGoVersion}}</li>\n{{- else if .Snapshot.RemoteGoMinVersion -}}\n<li>Go version (remote): {{.Snapshot.RemoteGoMinVersion}} or later</li>\n{{- end -}}\n{{- if and .Snapshot.LocalGOROOT (ne .Snapshot.RemoteGOROOT .Snapshot.LocalGOROOT) -}}\n<li>GOROOT (remote): {{.Snapshot.RemoteGOROOT}}</li>\n<li>GOROOT (local): {{.Snapshot.LocalGOROOT}}</li>\n{{- else -}}\n<li>GOROOT: {{.Snapshot.RemoteGOROOT}}</li>\n{{- end -}}\n<li>GOPATH: {{template \"Join\" .Snapshot.LocalGOPATHs}}</li>\n{{- if .Snapshot.LocalGomods -}}\n<li>go modules (local):\n<ul>\n{{- range $path, $import := .Snapshot.LocalGomods -}}\n<li>{{$path}}: {{$import}}</li>\n{{- end -}}\n</ul>\n</li>\n{{- end -}}\n{{- with .Snapshot.BuildInfo -}}\n<li>Executable: {{.Path}}\n<ul>\n<li>Built with: {{.GoVersion}}</li>\n<li>Main module: {{.Main.Path}} {{.Main.Version}}</li>\n{{- if .VCSRevision -}}\n<li>Revision: {{.VCSRevision}}{{if .VCSModified}} (modified){{end}}{{if .VCSTime}} ({{.VCSTime}}){{end}}</li>\n{{- end -}}\n</ul>\n</li>\n{{- end -}}\n<li>GOMAXPROCS: {{.GOMAXPROCS}}</li>\n</ul>\n<h2>Legend</h2>\n<table class=\"legend\">\n<thead>\n<th>Type</th>\n<th>Exported</th>\n<th>Private</th>\n</thead>\n<tr class=\"call hastooltip\">\n<td>\nPackage main\n<span class=\"tooltip\">Sources that are in the main package.</span>\n</td>\n<td class=\"FuncMain\">main.Foo()</td>\n<td class=\"FuncMain\">main.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\nGo module\n<span class=\"tooltip\">Sources located inside a directory containing a\n<strong>go.mod</strong> file but outside $GOPATH.</span>\n</td>\n<td class=\"FuncGoMod Exported\">pkg.Foo()</td>\n<td class=\"FuncGoMod\">pkg.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\n$GOPATH/src/...\n<span class=\"tooltip\">Sources located inside the traditional $GOPATH/src\ndirectory.</span>\n</td>\n<td class=\"FuncGOPATH Exported\">pkg.Foo()</td>\n<td class=\"FuncGOPATH\">pkg.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\n$GOPATH/pkg/mod/...\n<span class=\"tooltip\">Sources located inside the go module dependency\ncache under $GOPATH/pkg/mod. These files are unmodified third parties.</span>\n</td>\n<td class=\"FuncGoPkg Exported\">pkg.Foo()</td>\n<td class=\"FuncGoPkg\">pkg.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\nStandard library\n<span class=\"tooltip\">Sources from the Go standard library under\n$GOROOT/src/.</span>\n</td>\n<td class=\"FuncStdlib Exported\">pkg.Foo()</td>\n<td class=\"FuncStdlib\">pkg.foo()</td>\n</tr>\n<tr class=\"call hastooltip\">\n<td>\nUnknown source location\n<span class=\"tooltip\">Sources which location was not successfully\ndetermined.</span>\n</td>\n<td class=\"FuncLocationUnknown Exported\">pkg.Foo()</td>\n<td class=\"FuncLocationUnknown\">pkg.foo()</td>\n</tr>\n</table>\n{{- .Footer -}}\n{{- /* Add unnecessary bottom spacing so the last tooltip from the legend is visible. */ -}}\n<div class=\"bottom-padding\"></div>\n{{- /* Everything is embedded so the file can be used offline. */ -}}\n<script>\n\"use strict\";\n(function() {\nvar $ = function(id) { return document.getElementById(id); };\nvar buckets = Array.prototype.slice.call(document.querySelectorAll(\".bucket\"));\nvar texts = buckets.map(function(b) { return b.textContent.toLowerCase(); });\nvar store = function(k, v) {\ntry { localStorage.setItem(\"panicparse.\" + k, v); } catch (e) {}\n};\nvar load = function(k) {\ntry { return localStorage.getItem(\"panicparse.\" + k); } catch (e) { return null; }\n};\ndocument.body.classList.add(\"js\");\n// Populate the states.\nvar states = {};\nbuckets.forEach(function(b) { states[b.dataset.state] = true; });\nObject.keys(states).sort().forEach(function(s) {\nvar o = document.createElement(\"option\");\no.value = o.textContent = s;\n$(\"state\").appendChild(o);\n});\nvar filter = function() {\nvar q = $(\"search\").value.toLowerCase();\nvar state = $(\"state\").value;\nvar pkg = $(\"pkg\").value;\nvar sleep = parseInt($(\"sleep\").value, 10) || 0;\nvar shown = 0;\nbuckets.forEach(function(b, i) {\nvar ok = (!q || texts[i].indexOf(q) !== -1) &&\n(!state || b.dataset.state === state) &&\n(!pkg || (\" \" + b.dataset.pkgs).indexOf(\" \" + pkg) !== -1) &&\nparseInt(b.dataset.sleep, 10) >= sleep;\nb.classList.toggle(\"hidden\", !ok);\nif (ok) {\nshown++;\n}\n});\n$(\"count\").textContent = shown + \" / \" + buckets.length;\n};\n[\"search\", \"state\", \"pkg\", \"sleep\"].forEach(function(id) {\n$(id).addEventListener(\"input\", filter);\n});\nfilter();\nvar collapseAll = function(c) {\nbuckets.forEach(function(b) { b.classList.toggle(\"collapsed\", c); });\n};\n$(\"collapse\").addEventListener(\"click\", function() { collapseAll(true); });\n$(\"expand\").addEventListener(\"click\", function() { collapseAll(false); });\nbuckets.forEach(function(b) {\nb.querySelector(\"h1\").addEventListener(\"click\", function(e) {\nif (e.target.tagName !== \"A\") {\nb.classList.toggle(\"collapsed\");\n}\n});\n});\nvar toggle = function(id, cls) {\nvar apply = function() {\ndocument.body.classList.toggle(cls, $(id).checked);\n};\n$(id).addEventListener(\"change\", function() {\napply();\nstore(id, $(id).checked ? \"1\" : \"0\");\n});\napply();\n};\nvar dark = load(\"dark\");\n$(\"dark\").checked = dark === null ? window.matchMedia(\"(prefers-color-scheme: dark)\").matches : dark === \"1\";\n$(\"hidestdlib\").checked = load(\"hidestdlib\") === \"1\";\ntoggle(\"dark\", \"dark\");\ntoggle(\"hidestdlib\", \"hidestdlib\");\n// Permalinks: make sure the target is visible.\nvar reveal = function() {\nvar b = location.hash && document.getElementById(location.hash.substr(1));\nif (b && b.classList.contains(\"bucket\")) {\nb.classList.remove(\"collapsed\", \"hidden\");\nb.scrollIntoView();\n}\n};\nwindow.addEventListener(\"hashchange\", reveal);\nreveal();\n})();\n</script>\n"
 
 // favicon is the bomb emoji U+1F4A3 in Noto Emoji as a 128x128 base64 encoded
 // PNG.
@@ -0,0 +1,73 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"strconv"
+)
+
+// DiagnosticKind is the kind of issue found while processing a snapshot.
+type DiagnosticKind int
+
+const (
+	// UnparsedLine is a line that could not be parsed. The snapshot ends
+	// there.
+	UnparsedLine DiagnosticKind = iota
+	// Truncated is a stack trace that is incomplete: the runtime elided
+	// frames, the input ended in the middle of a goroutine or the buffer used
+	// to capture the snapshot was too small. The elided frames are only
+	// reported for the first goroutine of a snapshot; Stack.Elided is set for
+	// all of them.
+	Truncated
+	// UnresolvedPath is a source path that could not be mapped to a local
+	// file with Opts.GuessPaths.
+	UnresolvedPath
+	// AugmentFailed is a goroutine for which the sources could not be
+	// analyzed with Opts.AnalyzeSources.
+	AugmentFailed
+	// SymbolizeFailed is an executable passed with Opts.Binary that could not
+	// be used to resolve the source location of the calls.
+	SymbolizeFailed
+)
+
+// Diagnostic is an issue found while processing a snapshot.
+//
+// The issues are not fatal; the snapshot is still returned but may be
+// incomplete or less precise.
+type Diagnostic struct {
+	// Kind is the kind of issue.
+	Kind DiagnosticKind
+	// Line is the line number in the input, starting at 1. For UnresolvedPath
+	// and AugmentFailed, it is the line of the header of the goroutine. It is 0
+	// when unknown.
+	//
+	// With ScanSnapshot, it is relative to the start of the io.Reader passed
+	// to the call, shifted by Opts.InputLine.
+	Line int
+	// Text is the input line for UnparsedLine, the source path for
+	// UnresolvedPath or the executable path for SymbolizeFailed.
+	Text string
+	// Msg describes the issue.
+	Msg string
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// String returns a human readable representation of the diagnostic, e.g.
+// `line 12: UnparsedLine "foo": end of snapshot`.
+func (d *Diagnostic) String() string {
+	out := d.Kind.String()
+	if d.Line != 0 {
+		out = "line " + strconv.Itoa(d.Line) + ": " + out
+	}
+	if d.Text != "" {
+		out += " " + strconv.Quote(d.Text)
+	}
+	if d.Msg != "" {
+		out += ": " + d.Msg
+	}
+	return out
+}
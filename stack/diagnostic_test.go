@@ -0,0 +1,27 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+)
+
+func TestDiagnostic_String(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		d    Diagnostic
+		want string
+	}{
+		{Diagnostic{Kind: UnparsedLine, Line: 12, Text: "foo", Msg: "end of snapshot"}, `line 12: UnparsedLine "foo": end of snapshot`},
+		{Diagnostic{Kind: Truncated, Msg: "too large"}, "Truncated: too large"},
+		{Diagnostic{Kind: UnresolvedPath, Line: 1, Text: "/a/b.go"}, `line 1: UnresolvedPath "/a/b.go"`},
+		{Diagnostic{Kind: 42}, "DiagnosticKind(42)"},
+	}
+	for i, line := range data {
+		if got := line.d.String(); got != line.want {
+			t.Errorf("#%d: want %q, got %q", i, line.want, got)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package stack_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -144,6 +145,24 @@ func Example_stream() {
 	}
 }
 
+// Counts the goroutines per state of a dump larger than the available memory.
+func Example_scanner() {
+	s, err := stack.NewScanner(context.Background(), os.Stdin, ioutil.Discard, &stack.Opts{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	states := map[string]int{}
+	for s.Scan() {
+		states[s.Goroutine().State]++
+	}
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+	for state, count := range states {
+		fmt.Printf("%s: %d\n", state, count)
+	}
+}
+
 // Converts a stack trace from os.Stdin into HTML on os.Stdout, discarding
 // everything else.
 func Example_hTML() {
@@ -0,0 +1,14 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build go1.14
+
+package stack
+
+import "debug/dwarf"
+
+// lineFiles returns the file table of the line reader.
+func lineFiles(lr *dwarf.LineReader) []*dwarf.LineFile {
+	return lr.Files()
+}
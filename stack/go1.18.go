@@ -0,0 +1,49 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build go1.18
+
+package stack
+
+import (
+	"debug/buildinfo"
+	"runtime/debug"
+)
+
+// readBuildInfo reads the build information embedded in the executable p.
+func readBuildInfo(p string) (*BuildInfo, error) {
+	bi, err := buildinfo.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	out := &BuildInfo{
+		GoVersion: bi.GoVersion,
+		Path:      bi.Path,
+		Main:      toModule(&bi.Main),
+		Deps:      make([]Module, 0, len(bi.Deps)),
+	}
+	for _, d := range bi.Deps {
+		out.Deps = append(out.Deps, toModule(d))
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			out.VCSRevision = s.Value
+		case "vcs.time":
+			out.VCSTime = s.Value
+		case "vcs.modified":
+			out.VCSModified = s.Value == "true"
+		}
+	}
+	return out, nil
+}
+
+func toModule(m *debug.Module) Module {
+	out := Module{Path: m.Path, Version: m.Version, Sum: m.Sum}
+	if m.Replace != nil {
+		r := toModule(m.Replace)
+		out.Replace = &r
+	}
+	return out
+}
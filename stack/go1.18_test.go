@@ -0,0 +1,51 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build go1.18
+
+package stack
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestReadBuildInfo(t *testing.T) {
+	t.Parallel()
+	p, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := readBuildInfo(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, runtime.Version(), b.GoVersion)
+	if _, err := readBuildInfo("/nonexistent"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCachedBuildInfo(t *testing.T) {
+	t.Parallel()
+	p, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := cachedBuildInfo(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := cachedBuildInfo(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b1 != b2 {
+		t.Fatal("expected the build information to be read once")
+	}
+	if _, err := cachedBuildInfo("/nonexistent"); err == nil {
+		t.Fatal("expected error")
+	}
+}
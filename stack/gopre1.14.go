@@ -0,0 +1,18 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build go1.1
+// +build !go1.14
+
+package stack
+
+import "debug/dwarf"
+
+// lineFiles returns the file table of the line reader.
+//
+// It is not available before go1.14, so the source file of the inlined calls
+// is unknown.
+func lineFiles(lr *dwarf.LineReader) []*dwarf.LineFile {
+	return nil
+}
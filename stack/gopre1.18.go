@@ -0,0 +1,15 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build go1.1
+// +build !go1.18
+
+package stack
+
+import "errors"
+
+// readBuildInfo reads the build information embedded in the executable p.
+func readBuildInfo(p string) (*BuildInfo, error) {
+	return nil, errors.New("reading build information requires go1.18")
+}
@@ -54,12 +54,21 @@
   </span>
 {{- end -}}
 
+{{- /* Accepts a Stack */ -}}
+{{- define "ImportPaths" -}}
+  {{- range .Calls}}{{.ImportPath}} {{end -}}
+{{- end -}}
+
 {{- /* Accepts a Stack */ -}}
 {{- define "RenderCalls" -}}
   <table class="stack">
-    {{- range $i, $e := .Calls -}}
-      <tr>
-        <td>{{$i}}</td>
+    {{- range $c := .Compact -}}
+    {{- if gt $c.Count 1}}
+      <tr class="cycle"><td colspan="4">Recursion: {{$c.String}}</td></tr>
+    {{- end -}}
+    {{- range $j, $e := $c.Calls -}}
+      <tr{{if eq $e.Location.String "Stdlib"}} class="stdlib{{if gt $c.Count 1}} cycle{{end}}"{{else if gt $c.Count 1}} class="cycle"{{end}}>
+        <td>{{add $c.Start $j}}</td>
         <td>
           <a href="{{pkgURL $e}}">{{$e.Func.DirName}}</a>
         </td>
@@ -81,6 +90,7 @@
         </td>
       </tr>
     {{- end -}}
+    {{- end -}}
     {{- if .Elided}}<tr><td>(…)</td><tr>{{end -}}
   </table>
 {{- end -}}
@@ -89,7 +99,7 @@
 <meta name="author" content="Marc-Antoine Ruel" >
 <meta name="generator" content="https://github.com/maruel/panicparse" >
 <meta name="viewport" content="width=device-width, initial-scale=1">
-<title>PanicParse</title>
+<title>{{.Title}}</title>
 <link rel="shortcut icon" type="image/gif" href="data:image/gif;base64,{{.Favicon}}"/>
 <style>
   {{- /* Minimal CSS reset */ -}}
@@ -116,7 +126,48 @@
   h2 {
     font-size: 1.2em;
   }
+  {{- /* Colors, overridden in dark mode. */ -}}
+  :root {
+    --bg: #FFF;
+    --fg: #000;
+    --row-odd: #F0F0F0;
+    --row-hover: #DDD;
+    --tooltip-bg: #FFFAF0;
+    --tooltip-border: #DCA;
+    --tooltip-shadow: #CCC;
+    --tooltip-fg: #111;
+    --race: #600;
+    --shared: #FFF3C4;
+    --cycle: #E6EEFF;
+    --main: #880;
+    --unknown: #888;
+    --gomod: #800;
+    --gopath: #109090;
+    --gopkg: #008;
+    --stdlib: #080;
+  }
+  body.dark {
+    --bg: #1E1E1E;
+    --fg: #DDD;
+    --row-odd: #282828;
+    --row-hover: #3A3A3A;
+    --tooltip-bg: #2A2A20;
+    --tooltip-border: #665;
+    --tooltip-shadow: #000;
+    --tooltip-fg: #EEE;
+    --race: #F66;
+    --shared: #4A4220;
+    --cycle: #23304A;
+    --main: #DD4;
+    --unknown: #AAA;
+    --gomod: #F66;
+    --gopath: #4CC;
+    --gopkg: #88F;
+    --stdlib: #6C6;
+  }
   body {
+    background-color: var(--bg);
+    color: var(--fg);
     font-size: 1.6em;
     margin: 2px;
   }
@@ -138,10 +189,10 @@
     margin: 0.6em;
   }
   table tr:nth-child(odd) {
-    background-color: #F0F0F0;
+    background-color: var(--row-odd);
   }
   table tr:hover {
-    background-color: #DDD !important;
+    background-color: var(--row-hover) !important;
   }
   table td {
     font-family: monospace;
@@ -168,17 +219,30 @@
   }
   .race {
     font-weight: 700;
-    color: #600;
+    color: var(--race);
   }
   #content {
     width: 100%;
   }
+  .racepair > tbody > tr > td {
+    font-family: inherit;
+    vertical-align: top;
+  }
+  .racepair > tbody > tr:nth-child(odd) {
+    background-color: inherit;
+  }
+  table tr.shared {
+    background-color: var(--shared);
+  }
+  table tr.cycle {
+    background-color: var(--cycle);
+  }
   .hastooltip:hover .tooltip {
-    background: #fffAF0;
-    border: 1px solid #DCA;
+    background: var(--tooltip-bg);
+    border: 1px solid var(--tooltip-border);
     border-radius: 6px;
-    box-shadow: 5px 5px 8px #CCC;
-    color: #111;
+    box-shadow: 5px 5px 8px var(--tooltip-shadow);
+    color: var(--tooltip-fg);
     display: inline;
     position: absolute;
   }
@@ -194,55 +258,172 @@
     margin-top: 5em;
   }
 
+  {{- /* Interactive features, only shown when JavaScript is enabled. */ -}}
+  #toolbar {
+    background-color: var(--bg);
+    border-bottom: 1px solid var(--row-hover);
+    display: none;
+    padding: 0.4em;
+    position: sticky;
+    top: 0;
+    z-index: 20;
+  }
+  .js #toolbar {
+    display: block;
+  }
+  #toolbar input, #toolbar select, #toolbar button {
+    background-color: var(--bg);
+    border: 1px solid var(--unknown);
+    color: var(--fg);
+    margin-right: 0.6em;
+    padding: 0.1em 0.3em;
+  }
+  #toolbar input[type=number] {
+    width: 4em;
+  }
+  .bucket h1 {
+    cursor: pointer;
+  }
+  .js .bucket h1::before {
+    content: '▾ ';
+  }
+  .js .bucket.collapsed h1::before {
+    content: '▸ ';
+  }
+  .bucket.collapsed .details {
+    display: none;
+  }
+  .bucket.hidden, .hidestdlib tr.stdlib {
+    display: none;
+  }
+  .permalink {
+    margin-left: 0.4em;
+    visibility: hidden;
+  }
+  .bucket h1:hover .permalink {
+    visibility: visible;
+  }
+  .bucket:target h1 {
+    text-decoration: underline;
+  }
+
   {{- /* Highlights based on stack.Location value. */ -}}
   .FuncMain {
-    color: #880;
+    color: var(--main);
   }
   .FuncLocationUnknown {
-    color: #888;
+    color: var(--unknown);
   }
   .FuncGoMod {
-    color: #800;
+    color: var(--gomod);
   }
   .FuncGOPATH {
-    color: #109090;
+    color: var(--gopath);
   }
   .FuncGoPkg {
-    color: #008;
+    color: var(--gopkg);
   }
   .FuncStdlib {
-    color: #080;
+    color: var(--stdlib);
   }
   .Exported {
     font-weight: 700;
   }
+  {{- .CSS -}}
 </style>
+{{- .Header -}}
+<div id="toolbar">
+  <input id="search" type="search" placeholder="Search" title="Full text search">
+  <select id="state" title="Goroutine state"><option value="">All states</option></select>
+  <input id="pkg" type="search" placeholder="Package" title="Import path prefix of any call">
+  <input id="sleep" type="number" min="0" placeholder="Mins" title="Minimum sleep in minutes">
+  <button id="collapse">Collapse all</button>
+  <button id="expand">Expand all</button>
+  <label><input id="hidestdlib" type="checkbox">Hide stdlib</label>
+  <label><input id="dark" type="checkbox">Dark mode</label>
+  <span id="count"></span>
+</div>
 <div id="content">
   {{- if .Aggregated -}}
     {{- range $i, $e := .Aggregated.Buckets -}}
       {{$l := len $e.IDs}}
+      <div class="bucket" id="b{{$i}}" data-state="{{$e.State}}" data-sleep="{{$e.SleepMax}}" data-pkgs="{{template "ImportPaths" $e.Signature.Stack}}"
+        {{- if $e.Input.FirstLine}} data-line="{{$e.Input.FirstLine}}" data-offset="{{$e.Input.Offset}}"{{end}}>
       <h1>Signature #{{$i}}: {{$l}} routine{{if ne 1 $l}}s{{end}}: <span class="state">{{$e.State}}</span>
       {{- if $e.SleepMax -}}
         {{- if ne $e.SleepMin $e.SleepMax}} <span class="sleep">[{{$e.SleepMin}}~{{$e.SleepMax}} mins]</span>
         {{- else}} <span class="sleep">[{{$e.SleepMax}} mins]</span>
         {{- end -}}
       {{- end -}}
-      </h1>
+      <a class="permalink" href="#b{{$i}}" title="Permalink">#</a></h1>
+      <div class="details">
       {{if $e.Locked}} <span class="locked">[locked]</span>
       {{- end -}}
       {{- if $e.CreatedBy.Calls}} <span class="created">Created by: {{template "RenderCreatedBy" index $e.CreatedBy.Calls 0}}</span>
       {{- end -}}
       {{template "RenderCalls" $e.Signature.Stack}}
+      </div>
+      </div>
+    {{- end -}}
+  {{- else if .Races -}}
+    {{- range $i, $r := .Races.Buckets -}}
+    <div class="bucket" id="race{{if $i}}{{$i}}{{end}}" data-state="{{$r.Current.State}}" data-sleep="0" data-pkgs="{{range $r.Accesses}}{{template "ImportPaths" .Stack}}{{end}}">
+    <h1>Data race @ <span class="race">{{printf "0x%08X" $r.Current.RaceAddr}}</span>
+    {{- if gt $r.Count 1}} <span class="count">[{{$r.Count}} occurrences]</span>{{end}}
+    <a class="permalink" href="#race{{if $i}}{{$i}}{{end}}" title="Permalink">#</a></h1>
+    <div class="details">
+    <table class="racepair">
+      <tr>
+      {{- range $i, $e := $r.Accesses -}}
+        <td>
+          <h2 class="race">
+            {{- if $i}}Previous {{if $e.RaceWrite}}write{{else}}read{{end}}
+            {{- else}}{{if $e.RaceWrite}}Write{{else}}Read{{end}}{{end}} by goroutine {{$e.ID}}</h2>
+          <table class="stack">
+            {{- range $j, $c := $e.Stack.Calls -}}
+              <tr class="{{if $r.Shared $c}}shared{{end}}{{if eq $c.Location.String "Stdlib"}} stdlib{{end}}">
+                <td>{{$j}}</td>
+                <td><a href="{{pkgURL $c}}">{{$c.Func.DirName}}</a></td>
+                <td><a href="{{srcURL $c}}">{{$c.SrcName}}:{{$c.Line}}</a></td>
+                <td><span class="{{funcClass $c}}"><a href="{{pkgURL $c}}">{{$c.Func.Name}}</a></span>({{template "RenderArgs" $c.Args}})</td>
+              </tr>
+            {{- end -}}
+          </table>
+        </td>
+      {{- end -}}
+      </tr>
+    </table>
+    {{- with $r.Location -}}
+      {{- if .Global -}}
+        {{- with index .Stack.Calls 0 -}}
+          <h2>Global variable {{$r.Location.Global}} of size {{$r.Location.Size}} at {{printf "0x%08X" $r.Location.Addr}} declared at <a href="{{srcURL .}}">{{.SrcName}}:{{.Line}}</a></h2>
+        {{- end -}}
+      {{- else -}}
+        <h2>Heap block of size {{.Size}} at {{printf "0x%08X" .Addr}} allocated by goroutine {{.AllocatedBy}}</h2>
+        {{template "RenderCalls" .Stack}}
+      {{- end -}}
+    {{- end -}}
+    {{- range $r.Accesses -}}
+      {{- if .CreatedBy.Calls -}}
+        <h2>Goroutine {{.ID}} ({{.State}}) created at</h2>
+        {{template "RenderCalls" .CreatedBy}}
+      {{- end -}}
+    {{- end -}}
+    </div>
+    </div>
     {{- end -}}
   {{- else -}}
     {{- range $i, $e := .Snapshot.Goroutines -}}
+      <div class="bucket" id="g{{$e.ID}}" data-state="{{$e.State}}" data-sleep="{{$e.SleepMax}}" data-pkgs="{{template "ImportPaths" $e.Signature.Stack}}"
+        {{- if $e.Input.FirstLine}} data-line="{{$e.Input.FirstLine}}" data-offset="{{$e.Input.Offset}}"{{end}}>
       <h1>Routine {{$e.ID}}: <span class="state">{{$e.State}}</span>
       {{- if $e.SleepMax -}}
         {{- if ne $e.SleepMin $e.SleepMax}} <span class="sleep">[{{$e.SleepMin}}~{{$e.SleepMax}} mins]</span>
         {{- else}} <span class="sleep">[{{$e.SleepMax}} mins]</span>
         {{- end -}}
       {{- end -}}
-      </h1>
+      <a class="permalink" href="#g{{$e.ID}}" title="Permalink">#</a></h1>
+      <div class="details">
       {{if $e.Locked}} <span class="locked">[locked]</span>
       {{- end -}}
       {{if $e.RaceAddr}} <span class="race">Race {{if $e.RaceWrite}}write{{else}}read{{end}} @ {{printf "0x%08X" $e.RaceAddr}}</span><br>
@@ -250,6 +431,8 @@
       {{- if $e.CreatedBy.Calls}} <span class="created">Created by: {{template "RenderCreatedBy" index $e.CreatedBy.Calls 0}}</span>
       {{- end -}}
       {{template "RenderCalls" $e.Signature.Stack}}
+      </div>
+      </div>
     {{- end -}}
   {{- end -}}
 </div>
@@ -257,6 +440,11 @@
 <ul>
   <li>Created on {{.Now.String}}</li>
   <li>{{.Version}}</li>
+  {{- if .Snapshot.RemoteGoVersion -}}
+    <li>Go version (remote): {{.Snapshot.RemoteGoVersion}}</li>
+  {{- else if .Snapshot.RemoteGoMinVersion -}}
+    <li>Go version (remote): {{.Snapshot.RemoteGoMinVersion}} or later</li>
+  {{- end -}}
   {{- if and .Snapshot.LocalGOROOT (ne .Snapshot.RemoteGOROOT .Snapshot.LocalGOROOT) -}}
     <li>GOROOT (remote): {{.Snapshot.RemoteGOROOT}}</li>
     <li>GOROOT (local): {{.Snapshot.LocalGOROOT}}</li>
@@ -273,6 +461,17 @@
       </ul>
     </li>
   {{- end -}}
+  {{- with .Snapshot.BuildInfo -}}
+    <li>Executable: {{.Path}}
+      <ul>
+        <li>Built with: {{.GoVersion}}</li>
+        <li>Main module: {{.Main.Path}} {{.Main.Version}}</li>
+        {{- if .VCSRevision -}}
+          <li>Revision: {{.VCSRevision}}{{if .VCSModified}} (modified){{end}}{{if .VCSTime}} ({{.VCSTime}}){{end}}</li>
+        {{- end -}}
+      </ul>
+    </li>
+  {{- end -}}
   <li>GOMAXPROCS: {{.GOMAXPROCS}}</li>
 </ul>
 <h2>Legend</h2>
@@ -339,3 +538,91 @@
 {{- .Footer -}}
 {{- /* Add unnecessary bottom spacing so the last tooltip from the legend is visible. */ -}}
 <div class="bottom-padding"></div>
+{{- /* Everything is embedded so the file can be used offline. */ -}}
+<script>
+"use strict";
+(function() {
+  var $ = function(id) { return document.getElementById(id); };
+  var buckets = Array.prototype.slice.call(document.querySelectorAll(".bucket"));
+  var texts = buckets.map(function(b) { return b.textContent.toLowerCase(); });
+  var store = function(k, v) {
+    try { localStorage.setItem("panicparse." + k, v); } catch (e) {}
+  };
+  var load = function(k) {
+    try { return localStorage.getItem("panicparse." + k); } catch (e) { return null; }
+  };
+  document.body.classList.add("js");
+
+  // Populate the states.
+  var states = {};
+  buckets.forEach(function(b) { states[b.dataset.state] = true; });
+  Object.keys(states).sort().forEach(function(s) {
+    var o = document.createElement("option");
+    o.value = o.textContent = s;
+    $("state").appendChild(o);
+  });
+
+  var filter = function() {
+    var q = $("search").value.toLowerCase();
+    var state = $("state").value;
+    var pkg = $("pkg").value;
+    var sleep = parseInt($("sleep").value, 10) || 0;
+    var shown = 0;
+    buckets.forEach(function(b, i) {
+      var ok = (!q || texts[i].indexOf(q) !== -1) &&
+        (!state || b.dataset.state === state) &&
+        (!pkg || (" " + b.dataset.pkgs).indexOf(" " + pkg) !== -1) &&
+        parseInt(b.dataset.sleep, 10) >= sleep;
+      b.classList.toggle("hidden", !ok);
+      if (ok) {
+        shown++;
+      }
+    });
+    $("count").textContent = shown + " / " + buckets.length;
+  };
+  ["search", "state", "pkg", "sleep"].forEach(function(id) {
+    $(id).addEventListener("input", filter);
+  });
+  filter();
+
+  var collapseAll = function(c) {
+    buckets.forEach(function(b) { b.classList.toggle("collapsed", c); });
+  };
+  $("collapse").addEventListener("click", function() { collapseAll(true); });
+  $("expand").addEventListener("click", function() { collapseAll(false); });
+  buckets.forEach(function(b) {
+    b.querySelector("h1").addEventListener("click", function(e) {
+      if (e.target.tagName !== "A") {
+        b.classList.toggle("collapsed");
+      }
+    });
+  });
+
+  var toggle = function(id, cls) {
+    var apply = function() {
+      document.body.classList.toggle(cls, $(id).checked);
+    };
+    $(id).addEventListener("change", function() {
+      apply();
+      store(id, $(id).checked ? "1" : "0");
+    });
+    apply();
+  };
+  var dark = load("dark");
+  $("dark").checked = dark === null ? window.matchMedia("(prefers-color-scheme: dark)").matches : dark === "1";
+  $("hidestdlib").checked = load("hidestdlib") === "1";
+  toggle("dark", "dark");
+  toggle("hidestdlib", "hidestdlib");
+
+  // Permalinks: make sure the target is visible.
+  var reveal = function() {
+    var b = location.hash && document.getElementById(location.hash.substr(1));
+    if (b && b.classList.contains("bucket")) {
+      b.classList.remove("collapsed", "hidden");
+      b.scrollIntoView();
+    }
+  };
+  window.addEventListener("hashchange", reveal);
+  reveal();
+})();
+</script>
@@ -7,10 +7,8 @@
 package stack
 
 import (
-	"fmt"
 	"html/template"
 	"io"
-	"log"
 	"net/url"
 	"regexp"
 	"runtime"
@@ -18,47 +16,126 @@ import (
 	"time"
 )
 
+// HTMLOpts are options to generate HTML with ToHTMLWithOptions.
+type HTMLOpts struct {
+	// Title is the page title. Defaults to "PanicParse" when empty.
+	Title string
+	// Header is custom HTML added at the top of the page.
+	Header template.HTML
+	// Footer is custom HTML added at the bottom of the page.
+	Footer template.HTML
+	// CSS is added at the end of the page style sheet, so it can override the
+	// default style.
+	CSS template.CSS
+	// Links is used to create links to the source files. Defaults to
+	// DefaultLinkResolver() when nil.
+	Links *LinkResolver
+
+	// Template is parsed after the default template. It can redefine any of
+	// the named templates like "RenderCalls", "RenderArgs" or
+	// "RenderCreatedBy", or replace the whole page when it contains text
+	// outside of {{define}} actions.
+	//
+	// The data passed to the page is a map with the keys "Aggregated" (only
+	// set by Aggregated.ToHTMLWithOptions), "Races" (the data races to render,
+	// if any), "Snapshot", "Title", "Header", "Footer", "CSS", "Favicon",
+	// "GOMAXPROCS", "Now" and "Version".
+	Template string
+	// Funcs are added to the functions available to the templates. They
+	// override the built-in ones: "add", "funcClass", "minus", "pkgURL",
+	// "srcURL" and "symbol".
+	Funcs template.FuncMap
+	// Races are the data races rendered by Snapshot.ToHTMLWithOptions instead
+	// of Snapshot.Race, e.g. all the data races found in the output of "go
+	// test -race". The snapshot is still used for the metadata.
+	Races *RaceReports
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
 // ToHTML formats the aggregated buckets as HTML to the writer.
 //
 // Use footer to add custom HTML at the bottom of the page.
 func (a *Aggregated) ToHTML(w io.Writer, footer template.HTML) error {
+	return a.ToHTMLWithOptions(w, &HTMLOpts{Footer: footer})
+}
+
+// ToHTMLWithOptions formats the aggregated buckets as HTML to the writer.
+//
+// opts can be nil.
+func (a *Aggregated) ToHTMLWithOptions(w io.Writer, opts *HTMLOpts) error {
 	data := map[string]interface{}{
 		"Aggregated": a,
-		"Footer":     footer,
 		"Snapshot":   a.Snapshot,
 	}
-	return toHTML(w, data)
+	return toHTML(w, opts, data)
 }
 
 // ToHTML formats the snapshot as HTML to the writer.
 //
 // Use footer to add custom HTML at the bottom of the page.
 func (s *Snapshot) ToHTML(w io.Writer, footer template.HTML) error {
+	return s.ToHTMLWithOptions(w, &HTMLOpts{Footer: footer})
+}
+
+// ToHTMLWithOptions formats the snapshot as HTML to the writer.
+//
+// opts can be nil.
+func (s *Snapshot) ToHTMLWithOptions(w io.Writer, opts *HTMLOpts) error {
 	data := map[string]interface{}{
-		"Footer":   footer,
 		"Snapshot": s,
 	}
-	return toHTML(w, data)
+	return toHTML(w, opts, data)
 }
 
 // Private stuff.
 
-func toHTML(w io.Writer, data map[string]interface{}) error {
+func toHTML(w io.Writer, opts *HTMLOpts, data map[string]interface{}) error {
+	if opts == nil {
+		opts = &HTMLOpts{}
+	}
+	l := opts.Links
+	if l == nil {
+		l = DefaultLinkResolver()
+	}
 	m := template.FuncMap{
+		"add":       add,
 		"funcClass": funcClass,
 		"minus":     minus,
-		"pkgURL":    pkgURL,
-		"srcURL":    srcURL,
+		"pkgURL":    l.pkgURL,
+		"srcURL":    l.srcURL,
 		"symbol":    symbol,
 	}
+	for k, v := range opts.Funcs {
+		m[k] = v
+	}
+	title := opts.Title
+	if title == "" {
+		title = "PanicParse"
+	}
+	if opts.Races != nil {
+		data["Races"] = opts.Races
+	} else if s, _ := data["Snapshot"].(*Snapshot); s != nil && s.Race != nil {
+		data["Races"] = &RaceReports{Buckets: []*RaceBucket{{RaceReport: s.Race, Count: 1}}, Total: 1}
+	}
+	data["CSS"] = opts.CSS
 	data["Favicon"] = favicon
+	data["Footer"] = opts.Footer
 	data["GOMAXPROCS"] = runtime.GOMAXPROCS(0)
+	data["Header"] = opts.Header
 	data["Now"] = time.Now().Truncate(time.Second)
+	data["Title"] = title
 	data["Version"] = runtime.Version()
 	t, err := template.New("t").Funcs(m).Parse(indexHTML)
 	if err != nil {
 		return err
 	}
+	if opts.Template != "" {
+		if t, err = t.Parse(opts.Template); err != nil {
+			return err
+		}
+	}
 	return t.Execute(w, data)
 }
 
@@ -75,20 +152,29 @@ func funcClass(c *Call) template.HTML {
 	return template.HTML("Func" + s)
 }
 
+func add(i, j int) int {
+	return i + j
+}
+
 func minus(i, j int) int {
 	return i - j
 }
 
 // pkgURL returns a link to the godoc for the call.
-func pkgURL(c *Call) template.URL {
-	imp := c.ImportPath
+//
+// The link is a string when it is based on a user provided DocServer so
+// html/template sanitizes it, and a template.URL otherwise.
+func (l *LinkResolver) pkgURL(c *Call) interface{} {
 	// Check for vendored code first.
-	if i := strings.Index(imp, "/vendor/"); i != -1 {
-		imp = imp[i+8:]
-	}
-	ip := escape(imp)
+	ip := escape(stripVendor(c.ImportPath))
 	if ip == "" {
-		return ""
+		return template.URL("")
+	}
+	if d := l.docServer(c.ImportPath, false); d != nil {
+		if c.Func.IsExported {
+			return d.DocURL + string(ip) + "#" + string(symbol(&c.Func))
+		}
+		return d.DocURL + string(ip)
 	}
 	url := template.URL("")
 	if c.Location == Stdlib {
@@ -99,7 +185,7 @@ func pkgURL(c *Call) template.URL {
 		// TODO(maruel): Leverage Location.
 		// Use pkg.go.dev when there's a version (go module) and godoc.org when
 		// there's none (implies branch master).
-		_, branch := getSrcBranchURL(c)
+		_, branch := l.srcBranchURL(c)
 		if branch == "master" || branch == "" {
 			url = "https://godoc.org/"
 		} else {
@@ -114,10 +200,13 @@ func pkgURL(c *Call) template.URL {
 
 // srcURL returns an URL to the sources.
 //
-// TODO(maruel): Support custom local godoc server as it serves files too.
-func srcURL(c *Call) template.URL {
-	url, _ := getSrcBranchURL(c)
-	return template.URL(url)
+// Like pkgURL, the link is a string when it is based on a DocServer.
+func (l *LinkResolver) srcURL(c *Call) interface{} {
+	if u := l.docSrcURL(c); u != "" {
+		return u
+	}
+	url, _ := l.srcBranchURL(c)
+	return url
 }
 
 func escape(s string) template.URL {
@@ -127,98 +216,56 @@ func escape(s string) template.URL {
 	return template.URL(u.EscapedPath())
 }
 
-// getSrcBranchURL returns a link to the source on the web and the tag name for
-// the package version, if possible.
-func getSrcBranchURL(c *Call) (template.URL, template.URL) {
-	tag := ""
-	if c.Location == Stdlib {
-		// TODO(maruel): This is not strictly speaking correct. The remote could be
-		// running a different Go version from the current executable.
-		ver := runtime.Version()
-		const devel = "devel +"
-		if strings.HasPrefix(ver, devel) {
-			ver = ver[len(devel) : len(devel)+10]
-		}
-		tag = url.QueryEscape(ver)
-		return template.URL(fmt.Sprintf("https://github.com/golang/go/blob/%s/src/%s#L%d", tag, escape(c.RelSrcPath), c.Line)), template.URL(tag)
-	}
-	// TODO(maruel): Leverage Location.
-	if rel := c.RelSrcPath; rel != "" {
-		// Check for vendored code first.
-		if i := strings.Index(rel, "/vendor/"); i != -1 {
-			rel = rel[i+8:]
-		}
-		// Specialized support for github and golang.org. This will cover a fair
-		// share of the URLs, but it'd be nice to support others too. Please submit
-		// a PR (including a unit test that I was too lazy to add yet).
-		switch host, rest := splitHost(rel); host {
-		case "github.com":
-			if parts := strings.SplitN(rest, "/", 3); len(parts) == 3 {
-				p, srcTag, tag := splitTag(parts[1])
-				url := fmt.Sprintf("https://github.com/%s/%s/blob/%s/%s#L%d", escape(parts[0]), p, srcTag, escape(parts[2]), c.Line)
-				return template.URL(url), tag
-			}
-			log.Printf("problematic github.com URL: %q", rel)
-		case "golang.org":
-			// https://github.com/golang/build/blob/master/repos/repos.go lists all
-			// the golang.org/x/<foo> packages.
-			if parts := strings.SplitN(rest, "/", 3); len(parts) == 3 && parts[0] == "x" {
-				// parts is: "x", <project@version>, <path inside the repo>.
-				p, srcTag, tag := splitTag(parts[1])
-				// The source of truth is are actually go.googlesource.com, but
-				// github.com has nicer syntax highlighting.
-				url := fmt.Sprintf("https://github.com/golang/%s/blob/%s/%s#L%d", p, srcTag, escape(parts[2]), c.Line)
-				return template.URL(url), tag
-			}
-			log.Printf("problematic golang.org URL: %q", rel)
-		default:
-			// For example gopkg.in. In this case there's no known way to find the
-			// link to the source files, but we can still try to extract the version
-			// if fetched from a go module.
-			// Do a best effort to find a version by searching for a '@'.
-			if i := strings.IndexByte(rel, '@'); i != -1 {
-				if j := strings.IndexByte(rel[i:], '/'); j != -1 {
-					tag = rel[i+1 : i+j]
-				}
-			}
-		}
-	}
+// "v0.0.0-20200223170610-d5e6a3e2c0ae"
+var reVersion = regexp.MustCompile(`v\d+\.\d+\.\d+\-\d+\-([a-f0-9]+)`)
 
-	if c.LocalSrcPath != "" {
-		return template.URL("file:///" + escape(c.LocalSrcPath)), template.URL(tag)
+// splitTag splits "project@version" into the project, the git reference and
+// the version.
+//
+// ver is used when s has no version, e.g. when the version was determined via
+// the executable build information.
+func splitTag(s, ver string) (string, string, template.URL) {
+	p := s
+	tag := ver
+	if i := strings.IndexByte(s, '@'); i != -1 {
+		// We got a versionned go module.
+		p = s[:i]
+		tag = s[i+1:]
 	}
-	if c.RemoteSrcPath != "" {
-		return template.URL("file:///" + escape(c.RemoteSrcPath)), template.URL(tag)
+	if tag == "" {
+		// Default to branch master for non-versionned dependencies. It's not
+		// optimal but it's better than nothing?
+		return p, "master", "master"
 	}
-	return "", ""
-}
-
-func splitHost(s string) (string, string) {
-	parts := strings.SplitN(s, "/", 2)
-	if len(parts) != 2 {
-		return parts[0], ""
+	srcTag := strings.TrimSuffix(tag, "+incompatible")
+	if m := reVersion.FindStringSubmatch(srcTag); len(m) != 0 {
+		srcTag = m[1]
 	}
-	return parts[0], parts[1]
+	return p, url.QueryEscape(srcTag), template.URL(url.QueryEscape(tag))
 }
 
-// "v0.0.0-20200223170610-d5e6a3e2c0ae"
-var reVersion = regexp.MustCompile(`v\d+\.\d+\.\d+\-\d+\-([a-f0-9]+)`)
-
-func splitTag(s string) (string, string, template.URL) {
-	// Default to branch master for non-versionned dependencies. It's not
-	// optimal but it's better than nothing?
-	i := strings.IndexByte(s, '@')
-	if i == -1 {
-		// No tag was found.
-		return s, "master", "master"
-	}
-	// We got a versionned go module.
-	tag := s[i+1:]
-	srcTag := tag
-	if m := reVersion.FindStringSubmatch(tag); len(m) != 0 {
-		srcTag = m[1]
+// goVersionTag returns the git reference in the Go repository for a Go
+// version as returned by runtime.Version().
+func goVersionTag(ver string) string {
+	// "devel +8c6e8d3 Wed Jun 3 00:00:00 2020 +0000"
+	const devel = "devel +"
+	if strings.HasPrefix(ver, devel) && len(ver) >= len(devel)+10 {
+		return ver[len(devel) : len(devel)+10]
+	}
+	// "devel go1.22-8c6e8d3 Wed Jun 3 00:00:00 2020 +0000"
+	const develGo = "devel go"
+	if strings.HasPrefix(ver, develGo) {
+		if f := strings.Fields(ver); len(f) > 1 {
+			if i := strings.IndexByte(f[1], '-'); i != -1 {
+				return f[1][i+1:]
+			}
+		}
+	}
+	// "go1.21.0 X:nocoverageredesign"
+	if i := strings.IndexByte(ver, ' '); i != -1 {
+		return ver[:i]
 	}
-	return s[:i], url.QueryEscape(srcTag), template.URL(url.QueryEscape(tag))
+	return ver
 }
 
 // symbol is the hashtag to use to refer to the symbol when looking at
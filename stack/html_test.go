@@ -28,7 +28,7 @@ func TestAggregated_ToHTML_2Buckets(t *testing.T) {
 	// We expect this to be fairly static across Go versions. We want to know if
 	// it changes significantly, thus assert the approximate size. This is being
 	// tested on travis.
-	if l := buf.Len(); l < 4000 || l > 10000 {
+	if l := buf.Len(); l < 8000 || l > 20000 {
 		t.Fatalf("unexpected length %d", l)
 	}
 }
@@ -45,7 +45,7 @@ func TestAggregated_ToHTML_1Bucket(t *testing.T) {
 	// We expect this to be fairly static across Go versions. We want to know if
 	// it changes significantly, thus assert the approximate size. This is being
 	// tested on travis.
-	if l := buf.Len(); l < 4000 || l > 10000 {
+	if l := buf.Len(); l < 8000 || l > 20000 {
 		t.Fatalf("unexpected length %d", l)
 	}
 	if strings.Contains(buf.String(), "foo-bar") {
@@ -66,6 +66,109 @@ func TestAggregated_ToHTML_1Bucket_Footer(t *testing.T) {
 	}
 }
 
+func TestAggregated_ToHTML_Interactive(t *testing.T) {
+	t.Parallel()
+	buf := bytes.Buffer{}
+	if err := getBuckets().ToHTML(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	for _, want := range []string{
+		`<input id="search"`,
+		`<div class="bucket" id="b0" data-state="chan receive" data-sleep="0" data-pkgs="`,
+		`<a class="permalink" href="#b1" title="Permalink">#</a>`,
+		`<tr class="stdlib">`,
+		`<script>`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	if strings.Contains(s, "://cdn") || strings.Contains(s, "<script src") {
+		t.Error("the file must be self contained")
+	}
+}
+
+func TestAggregated_ToHTMLWithOptions(t *testing.T) {
+	t.Parallel()
+	buf := bytes.Buffer{}
+	opts := &HTMLOpts{
+		Title:  "Incident 42",
+		Header: "<div id=brand>ACME</div>",
+		CSS:    "body { color: red; }",
+		Footer: "foo-bar",
+		// Redefine one of the sub-templates.
+		Template: `{{define "RenderArgs"}}<i>{{shout "args"}}</i>{{end}}`,
+		Funcs: template.FuncMap{
+			"shout": strings.ToUpper,
+		},
+	}
+	if err := getBuckets().ToHTMLWithOptions(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	for _, want := range []string{
+		"<title>Incident 42</title>",
+		"body { color: red; }</style><div id=brand>ACME</div>",
+		"<i>ARGS</i>",
+		"foo-bar",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+func TestSnapshot_ToHTMLWithOptions_Template(t *testing.T) {
+	t.Parallel()
+	buf := bytes.Buffer{}
+	s := &Snapshot{Goroutines: []*Goroutine{{ID: 7}}}
+	// Replace the whole page.
+	opts := &HTMLOpts{Template: `{{.Title}}:{{range .Snapshot.Goroutines}}{{.ID}}{{end}}`}
+	if err := s.ToHTMLWithOptions(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "PanicParse:7", buf.String())
+
+	buf.Reset()
+	if err := s.ToHTMLWithOptions(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<title>PanicParse</title>") {
+		t.Fatal("missing default title")
+	}
+
+	opts = &HTMLOpts{Template: `{{.Unterminated`}
+	if err := s.ToHTMLWithOptions(&buf, opts); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSnapshot_ToHTMLWithOptions_DocServers(t *testing.T) {
+	t.Parallel()
+	buf := bytes.Buffer{}
+	c := Call{
+		Func:       newFunc("git.example.com/infra/pkg.Foo"),
+		RelSrcPath: "git.example.com/infra/pkg/foo.go",
+		Line:       10,
+		ImportPath: "git.example.com/infra/pkg",
+		Location:   GOPATH,
+	}
+	s := &Snapshot{Goroutines: []*Goroutine{{Signature: Signature{Stack: Stack{Calls: []Call{c}}}, ID: 1}}}
+	l := DefaultLinkResolver()
+	l.DocServers = []DocServer{{DocURL: "javascript:alert(1)//", SrcURL: "javascript:alert(2)//"}}
+	if err := s.ToHTMLWithOptions(&buf, &HTMLOpts{Links: l}); err != nil {
+		t.Fatal(err)
+	}
+	// The user provided URLs are sanitized by html/template.
+	if strings.Contains(buf.String(), "javascript:alert") {
+		t.Fatal("unsafe URL not sanitized")
+	}
+	if !strings.Contains(buf.String(), `href="#ZgotmplZ"`) {
+		t.Fatal("expected sanitized URL")
+	}
+}
+
 func TestGenerate(t *testing.T) {
 	t.Parallel()
 	// Confirms that nobody forgot to regenate data.go.
@@ -156,6 +259,36 @@ func TestGetSrcBranchURL(t *testing.T) {
 			"https://godoc.org/golang.org/x/sys/unix#Nanosleep",
 			GOPATH,
 		},
+		{
+			"stdlib_version",
+			Call{
+				Func:          newFunc("net/http.(*Server).Serve"),
+				RelSrcPath:    "net/http/server.go",
+				Line:          2933,
+				ImportPath:    "net/http",
+				Location:      Stdlib,
+				ModuleVersion: "go1.21.0",
+			},
+			"https://github.com/golang/go/blob/go1.21.0/src/net/http/server.go#L2933",
+			"go1.21.0",
+			"https://golang.org/pkg/net/http#Server.Serve",
+			Stdlib,
+		},
+		{
+			"gomod_version",
+			Call{
+				Func:          newFunc("github.com/maruel/panicparse/stack.Augment"),
+				RelSrcPath:    "github.com/maruel/panicparse/stack/source.go",
+				Line:          42,
+				ImportPath:    "github.com/maruel/panicparse/stack",
+				Location:      GoMod,
+				ModuleVersion: "0123456789abcdef",
+			},
+			"https://github.com/maruel/panicparse/blob/0123456789abcdef/stack/source.go#L42",
+			"0123456789abcdef",
+			"https://pkg.go.dev/github.com/maruel/panicparse/stack#Augment",
+			GoMod,
+		},
 		{
 			"windows",
 			Call{RemoteSrcPath: "c:/random.go"},
@@ -181,21 +314,22 @@ func TestGetSrcBranchURL(t *testing.T) {
 			LocationUnknown,
 		},
 	}
+	l := DefaultLinkResolver()
 	for i, line := range data {
 		line := line
 		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
 			t.Parallel()
-			url, branch := getSrcBranchURL(&line.c)
+			url, branch := l.srcBranchURL(&line.c)
 			if url != line.url {
 				t.Errorf("%q != %q", url, line.url)
 			}
 			if branch != line.branch {
 				t.Errorf("%q != %q", branch, line.branch)
 			}
-			if url := srcURL(&line.c); url != line.url {
+			if url := l.srcURL(&line.c); url != line.url {
 				t.Errorf("%q != %q", url, line.url)
 			}
-			if url := pkgURL(&line.c); url != line.pkgURL {
+			if url := l.pkgURL(&line.c); url != line.pkgURL {
 				t.Errorf("%q != %q", url, line.pkgURL)
 			}
 			if line.c.Location != line.loc {
@@ -205,6 +339,19 @@ func TestGetSrcBranchURL(t *testing.T) {
 	}
 }
 
+func TestGoVersionTag(t *testing.T) {
+	t.Parallel()
+	data := map[string]string{
+		"go1.21.0":                      "go1.21.0",
+		"go1.21.0 X:nocoverageredesign": "go1.21.0",
+		"devel +8c6e8d3aa4 Wed Jun 3 00:00:00 2020 +0000":    "8c6e8d3aa4",
+		"devel go1.22-8c6e8d3 Wed Jun 3 00:00:00 2020 +0000": "8c6e8d3",
+	}
+	for in, want := range data {
+		compareString(t, want, goVersionTag(in))
+	}
+}
+
 func TestSymbol(t *testing.T) {
 	t.Parallel()
 	data := []struct {
@@ -259,6 +406,112 @@ func TestSnapshot_ToHTML(t *testing.T) {
 	}
 }
 
+func TestSnapshot_ToHTML_Race(t *testing.T) {
+	t.Parallel()
+	caller := newCall("main.main", Args{}, "/src/main.go", 10)
+	current := &Goroutine{
+		Signature: Signature{
+			State:     "running",
+			CreatedBy: Stack{Calls: []Call{newCall("main.main", Args{}, "/src/main.go", 9)}},
+			Stack:     Stack{Calls: []Call{newCall("main.write", Args{}, "/src/main.go", 20), caller}},
+		},
+		ID:        7,
+		First:     true,
+		RaceWrite: true,
+		RaceAddr:  0xc000014100,
+	}
+	previous := &Goroutine{
+		Signature: Signature{Stack: Stack{Calls: []Call{newCall("main.read", Args{}, "/src/main.go", 30), caller}}},
+		ID:        1,
+		RaceAddr:  0xc000014100,
+	}
+	s := &Snapshot{
+		Goroutines: []*Goroutine{current, previous},
+		Race: &RaceReport{
+			Current:  current,
+			Previous: previous,
+			Location: &RaceLocation{
+				Global: "main.x",
+				Size:   8,
+				Addr:   0xc000014100,
+				Stack:  Stack{Calls: []Call{newCall("main.x", Args{}, "/src/main.go", 3)}},
+			},
+		},
+	}
+	buf := bytes.Buffer{}
+	if err := s.ToHTML(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		`<div class="bucket" id="race" data-state="running"`,
+		`<h2 class="race">Write by goroutine 7</h2>`,
+		`<h2 class="race">Previous read by goroutine 1</h2>`,
+		`<tr class="shared">`,
+		`<h2>Global variable main.x of size 8 at 0xC000014100 declared at`,
+		`<h2>Goroutine 7 (running) created at</h2>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	if strings.Count(got, `<tr class="shared">`) != 2 {
+		t.Error("expected the caller to be highlighted in both stacks")
+	}
+}
+
+func TestSnapshot_ToHTML_Recursion(t *testing.T) {
+	t.Parallel()
+	f := newCall("main.f", Args{}, "/src/main.go", 5)
+	s := &Snapshot{
+		Goroutines: []*Goroutine{
+			{
+				Signature: Signature{
+					State: "running",
+					Stack: Stack{Calls: []Call{f, f, f, newCall("main.main", Args{}, "/src/main.go", 10)}},
+				},
+				ID:    1,
+				First: true,
+			},
+		},
+	}
+	buf := bytes.Buffer{}
+	if err := s.ToHTML(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if !strings.Contains(got, `<tr class="cycle"><td colspan="4">Recursion: main.f ×3</td></tr>`) {
+		t.Error("missing recursion header")
+	}
+	if !strings.Contains(got, "<td>3</td>") || strings.Contains(got, "<td>1</td>") {
+		t.Error("expected the recursion to be printed once")
+	}
+}
+
+func TestSnapshot_ToHTML_Input(t *testing.T) {
+	t.Parallel()
+	s := &Snapshot{
+		Goroutines: []*Goroutine{
+			{
+				Signature: Signature{
+					State: "running",
+					Stack: Stack{Calls: []Call{newCall("main.main", Args{}, "/src/main.go", 10)}},
+				},
+				ID:    1,
+				First: true,
+				Input: InputRange{Offset: 1234, End: 1300, FirstLine: 42, LastLine: 44},
+			},
+		},
+	}
+	buf := bytes.Buffer{}
+	if err := s.ToHTML(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), ` data-line="42" data-offset="1234">`) {
+		t.Error("missing input position")
+	}
+}
+
 func BenchmarkAggregated_ToHTML(b *testing.B) {
 	b.ReportAllocs()
 	s, _, err := ScanSnapshot(bytes.NewReader(internaltest.StaticPanicwebOutput()), ioutil.Discard, DefaultOpts())
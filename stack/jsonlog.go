@@ -0,0 +1,172 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultJSONLogFields returns the fields decoded by default by
+// NewJSONLogReader:
+//   - "log": Docker json-file logging driver.
+//   - "stacktrace": zap.
+//   - "stack": common name used to log the output of debug.Stack().
+func DefaultJSONLogFields() []string {
+	return []string{"log", "stacktrace", "stack"}
+}
+
+// NewJSONLogReader returns a reader that decodes JSON log lines so the stack
+// traces they contain can be parsed by ScanSnapshot.
+//
+// Each line that is a JSON object with one of the fields as a string is
+// replaced with the value of the first field found, in the order of fields.
+// A newline is added if the value doesn't end with one. Other lines are
+// returned unmodified.
+//
+// The "log" field of the Docker json-file logging driver is handled
+// differently: its value is used as is, so the long lines that Docker splits
+// into multiple records are joined back. The resulting line is decoded again,
+// so the JSON logs of a program running in a container, like zap logs, are
+// decoded too.
+//
+// The value must contain a Go stack trace, like the output of debug.Stack(),
+// or a stack trace as formatted by zap, which has no goroutine header and no
+// arguments. In the latter case, a goroutine header is added so each log entry
+// is parsed as a goroutine, numbered from 1.
+//
+// The positions recorded by ScanSnapshot, like Goroutine.Input and
+// Diagnostic.Line, are relative to the decoded text, not to the JSON lines.
+//
+// Uses DefaultJSONLogFields() when fields is empty.
+func NewJSONLogReader(r io.Reader, fields []string) io.Reader {
+	if len(fields) == 0 {
+		fields = DefaultJSONLogFields()
+	}
+	return &jsonLogReader{r: bufio.NewReader(r), fields: fields}
+}
+
+// Private stuff.
+
+// jsonLogReader decodes JSON log lines, see NewJSONLogReader.
+type jsonLogReader struct {
+	r      *bufio.Reader
+	fields []string
+	buf    []byte
+	err    error
+	// partial is the text of the Docker records not ending a line yet.
+	partial []byte
+	// synthesized is the number of goroutine headers added.
+	synthesized int
+}
+
+// dockerField is the field used by the Docker json-file logging driver.
+const dockerField = "log"
+
+func (j *jsonLogReader) Read(p []byte) (int, error) {
+	for len(j.buf) == 0 {
+		if j.err != nil {
+			if len(j.partial) != 0 {
+				// The input ended in the middle of a line.
+				j.buf, j.partial = j.partial, nil
+				continue
+			}
+			return 0, j.err
+		}
+		var line []byte
+		line, j.err = j.r.ReadBytes('\n')
+		j.buf = j.decode(line)
+	}
+	n := copy(p, j.buf)
+	j.buf = j.buf[n:]
+	return n, nil
+}
+
+// decode returns the decoded text of line.
+//
+// The Docker records are returned as is, once a record ends the line. The
+// other values are returned as a line.
+func (j *jsonLogReader) decode(line []byte) []byte {
+	v, f, ok := j.value(line)
+	if !ok {
+		return append(j.flush(), line...)
+	}
+	if f != dockerField {
+		return append(j.flush(), j.format(v)...)
+	}
+	// Docker splits lines longer than 16 KiB into multiple records, only the
+	// last one ends with a newline.
+	j.partial = append(j.partial, v...)
+	if !strings.HasSuffix(v, "\n") {
+		return nil
+	}
+	l := j.flush()
+	// The logs of a program logging JSON are nested inside the Docker records.
+	if v, f, ok = j.value(l); ok && f != dockerField {
+		return j.format(v)
+	}
+	return l
+}
+
+// value returns the value of the first field found and its name if line is a
+// JSON object.
+func (j *jsonLogReader) value(line []byte) (string, string, bool) {
+	t := bytes.TrimSpace(line)
+	if len(t) < 2 || t[0] != '{' || t[len(t)-1] != '}' {
+		return "", "", false
+	}
+	var m map[string]json.RawMessage
+	if json.Unmarshal(t, &m) != nil {
+		return "", "", false
+	}
+	for _, f := range j.fields {
+		raw, ok := m[f]
+		if !ok {
+			continue
+		}
+		var v string
+		if json.Unmarshal(raw, &v) != nil {
+			continue
+		}
+		return v, f, true
+	}
+	return "", "", false
+}
+
+// format returns the value v of a field as a line.
+func (j *jsonLogReader) format(v string) []byte {
+	if len(v) != 0 && v[len(v)-1] != '\n' {
+		v += "\n"
+	}
+	if isHeaderlessStack(v) {
+		// Synthesize a goroutine per log entry, separated by an empty line like
+		// in a Go traceback.
+		j.synthesized++
+		v = "goroutine " + strconv.Itoa(j.synthesized) + " [running]:\n" + v + "\n"
+	}
+	return []byte(v)
+}
+
+// flush returns the pending Docker records.
+func (j *jsonLogReader) flush() []byte {
+	p := j.partial
+	j.partial = nil
+	return p
+}
+
+// isHeaderlessStack returns true if v looks like a stack trace without a
+// goroutine header, as formatted by zap:
+//
+//	main.main
+//		/home/user/src/foo/main.go:12
+func isHeaderlessStack(v string) bool {
+	lines := strings.SplitN(v, "\n", 3)
+	return len(lines) == 3 && lines[0] != "" && strings.IndexAny(lines[0], " \t") == -1 &&
+		strings.HasPrefix(lines[1], "\t") && strings.IndexByte(lines[1], ':') != -1
+}
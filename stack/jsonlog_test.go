@@ -0,0 +1,170 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNewJSONLogReader(t *testing.T) {
+	t.Parallel()
+	trace := "goroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:8 +0x25\n"
+	docker := ""
+	for _, l := range strings.SplitAfter("panic: oh no\n\n"+trace, "\n") {
+		if l != "" {
+			docker += dockerRecord(l)
+		}
+	}
+	stack, err := json.Marshal(map[string]string{"level": "error", "msg": "oh no", "stack": strings.TrimSuffix(trace, "\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []struct {
+		name   string
+		in     string
+		fields []string
+		want   string
+	}{
+		{"Docker", docker, nil, "panic: oh no\n\n" + trace},
+		{"Stack", "junk\n" + string(stack) + "\n", nil, "junk\n" + trace},
+		{
+			"Zap",
+			zapLine + "\n",
+			nil,
+			"goroutine 1 [running]:\nmain.run\n\t/home/user/src/app/main.go:27\nmain.main\n\t/home/user/src/app/main.go:14\nruntime.main\n\t/usr/local/go/src/runtime/proc.go:267\n\n",
+		},
+		{"OneLine", `{"log":"main.main\n"}` + "\n", nil, "main.main\n"},
+		{
+			"DockerPartial",
+			`{"log":"main.main()\n"}` + "\n" + `{"log":"\t/gopath/src/foo/"}` + "\n" + `{"log":"main.go:8 +0x25\n"}` + "\n",
+			nil,
+			"main.main()\n\t/gopath/src/foo/main.go:8 +0x25\n",
+		},
+		{"DockerPartialEOF", `{"log":"a"}` + "\n" + `{"log":"b"}` + "\n", nil, "ab"},
+		{"DockerPartialThenOther", `{"log":"a"}` + "\n" + "junk\n", nil, "ajunk\n"},
+		{
+			"DockerZap",
+			dockerRecord(zapLine + "\n"),
+			nil,
+			"goroutine 1 [running]:\nmain.run\n\t/home/user/src/app/main.go:27\nmain.main\n\t/home/user/src/app/main.go:14\nruntime.main\n\t/usr/local/go/src/runtime/proc.go:267\n\n",
+		},
+		{"Custom", `{"msg":"a","trace":"b"}` + "\n", []string{"trace"}, "b\n"},
+		{"NotString", `{"log":1}` + "\n", nil, `{"log":1}` + "\n"},
+		{"Invalid", "{\"log\":}\n{}", nil, "{\"log\":}\n{}"},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
+			t.Parallel()
+			b, err := ioutil.ReadAll(NewJSONLogReader(strings.NewReader(line.in), line.fields))
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareString(t, line.want, string(b))
+		})
+	}
+}
+
+func TestNewJSONLogReader_ScanSnapshot(t *testing.T) {
+	t.Parallel()
+	in := "{\"log\":\"goroutine 1 [running]:\\n\",\"stream\":\"stderr\"}\n" +
+		"{\"log\":\"main.main()\\n\",\"stream\":\"stderr\"}\n" +
+		"{\"log\":\"\\t/gopath/src/foo/main.go:8 +0x25\\n\",\"stream\":\"stderr\"}\n"
+	prefix := bytes.Buffer{}
+	s, _, err := ScanSnapshot(NewJSONLogReader(strings.NewReader(in), nil), &prefix, &Opts{})
+	if s == nil {
+		t.Fatal(err)
+	}
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{Calls: []Call{newCallOffset("main.main", Args{}, "/gopath/src/foo/main.go", 8, 0x25)}},
+			},
+			ID:    1,
+			First: true,
+			Input: InputRange{Offset: 0, End: 68, FirstLine: 1, LastLine: 3},
+		},
+	}
+	compareGoroutines(t, want, s.Goroutines)
+}
+
+func TestNewJSONLogReader_Zap(t *testing.T) {
+	t.Parallel()
+	in := "starting\n" + zapLine + "\n" + zapLine + "\n"
+	prefix := bytes.Buffer{}
+	s, suffix, err := ScanSnapshot(NewJSONLogReader(strings.NewReader(in), nil), &prefix, &Opts{})
+	if s == nil {
+		t.Fatal(err)
+	}
+	compareString(t, "starting\n", prefix.String())
+	calls := []Call{
+		newCall("main.run", Args{}, "/home/user/src/app/main.go", 27),
+		newCall("main.main", Args{}, "/home/user/src/app/main.go", 14),
+		newCall("runtime.main", Args{}, "/usr/local/go/src/runtime/proc.go", 267),
+	}
+	want := []*Goroutine{
+		{
+			Signature: Signature{State: "running", Stack: Stack{Calls: calls}},
+			ID:        1,
+			First:     true,
+			Input:     InputRange{Offset: 9, End: 165, FirstLine: 2, LastLine: 8},
+		},
+		{
+			Signature: Signature{State: "running", Stack: Stack{Calls: calls}},
+			ID:        2,
+			Input:     InputRange{Offset: 166, End: 322, FirstLine: 10, LastLine: 16},
+		},
+	}
+	compareGoroutines(t, want, s.Goroutines)
+	if suffix != nil || err != io.EOF {
+		t.Fatalf("%q, %v", suffix, err)
+	}
+}
+
+func TestNewJSONLogReader_DockerZap(t *testing.T) {
+	t.Parallel()
+	// Docker splits the zap log entry in two records.
+	in := dockerRecord(zapLine[:20]) + dockerRecord(zapLine[20:]+"\n")
+	prefix := bytes.Buffer{}
+	s, _, err := ScanSnapshot(NewJSONLogReader(strings.NewReader(in), nil), &prefix, &Opts{})
+	if s == nil {
+		t.Fatal(err)
+	}
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						newCall("main.run", Args{}, "/home/user/src/app/main.go", 27),
+						newCall("main.main", Args{}, "/home/user/src/app/main.go", 14),
+						newCall("runtime.main", Args{}, "/usr/local/go/src/runtime/proc.go", 267),
+					},
+				},
+			},
+			ID:    1,
+			First: true,
+			Input: InputRange{Offset: 0, End: 156, FirstLine: 1, LastLine: 7},
+		},
+	}
+	compareGoroutines(t, want, s.Goroutines)
+}
+
+// dockerRecord returns the Docker json-file record of the text v written by a
+// program running in a container.
+func dockerRecord(v string) string {
+	return fmt.Sprintf("{\"log\":%q,\"stream\":\"stderr\",\"time\":\"2024-01-02T03:04:05.123456789Z\"}\n", v)
+}
+
+// zapLine is a log entry as written by zap.NewProduction() with
+// logger.Error("request failed", zap.Error(err)).
+const zapLine = `{"level":"error","ts":1700000000.1234567,"caller":"app/main.go:27","msg":"request failed","error":"connection refused","stacktrace":"main.run\n\t/home/user/src/app/main.go:27\nmain.main\n\t/home/user/src/app/main.go:14\nruntime.main\n\t/usr/local/go/src/runtime/proc.go:267"}`
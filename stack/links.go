@@ -0,0 +1,314 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// LinkTemplate is an URL template to link to the source files of the
+// repositories hosted under an import path prefix.
+type LinkTemplate struct {
+	// Prefix is the import path prefix, e.g. "gitlab.com/". It should end with
+	// "/".
+	Prefix string
+	// RepoDepth is the number of path elements after Prefix that form the
+	// repository path. Defaults to 2 when 0, e.g. "user/project" for
+	// "github.com/".
+	RepoDepth int
+	// URL is the link to a source file. The following placeholders are
+	// replaced:
+	//   - {repo}: the repository path after Prefix, e.g. "user/project".
+	//   - {ref}: the git reference, e.g. a tag, a commit or "master".
+	//   - {path}: the path of the file inside the repository. The major
+	//     version suffix of the module path, e.g. "/v2", is removed.
+	//   - {line}: the line number.
+	URL string
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// DocServer is a documentation server, like pkgsite or godoc, serving the
+// packages under an import path prefix.
+type DocServer struct {
+	// Prefix is the import path prefix, e.g. "git.example.com/". An empty
+	// prefix matches all the packages, including the standard library.
+	Prefix string
+	// DocURL is the base URL of the package documentation, e.g.
+	// "https://pkgsite.example.com/". The import path is appended to it. The
+	// import path contains "@version" when the sources are in the module
+	// cache. It is ignored when empty.
+	DocURL string
+	// SrcURL is the base URL of the source files, e.g.
+	// "https://godoc.example.com/src/". The source path relative to
+	// $GOROOT/src, $GOPATH/src or the module cache and "#L<line>" are appended
+	// to it. It is ignored when empty.
+	SrcURL string
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// LinkResolver creates links to the source files hosted on the web.
+type LinkResolver struct {
+	// Templates are the URL templates to use. The template with the longest
+	// matching Prefix is used. When multiple templates have the same Prefix,
+	// the last one wins, so templates appended to DefaultLinkTemplates()
+	// override the default ones.
+	Templates []LinkTemplate
+	// DocServers are the documentation servers to use instead of
+	// golang.org/pkg, godoc.org, pkg.go.dev and the source hosting. The server
+	// with the longest matching Prefix is used.
+	DocServers []DocServer
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// DefaultLinkTemplates returns the built-in templates for github.com,
+// golang.org/x, gitlab.com, bitbucket.org, gitea.com, codeberg.org and
+// git.sr.ht.
+//
+// gopkg.in import paths are always redirected to github.com.
+func DefaultLinkTemplates() []LinkTemplate {
+	return []LinkTemplate{
+		{Prefix: "github.com/", URL: "https://github.com/{repo}/blob/{ref}/{path}#L{line}"},
+		// https://github.com/golang/build/blob/master/repos/repos.go lists all
+		// the golang.org/x/<foo> packages. The source of truth is are actually
+		// go.googlesource.com, but github.com has nicer syntax highlighting.
+		{Prefix: "golang.org/x/", RepoDepth: 1, URL: "https://github.com/golang/{repo}/blob/{ref}/{path}#L{line}"},
+		{Prefix: "gitlab.com/", URL: "https://gitlab.com/{repo}/-/blob/{ref}/{path}#L{line}"},
+		{Prefix: "bitbucket.org/", URL: "https://bitbucket.org/{repo}/src/{ref}/{path}#lines-{line}"},
+		{Prefix: "gitea.com/", URL: "https://gitea.com/{repo}/src/{ref}/{path}#L{line}"},
+		{Prefix: "codeberg.org/", URL: "https://codeberg.org/{repo}/src/{ref}/{path}#L{line}"},
+		{Prefix: "git.sr.ht/", URL: "https://git.sr.ht/{repo}/tree/{ref}/item/{path}#L{line}"},
+	}
+}
+
+// DefaultLinkResolver returns a LinkResolver using DefaultLinkTemplates().
+func DefaultLinkResolver() *LinkResolver {
+	return &LinkResolver{Templates: DefaultLinkTemplates()}
+}
+
+// SrcURL returns a link to the source file of the call on the web, or to the
+// file on disk if no template matches.
+//
+// Returns an empty string if the call has no source file.
+func (l *LinkResolver) SrcURL(c *Call) string {
+	if u := l.docSrcURL(c); u != "" {
+		return u
+	}
+	u, _ := l.srcBranchURL(c)
+	return string(u)
+}
+
+// SplitDocServer splits a documentation or source server in the form
+// [prefix=]URL into its prefix and its URL, to be used as a DocServer.
+func SplitDocServer(s string) (string, string) {
+	// The prefix cannot contain ':' while the URL always does.
+	if i := strings.IndexByte(s, '='); i != -1 && strings.IndexByte(s[:i], ':') == -1 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+// Private stuff.
+
+// docSrcURL returns a link to the source on the documentation server, if any.
+//
+// The URL is user provided, so it is returned as a string and not as a
+// template.URL, so html/template sanitizes it.
+func (l *LinkResolver) docSrcURL(c *Call) string {
+	if d := l.docServer(c.ImportPath, true); d != nil && c.RelSrcPath != "" {
+		return d.SrcURL + string(escape(stripVendor(c.RelSrcPath))) + "#L" + strconv.Itoa(c.Line)
+	}
+	return ""
+}
+
+// srcBranchURL returns a link to the source on the source hosting service and
+// the tag name for the package version, if possible.
+//
+// It ignores the DocServers, see docSrcURL.
+func (l *LinkResolver) srcBranchURL(c *Call) (template.URL, template.URL) {
+	tag := ""
+	if c.Location == Stdlib {
+		// ModuleVersion is set from Snapshot.RemoteGoVersion when it could be
+		// determined.
+		ver := c.ModuleVersion
+		if ver == "" {
+			// This is not strictly speaking correct. The remote could be running a
+			// different Go version from the current executable.
+			ver = runtime.Version()
+		}
+		tag = url.QueryEscape(goVersionTag(ver))
+		return template.URL(fmt.Sprintf("https://github.com/golang/go/blob/%s/src/%s#L%d", tag, escape(c.RelSrcPath), c.Line)), template.URL(tag)
+	}
+	// TODO(maruel): Leverage Location.
+	if rel := c.RelSrcPath; rel != "" {
+		rel = gopkgInToGitHub(stripVendor(rel))
+		if t := l.match(rel); t != nil {
+			if u, tag, ok := t.expand(rel[len(t.Prefix):], c); ok {
+				return u, tag
+			}
+			log.Printf("problematic %s URL: %q", t.Prefix, rel)
+		} else if i := strings.IndexByte(rel, '@'); i != -1 {
+			// In this case there's no known way to find the link to the source
+			// files, but we can still try to extract the version if fetched from a
+			// go module. Do a best effort to find a version by searching for a '@'.
+			if j := strings.IndexByte(rel[i:], '/'); j != -1 {
+				tag = rel[i+1 : i+j]
+			}
+		} else {
+			tag = c.ModuleVersion
+		}
+	}
+
+	if c.LocalSrcPath != "" {
+		return template.URL("file:///" + escape(c.LocalSrcPath)), template.URL(tag)
+	}
+	if c.RemoteSrcPath != "" {
+		return template.URL("file:///" + escape(c.RemoteSrcPath)), template.URL(tag)
+	}
+	return "", ""
+}
+
+// docServer returns the documentation server with the longest prefix
+// matching the import path imp, that has a SrcURL if src is true or a DocURL
+// otherwise.
+func (l *LinkResolver) docServer(imp string, src bool) *DocServer {
+	imp = stripVendor(imp)
+	var out *DocServer
+	for i := range l.DocServers {
+		d := &l.DocServers[i]
+		if (src && d.SrcURL == "") || (!src && d.DocURL == "") {
+			continue
+		}
+		if strings.HasPrefix(imp, d.Prefix) && (out == nil || len(d.Prefix) > len(out.Prefix)) {
+			out = d
+		}
+	}
+	return out
+}
+
+// stripVendor returns the path without the vendor directory prefix, if any.
+func stripVendor(p string) string {
+	if i := strings.Index(p, "/vendor/"); i != -1 {
+		return p[i+8:]
+	}
+	return p
+}
+
+// match returns the template with the longest prefix matching rel. The last
+// one wins on ties.
+func (l *LinkResolver) match(rel string) *LinkTemplate {
+	var out *LinkTemplate
+	for i := range l.Templates {
+		t := &l.Templates[i]
+		if strings.HasPrefix(rel, t.Prefix) && (out == nil || len(t.Prefix) >= len(out.Prefix)) {
+			out = t
+		}
+	}
+	return out
+}
+
+// expand returns the link to the file rest, which is the source path
+// relative to Prefix.
+func (t *LinkTemplate) expand(rest string, c *Call) (template.URL, template.URL, bool) {
+	depth := t.RepoDepth
+	if depth <= 0 {
+		depth = 2
+	}
+	parts := strings.Split(rest, "/")
+	// When the file is in the module cache, the '@' denotes the end of the
+	// module path. The module may be in a subdirectory of the repository.
+	end := depth
+	for i, p := range parts {
+		if strings.IndexByte(p, '@') != -1 {
+			end = i + 1
+			break
+		}
+	}
+	if end < depth || len(parts) <= end {
+		return "", "", false
+	}
+	name, srcTag, tag := splitTag(parts[end-1], c.ModuleVersion)
+	parts[end-1] = name
+	if end > depth && isMajorVersion(name) {
+		// The major version suffix of the module path, e.g. "/v2", is not a
+		// directory in the repository.
+		parts = append(parts[:end-1], parts[end:]...)
+	}
+	repo := strings.Join(parts[:depth], "/")
+	p := strings.Join(parts[depth:], "/")
+	r := strings.NewReplacer(
+		"{repo}", string(escape(repo)),
+		"{ref}", srcTag,
+		"{path}", string(escape(p)),
+		"{line}", strconv.Itoa(c.Line))
+	return template.URL(r.Replace(t.URL)), tag, true
+}
+
+// isMajorVersion returns true if s is the major version suffix of a module
+// path, e.g. "v2".
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' || s[1] == '0' || s == "v1" {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// gopkgInToGitHub converts a gopkg.in path to the corresponding github.com
+// path, using the major version as the git reference if no version is
+// present.
+//
+// "gopkg.in/pkg.v1/foo.go" is at "github.com/go-pkg/pkg" and
+// "gopkg.in/user/pkg.v1/foo.go" is at "github.com/user/pkg".
+//
+// See https://labix.org/gopkg.in.
+func gopkgInToGitHub(rel string) string {
+	const prefix = "gopkg.in/"
+	if !strings.HasPrefix(rel, prefix) {
+		return rel
+	}
+	parts := strings.SplitN(rel[len(prefix):], "/", 3)
+	user := ""
+	if len(parts) == 3 && strings.Index(parts[0], ".v") == -1 {
+		user = parts[0]
+		parts = parts[1:]
+	} else if len(parts) == 3 {
+		parts = []string{parts[0], parts[1] + "/" + parts[2]}
+	}
+	if len(parts) != 2 {
+		return rel
+	}
+	pkg, ver := parts[0], ""
+	if i := strings.IndexByte(pkg, '@'); i != -1 {
+		pkg, ver = pkg[:i], pkg[i+1:]
+	}
+	i := strings.LastIndex(pkg, ".v")
+	if i == -1 {
+		return rel
+	}
+	if ver == "" {
+		ver = pkg[i+1:]
+	}
+	pkg = pkg[:i]
+	if user == "" {
+		user = "go-" + pkg
+	}
+	return "github.com/" + user + "/" + pkg + "@" + ver + "/" + parts[1]
+}
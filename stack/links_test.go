@@ -0,0 +1,211 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"fmt"
+	"html/template"
+	"testing"
+)
+
+func TestLinkResolver(t *testing.T) {
+	t.Parallel()
+	l := &LinkResolver{
+		Templates: append(
+			DefaultLinkTemplates(),
+			LinkTemplate{Prefix: "git.example.com/", RepoDepth: 1, URL: "https://git.example.com/r/{repo}/+/{ref}/{path}#{line}"},
+			LinkTemplate{Prefix: "github.com/corp/", RepoDepth: 1, URL: "https://ghe.example.com/corp/{repo}/blob/{ref}/{path}#L{line}"},
+			// Overrides the default template.
+			LinkTemplate{Prefix: "gitlab.com/", URL: "https://gitlab.example.com/{repo}/-/blob/{ref}/{path}#L{line}"},
+		),
+	}
+	data := []struct {
+		name        string
+		rel         string
+		url, branch template.URL
+	}{
+		{
+			"gitlab_override",
+			"gitlab.com/group/project@v1.2.3/pkg/a.go",
+			"https://gitlab.example.com/group/project/-/blob/v1.2.3/pkg/a.go#L10",
+			"v1.2.3",
+		},
+		{
+			"bitbucket",
+			"bitbucket.org/user/repo/a.go",
+			"https://bitbucket.org/user/repo/src/master/a.go#lines-10",
+			"master",
+		},
+		{
+			"gitea",
+			"gitea.com/user/repo@v0.1.0/a.go",
+			"https://gitea.com/user/repo/src/v0.1.0/a.go#L10",
+			"v0.1.0",
+		},
+		{
+			"codeberg",
+			"codeberg.org/user/repo@v0.1.0/a.go",
+			"https://codeberg.org/user/repo/src/v0.1.0/a.go#L10",
+			"v0.1.0",
+		},
+		{
+			"sourcehut",
+			"git.sr.ht/~user/repo@v0.1.0/a.go",
+			"https://git.sr.ht/~user/repo/tree/v0.1.0/item/a.go#L10",
+			"v0.1.0",
+		},
+		{
+			"gopkg.in",
+			"gopkg.in/yaml.v2@v2.4.0/decode.go",
+			"https://github.com/go-yaml/yaml/blob/v2.4.0/decode.go#L10",
+			"v2.4.0",
+		},
+		{
+			"gopkg.in_user",
+			"gopkg.in/user/pkg.v3/sub/a.go",
+			"https://github.com/user/pkg/blob/v3/sub/a.go#L10",
+			"v3",
+		},
+		{
+			"module_subdir",
+			"github.com/user/repo/sub@v1.0.0/a.go",
+			"https://github.com/user/repo/blob/v1.0.0/sub/a.go#L10",
+			"v1.0.0",
+		},
+		{
+			"major_version",
+			"github.com/user/repo/v2@v2.1.0/pkg/a.go",
+			"https://github.com/user/repo/blob/v2.1.0/pkg/a.go#L10",
+			"v2.1.0",
+		},
+		{
+			"major_version_subdir",
+			"github.com/user/repo/sub/v3@v3.0.0/a.go",
+			"https://github.com/user/repo/blob/v3.0.0/sub/a.go#L10",
+			"v3.0.0",
+		},
+		{
+			"major_version_directory",
+			"github.com/user/repo/v2/a.go",
+			"https://github.com/user/repo/blob/master/v2/a.go#L10",
+			"master",
+		},
+		{
+			"custom",
+			"git.example.com/infra@v0.0.0-20200223170610-d5e6a3e2c0ae/cmd/a.go",
+			"https://git.example.com/r/infra/+/d5e6a3e2c0ae/cmd/a.go#10",
+			"v0.0.0-20200223170610-d5e6a3e2c0ae",
+		},
+		{
+			"longest_prefix",
+			"github.com/corp/repo/a.go",
+			"https://ghe.example.com/corp/repo/blob/master/a.go#L10",
+			"master",
+		},
+		{
+			"unknown",
+			"example.com/foo@v1.0.0/a.go",
+			"file:///example.com/foo@v1.0.0/a.go",
+			"v1.0.0",
+		},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
+			t.Parallel()
+			c := Call{RelSrcPath: line.rel, RemoteSrcPath: line.rel, Line: 10, Location: GoPkg}
+			url, branch := l.srcBranchURL(&c)
+			if url != line.url {
+				t.Errorf("%q != %q", url, line.url)
+			}
+			if branch != line.branch {
+				t.Errorf("%q != %q", branch, line.branch)
+			}
+			if got := l.SrcURL(&c); got != string(line.url) {
+				t.Errorf("%q != %q", got, line.url)
+			}
+		})
+	}
+}
+
+func TestLinkResolver_DocServers(t *testing.T) {
+	t.Parallel()
+	l := DefaultLinkResolver()
+	l.DocServers = []DocServer{
+		{DocURL: "https://godoc.example.com/pkg/", SrcURL: "https://godoc.example.com/src/"},
+		{Prefix: "git.example.com/", DocURL: "https://pkgsite.example.com/"},
+	}
+	data := []struct {
+		name   string
+		c      Call
+		url    string
+		pkgURL string
+	}{
+		{
+			"stdlib",
+			Call{
+				Func:       newFunc("net/http.(*Server).Serve"),
+				RelSrcPath: "net/http/server.go",
+				Line:       2933,
+				ImportPath: "net/http",
+				Location:   Stdlib,
+			},
+			"https://godoc.example.com/src/net/http/server.go#L2933",
+			"https://godoc.example.com/pkg/net/http#Server.Serve",
+		},
+		{
+			"private",
+			Call{
+				Func:       newFunc("git.example.com/infra/pkg.Foo"),
+				RelSrcPath: "git.example.com/infra/pkg@v1.0.0/foo.go",
+				Line:       10,
+				ImportPath: "git.example.com/infra/pkg@v1.0.0",
+				Location:   GoPkg,
+			},
+			"https://godoc.example.com/src/git.example.com/infra/pkg@v1.0.0/foo.go#L10",
+			"https://pkgsite.example.com/git.example.com/infra/pkg@v1.0.0#Foo",
+		},
+		{
+			"vendor",
+			Call{
+				Func:       newFunc("example.com/foo/vendor/git.example.com/infra/pkg.Foo"),
+				RelSrcPath: "example.com/foo/vendor/git.example.com/infra/pkg/foo.go",
+				Line:       10,
+				ImportPath: "example.com/foo/vendor/git.example.com/infra/pkg",
+				Location:   GOPATH,
+			},
+			"https://godoc.example.com/src/git.example.com/infra/pkg/foo.go#L10",
+			"https://pkgsite.example.com/git.example.com/infra/pkg#Foo",
+		},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
+			t.Parallel()
+			if url := l.srcURL(&line.c); url != line.url {
+				t.Errorf("%q != %q", url, line.url)
+			}
+			if url := l.pkgURL(&line.c); url != line.pkgURL {
+				t.Errorf("%q != %q", url, line.pkgURL)
+			}
+		})
+	}
+}
+
+func TestSplitDocServer(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in, prefix, url string
+	}{
+		{"https://pkgsite.example.com/", "", "https://pkgsite.example.com/"},
+		{"https://example.com/?a=b", "", "https://example.com/?a=b"},
+		{"git.example.com/=https://pkgsite.example.com/", "git.example.com/", "https://pkgsite.example.com/"},
+	}
+	for _, line := range data {
+		if prefix, url := SplitDocServer(line.in); prefix != line.prefix || url != line.url {
+			t.Errorf("SplitDocServer(%q) = %q, %q", line.in, prefix, url)
+		}
+	}
+}
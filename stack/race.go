@@ -0,0 +1,203 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// RaceReport is one data race report printed by the race detector, between
+// two "==================" lines.
+type RaceReport struct {
+	// Current is the memory access that triggered the report. Its Stack is the
+	// access and CreatedBy is where the goroutine was created.
+	Current *Goroutine
+	// Previous is the conflicting memory access that happened before. It is nil
+	// if it was not reported.
+	Previous *Goroutine
+	// Location is the memory that was raced on. It is nil if it was not
+	// reported.
+	Location *RaceLocation
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// Accesses returns the conflicting memory accesses, Current then Previous if
+// it was reported.
+func (r *RaceReport) Accesses() []*Goroutine {
+	if r.Previous == nil {
+		return []*Goroutine{r.Current}
+	}
+	return []*Goroutine{r.Current, r.Previous}
+}
+
+// Shared returns true if the call is in both access stacks, e.g. a common
+// caller of the conflicting accesses.
+//
+// The arguments are ignored.
+func (r *RaceReport) Shared(c *Call) bool {
+	if r.Previous == nil || c.Func.Complete == "" {
+		// Stacks that failed to be restored are not shared.
+		return false
+	}
+	return hasCall(&r.Current.Stack, c) && hasCall(&r.Previous.Stack, c)
+}
+
+// RaceLocation is the memory location of a data race, either a heap block or
+// a global variable.
+//
+// The goroutine of the main function is printed by the race detector as "main
+// goroutine" and is reported with ID 1.
+//
+// When the race detector failed to restore a stack, it is represented with a
+// single Call with RemoteSrcPath set to "<unavailable>", like a goroutine
+// running on another thread. When it failed to restore the stack where a
+// goroutine was created, CreatedBy is left empty.
+type RaceLocation struct {
+	// Global is the name of the global variable, e.g. "main.x". It is empty for
+	// a heap block.
+	Global string
+	// Size is the size in bytes of the heap block or the global variable.
+	Size uint64
+	// Addr is the start address of the heap block or the global variable. The
+	// address raced on, Goroutine.RaceAddr, is inside it.
+	Addr uint64
+	// AllocatedBy is the ID of the goroutine that allocated the heap block. It
+	// is 0 for a global variable.
+	AllocatedBy int
+	// Stack is where the heap block was allocated. For a global variable, it
+	// is a single Call to where the variable is declared, with Func set to the
+	// variable name.
+	Stack Stack
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// RaceBucket is a set of data race reports with the same access stacks.
+type RaceBucket struct {
+	// RaceReport is the first report found.
+	*RaceReport
+	// Count is the number of occurrences of this data race.
+	Count int
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// RaceReports is a set of deduplicated data race reports.
+//
+// The zero value is ready to use.
+type RaceReports struct {
+	// Buckets are the unique data races, in the order they were first found.
+	Buckets []*RaceBucket
+	// Total is the number of reports added.
+	Total int
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// Add adds a data race report.
+//
+// Reports are deduplicated by the pair of access stacks, in any order, so the
+// goroutine IDs and the memory address do not matter.
+//
+// Returns true if the data race was not seen before.
+func (r *RaceReports) Add(rr *RaceReport) bool {
+	r.Total++
+	for _, b := range r.Buckets {
+		if b.similar(rr) {
+			b.Count++
+			return false
+		}
+	}
+	r.Buckets = append(r.Buckets, &RaceBucket{RaceReport: rr, Count: 1})
+	return true
+}
+
+// String returns a summary like "12 unique races, 340 occurrences".
+func (r *RaceReports) String() string {
+	races := "races"
+	if len(r.Buckets) == 1 {
+		races = "race"
+	}
+	occurrences := "occurrences"
+	if r.Total == 1 {
+		occurrences = "occurrence"
+	}
+	return fmt.Sprintf("%d unique %s, %d %s", len(r.Buckets), races, r.Total, occurrences)
+}
+
+// ScanRaceReports scans in for all the data race reports, like the output of
+// "go test -race".
+//
+// Anything that is not a data race report is piped into prefix, except
+// goroutine snapshots that are skipped.
+func ScanRaceReports(in io.Reader, prefix io.Writer, opts *Opts) (*RaceReports, error) {
+	out := &RaceReports{}
+	for {
+		s, suffix, err := ScanSnapshot(in, prefix, opts)
+		if s != nil && s.Race != nil {
+			out.Add(s.Race)
+		}
+		if err == io.EOF {
+			_, err = prefix.Write(suffix)
+			return out, err
+		}
+		if err != nil {
+			return out, err
+		}
+		in = io.MultiReader(bytes.NewReader(suffix), in)
+	}
+}
+
+// Private stuff.
+
+// newRaceReport returns the race report from the goroutines and the memory
+// location parsed from a data race report.
+func newRaceReport(goroutines []*Goroutine, loc *RaceLocation) *RaceReport {
+	if len(goroutines) == 0 || goroutines[0].RaceAddr == 0 {
+		return nil
+	}
+	r := &RaceReport{Current: goroutines[0], Location: loc}
+	if len(goroutines) > 1 {
+		r.Previous = goroutines[1]
+	}
+	return r
+}
+
+// similar returns true if both reports have the same access stacks.
+//
+// When the accesses are swapped, their types are not compared: the same racy
+// pair, like two goroutines running "t.x++", can be reported as a read
+// racing with a write or as a write racing with a write.
+func (r *RaceReport) similar(o *RaceReport) bool {
+	return (sameAccess(r.Current, o.Current, true) && sameAccess(r.Previous, o.Previous, true)) ||
+		(sameAccess(r.Current, o.Previous, false) && sameAccess(r.Previous, o.Current, false))
+}
+
+// sameAccess returns true if both accesses have the same stack and, if kind
+// is true, the same type.
+func sameAccess(a, b *Goroutine, kind bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return (!kind || a.RaceWrite == b.RaceWrite) && a.Stack.similar(&b.Stack, AnyValue)
+}
+
+// hasCall returns true if the stack contains a call to the same function at
+// the same source line.
+func hasCall(s *Stack, c *Call) bool {
+	for i := range s.Calls {
+		if s.Calls[i].Func.Complete == c.Func.Complete && s.Calls[i].RemoteSrcPath == c.RemoteSrcPath && s.Calls[i].Line == c.Line {
+			return true
+		}
+	}
+	return false
+}
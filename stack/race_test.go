@@ -0,0 +1,326 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/maruel/panicparse/v2/internal/internaltest"
+)
+
+func TestScanRaceReports(t *testing.T) {
+	t.Parallel()
+	race := string(internaltest.StaticPanicRaceOutput())
+	// Same race with different goroutine IDs and address.
+	other := strings.NewReplacer(
+		"goroutine 8", "goroutine 18",
+		"Goroutine 8", "Goroutine 18",
+		"0x00c000014100", "0x00c000014200",
+	).Replace(race)
+	// A different race.
+	different := strings.Replace(race, "main.go:137", "main.go:138", 1)
+	in := race + "junk\n" + other + different + race
+	prefix := bytes.Buffer{}
+	r, err := ScanRaceReports(strings.NewReader(in), &prefix, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "2 unique races, 4 occurrences", r.String())
+	if r.Buckets[0].Count != 3 || r.Buckets[1].Count != 1 {
+		t.Fatalf("unexpected counts %d, %d", r.Buckets[0].Count, r.Buckets[1].Count)
+	}
+	if r.Buckets[0].Current.ID != 8 || r.Buckets[0].Previous.ID != 7 {
+		t.Fatalf("unexpected first occurrence: %d, %d", r.Buckets[0].Current.ID, r.Buckets[0].Previous.ID)
+	}
+	if r.Buckets[0].Previous.RaceWrite != true || r.Buckets[0].Current.RaceWrite != false {
+		t.Fatal("unexpected access types")
+	}
+	compareString(t, "\nGOTRACEBACK=all\njunk\n\nGOTRACEBACK=all\n\nGOTRACEBACK=all\n\nGOTRACEBACK=all\n", prefix.String())
+}
+
+func TestScanRaceReports_Increment(t *testing.T) {
+	t.Parallel()
+	r, err := ScanRaceReports(strings.NewReader(staticRaceIncrement), &bytes.Buffer{}, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The read and the write of "t.x++" racing with the write of another
+	// goroutine are the same race.
+	compareString(t, "1 unique race, 2 occurrences", r.String())
+}
+
+func TestScanSnapshotGoroutinesThenRace(t *testing.T) {
+	t.Parallel()
+	in := "goroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:8 +0x25\n\n" + staticRaceIncrement
+	s, suffix, err := ScanSnapshot(strings.NewReader(in), &bytes.Buffer{}, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Goroutines) != 1 || s.Race != nil {
+		t.Fatalf("unexpected snapshot: %d goroutines, race %v", len(s.Goroutines), s.Race)
+	}
+	// The data race report is the next snapshot.
+	s, _, err = ScanSnapshot(bytes.NewReader(suffix), &bytes.Buffer{}, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Race == nil || s.Race.Current.ID != 9 || s.Race.Previous.ID != 10 {
+		t.Fatalf("unexpected race %v", s.Race)
+	}
+
+	sc, err := NewScanner(context.Background(), strings.NewReader(in), &bytes.Buffer{}, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for sc.Scan() {
+		ids = append(ids, sc.Goroutine().ID)
+	}
+	if err = sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{1, 9, 10, 9, 7}, ids); diff != "" {
+		t.Fatalf("Goroutines mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRaceReports_Add(t *testing.T) {
+	t.Parallel()
+	read := &Goroutine{
+		Signature: Signature{Stack: Stack{Calls: []Call{newCall("main.read", Args{}, "/src/main.go", 10)}}},
+		ID:        1,
+		RaceAddr:  0x1000,
+	}
+	write := &Goroutine{
+		Signature: Signature{Stack: Stack{Calls: []Call{newCall("main.write", Args{}, "/src/main.go", 20)}}},
+		ID:        2,
+		RaceWrite: true,
+		RaceAddr:  0x1000,
+	}
+	r := RaceReports{}
+	compareString(t, "0 unique races, 0 occurrences", r.String())
+	if !r.Add(&RaceReport{Current: read, Previous: write}) {
+		t.Fatal("expected new race")
+	}
+	compareString(t, "1 unique race, 1 occurrence", r.String())
+	// The order of the accesses doesn't matter.
+	if r.Add(&RaceReport{Current: write, Previous: read}) {
+		t.Fatal("expected duplicate race")
+	}
+	// A missing previous access is a different race.
+	if !r.Add(&RaceReport{Current: read}) {
+		t.Fatal("expected new race")
+	}
+	compareString(t, "2 unique races, 3 occurrences", r.String())
+}
+
+func TestScanSnapshotRaceLocation(t *testing.T) {
+	t.Parallel()
+	heap := "==================\n" +
+		"WARNING: DATA RACE\n" +
+		"Write at 0x00c0000b4018 by goroutine 7:\n" +
+		"  main.main.func1()\n" +
+		"      /src/main.go:12 +0x3c\n" +
+		"\n" +
+		"Previous read at 0x00c0000b4018 by main goroutine:\n" +
+		"  [failed to restore the stack]\n" +
+		"\n" +
+		"Heap block of size 16 at 0x00c0000b4010 allocated by main goroutine:\n" +
+		"  main.newFoo()\n" +
+		"      /src/main.go:5 +0x2e\n" +
+		"  main.main()\n" +
+		"      /src/main.go:10 +0x44\n" +
+		"\n" +
+		"Goroutine 7 (running) created at:\n" +
+		"  [failed to restore the stack]\n" +
+		"==================\n"
+	global := "==================\n" +
+		"WARNING: DATA RACE\n" +
+		"Read at 0x0000005f1e40 by goroutine 8:\n" +
+		"  main.main.func1()\n" +
+		"      /src/main.go:12 +0x3c\n" +
+		"\n" +
+		"Previous write at 0x0000005f1e40 by main goroutine:\n" +
+		"  main.main()\n" +
+		"      /src/main.go:14 +0x88\n" +
+		"\n" +
+		"Global var main.x of size 8 at 0x0000005f1e40 declared at /src/main.go:3\n" +
+		"\n" +
+		"Goroutine 8 (running) created at:\n" +
+		"  main.main()\n" +
+		"      /src/main.go:11 +0x7a\n" +
+		"==================\n"
+	unavailable := Stack{Calls: []Call{{RemoteSrcPath: "<unavailable>"}}}
+	data := []struct {
+		name     string
+		in       string
+		current  *Goroutine
+		previous *Goroutine
+		location *RaceLocation
+	}{
+		{
+			"Heap",
+			heap,
+			&Goroutine{
+				Signature: Signature{
+					State: "running",
+					Stack: Stack{Calls: []Call{newCallOffset("main.main.func1", Args{}, "/src/main.go", 12, 0x3c)}},
+				},
+				ID:        7,
+				First:     true,
+				RaceWrite: true,
+				RaceAddr:  0xc0000b4018,
+				Input:     InputRange{Offset: 38, End: 126, FirstLine: 3, LastLine: 5},
+			},
+			&Goroutine{
+				Signature: Signature{Stack: unavailable},
+				ID:        1,
+				RaceAddr:  0xc0000b4018,
+				Input:     InputRange{Offset: 127, End: 210, FirstLine: 7, LastLine: 8},
+			},
+			&RaceLocation{
+				Size:        16,
+				Addr:        0xc0000b4010,
+				AllocatedBy: 1,
+				Stack: Stack{
+					Calls: []Call{
+						newCallOffset("main.newFoo", Args{}, "/src/main.go", 5, 0x2e),
+						newCallOffset("main.main", Args{}, "/src/main.go", 10, 0x44),
+					},
+				},
+			},
+		},
+		{
+			"Global",
+			global,
+			&Goroutine{
+				Signature: Signature{
+					State:     "running",
+					CreatedBy: Stack{Calls: []Call{newCallOffset("main.main", Args{}, "/src/main.go", 11, 0x7a)}},
+					Stack:     Stack{Calls: []Call{newCallOffset("main.main.func1", Args{}, "/src/main.go", 12, 0x3c)}},
+				},
+				ID:       8,
+				First:    true,
+				RaceAddr: 0x5f1e40,
+				Input:    InputRange{Offset: 38, End: 125, FirstLine: 3, LastLine: 5},
+			},
+			&Goroutine{
+				Signature: Signature{Stack: Stack{Calls: []Call{newCallOffset("main.main", Args{}, "/src/main.go", 14, 0x88)}}},
+				ID:        1,
+				RaceWrite: true,
+				RaceAddr:  0x5f1e40,
+				Input:     InputRange{Offset: 126, End: 220, FirstLine: 7, LastLine: 9},
+			},
+			&RaceLocation{
+				Global: "main.x",
+				Size:   8,
+				Addr:   0x5f1e40,
+				Stack:  Stack{Calls: []Call{newCall("main.x", Args{}, "/src/main.go", 3)}},
+			},
+		},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
+			t.Parallel()
+			prefix := bytes.Buffer{}
+			s, suffix, err := ScanSnapshot(strings.NewReader(line.in+"junk\n"), &prefix, &Opts{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareString(t, "", prefix.String())
+			compareString(t, "junk\n", string(suffix))
+			if s.Race == nil {
+				t.Fatal("expected race")
+			}
+			compareGoroutines(t, []*Goroutine{line.current}, []*Goroutine{s.Race.Current})
+			compareGoroutines(t, []*Goroutine{line.previous}, []*Goroutine{s.Race.Previous})
+			if diff := cmp.Diff(line.location, s.Race.Location); diff != "" {
+				t.Fatalf("Mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// staticRaceIncrement is the output of:
+//
+//	go build -race -o r main.go
+//	GOMAXPROCS=4 ./r
+//
+// with main.go being:
+//
+//	package main
+//
+//	import "sync"
+//
+//	type T struct{ x int }
+//
+//	func inc(t *T, wg *sync.WaitGroup) {
+//		defer wg.Done()
+//		for i := 0; i < 3000000; i++ {
+//			t.x++
+//		}
+//	}
+//
+//	func main() {
+//		t := &T{}
+//		wg := sync.WaitGroup{}
+//		for i := 0; i < 4; i++ {
+//			wg.Add(1)
+//			go inc(t, &wg)
+//		}
+//		wg.Wait()
+//	}
+const staticRaceIncrement = `==================
+WARNING: DATA RACE
+Read at 0x00c00009e008 by goroutine 9:
+  main.inc()
+      /tmp/race/main.go:10 +0x8e
+  main.main.gowrap1()
+      /tmp/race/main.go:19 +0x38
+
+Previous write at 0x00c00009e008 by goroutine 10:
+  main.inc()
+      /tmp/race/main.go:10 +0xa4
+  main.main.gowrap1()
+      /tmp/race/main.go:19 +0x38
+
+Goroutine 9 (running) created at:
+  main.main()
+      /tmp/race/main.go:19 +0x78
+
+Goroutine 10 (running) created at:
+  main.main()
+      /tmp/race/main.go:19 +0x78
+==================
+==================
+WARNING: DATA RACE
+Write at 0x00c00009e008 by goroutine 9:
+  main.inc()
+      /tmp/race/main.go:10 +0xa4
+  main.main.gowrap1()
+      /tmp/race/main.go:19 +0x38
+
+Previous write at 0x00c00009e008 by goroutine 7:
+  main.inc()
+      /tmp/race/main.go:10 +0xa4
+  main.main.gowrap1()
+      /tmp/race/main.go:19 +0x38
+
+Goroutine 9 (running) created at:
+  main.main()
+      /tmp/race/main.go:19 +0x78
+
+Goroutine 7 (running) created at:
+  main.main()
+      /tmp/race/main.go:19 +0x78
+==================
+Found 2 data race(s)
+`
@@ -0,0 +1,121 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Cycle is a sequence of calls in a Stack.
+//
+// When Count is 2 or more, the calls are repeated consecutively, as seen with
+// an infinite recursion leading to "goroutine stack exceeds 1000000000-byte
+// limit".
+type Cycle struct {
+	// Start is the index in Stack.Calls of the first call.
+	Start int
+	// Calls are the calls of one repetition. It is a subslice of Stack.Calls.
+	Calls []Call
+	// Count is the number of consecutive repetitions of Calls. It is 1 for
+	// calls that are not repeated.
+	//
+	// When Stack.Elided is set, it is a lower bound.
+	Count int
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// End returns the index in Stack.Calls following the last repetition.
+func (c *Cycle) End() int {
+	return c.Start + len(c.Calls)*c.Count
+}
+
+// String returns a compact representation of the cycle, e.g.
+// "main.a → main.b → main.c ×312".
+func (c *Cycle) String() string {
+	names := make([]string, len(c.Calls))
+	for i := range c.Calls {
+		names[i] = c.Calls[i].Func.DirName + "." + c.Calls[i].Func.Name
+	}
+	out := strings.Join(names, " → ")
+	if c.Count > 1 {
+		out += " ×" + strconv.Itoa(c.Count)
+	}
+	return out
+}
+
+// Cycles returns the sequences of calls repeated consecutively in the stack,
+// in order.
+//
+// Calls are compared by function and source line; the arguments are ignored
+// since they usually differ at each recursion level.
+func (s *Stack) Cycles() []Cycle {
+	var out []Cycle
+	for _, c := range s.Compact() {
+		if c.Count > 1 {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Compact returns the stack split in consecutive sequences, so that each
+// recursion cycle is a single Cycle with a Count of 2 or more. The calls that
+// are not repeated are grouped in a Cycle with a Count of 1.
+//
+// When multiple cycles are possible at a position, the one covering the most
+// calls is used, then the shortest one.
+func (s *Stack) Compact() []Cycle {
+	var out []Cycle
+	last := 0
+	for i := 0; i < len(s.Calls); {
+		l, n := s.cycleAt(i)
+		if n < 2 {
+			i++
+			continue
+		}
+		if last != i {
+			out = append(out, Cycle{Start: last, Calls: s.Calls[last:i], Count: 1})
+		}
+		out = append(out, Cycle{Start: i, Calls: s.Calls[i : i+l], Count: n})
+		i += l * n
+		last = i
+	}
+	if last != len(s.Calls) {
+		out = append(out, Cycle{Start: last, Calls: s.Calls[last:], Count: 1})
+	}
+	return out
+}
+
+// Private stuff.
+
+// cycleAt returns the length and the number of repetitions of the cycle
+// starting at index i that covers the most calls.
+func (s *Stack) cycleAt(i int) (int, int) {
+	bestL, bestN := 0, 0
+	for l := 1; i+2*l <= len(s.Calls); l++ {
+		n := 1
+		for i+(n+1)*l <= len(s.Calls) && sameFrames(s.Calls[i:i+l], s.Calls[i+n*l:i+(n+1)*l]) {
+			n++
+		}
+		if n > 1 && l*n > bestL*bestN {
+			bestL, bestN = l, n
+		}
+	}
+	return bestL, bestN
+}
+
+// sameFrames returns true if both slices of calls are at the same source
+// lines, ignoring the arguments.
+func sameFrames(a, b []Call) bool {
+	for i := range a {
+		if a[i].Line != b[i].Line || a[i].Func.Complete != b[i].Func.Complete || a[i].RemoteSrcPath != b[i].RemoteSrcPath {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStack_Compact(t *testing.T) {
+	t.Parallel()
+	a := newCall("main.a", Args{Values: []Arg{{Value: 1}}}, "/gopath/src/foo/main.go", 10)
+	a2 := newCall("main.a", Args{Values: []Arg{{Value: 2}}}, "/gopath/src/foo/main.go", 10)
+	b := newCall("main.b", Args{}, "/gopath/src/foo/main.go", 20)
+	c := newCall("main.c", Args{}, "/gopath/src/foo/main.go", 30)
+	m := newCall("main.main", Args{}, "/gopath/src/foo/main.go", 40)
+	// (start, length, count) triplets.
+	data := []struct {
+		name  string
+		calls []Call
+		want  [][3]int
+	}{
+		{"Empty", nil, nil},
+		{"NoCycle", []Call{a, b, c, m}, [][3]int{{0, 4, 1}}},
+		{"Direct", []Call{a, a2, a, a2, m}, [][3]int{{0, 1, 4}, {4, 1, 1}}},
+		{"Mutual", []Call{c, a, b, a, b, a, b, m}, [][3]int{{0, 1, 1}, {1, 2, 3}, {7, 1, 1}}},
+		{"Rotated", []Call{b, c, a, b, c, a, b, c}, [][3]int{{0, 3, 2}, {6, 2, 1}}},
+		{"Nested", []Call{a, a, b, a, a, b, a, a, b}, [][3]int{{0, 3, 3}}},
+		{"Twice", []Call{a, a, b, c, c, m}, [][3]int{{0, 1, 2}, {2, 1, 1}, {3, 1, 2}, {5, 1, 1}}},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
+			t.Parallel()
+			s := Stack{Calls: line.calls}
+			var got [][3]int
+			for _, c := range s.Compact() {
+				got = append(got, [3]int{c.Start, len(c.Calls), c.Count})
+			}
+			if diff := cmp.Diff(line.want, got); diff != "" {
+				t.Fatalf("Compact() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStack_Cycles(t *testing.T) {
+	t.Parallel()
+	a := newCall("main.a", Args{}, "/gopath/src/foo/main.go", 10)
+	b := newCall("main.b", Args{}, "/gopath/src/foo/main.go", 20)
+	m := newCall("main.main", Args{}, "/gopath/src/foo/main.go", 40)
+	s := Stack{Calls: []Call{a, b, a, b, a, b, m}}
+	got := s.Cycles()
+	if len(got) != 1 {
+		t.Fatalf("unexpected cycles: %v", got)
+	}
+	if got[0].End() != 6 {
+		t.Fatalf("unexpected End(): %d", got[0].End())
+	}
+	compareString(t, "main.a → main.b ×3", got[0].String())
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Scanner reads the goroutines of the snapshots found in a stream one at a
+// time.
+//
+// Contrary to ScanSnapshot, which keeps all the goroutines of a snapshot in
+// memory, Scanner only keeps the goroutine being parsed, so dumps larger than
+// the available memory can be filtered or aggregated on the fly. It continues
+// with the next snapshot when one ends.
+//
+// The goroutines are returned in the order they are printed, except the one
+// that received a signal, which is returned after its register dump.
+//
+// The processing that requires all the goroutines of a snapshot is not done:
+// Opts.NameArguments and Opts.Binary are ignored and the roots used by
+// Opts.GuessPaths are found incrementally. Snapshot.Race is only set once all
+// the goroutines of a data race report were returned.
+type Scanner struct {
+	ctx    context.Context
+	r      reader
+	prefix io.Writer
+	opts   *Opts
+	state  scanningState
+	cache  cacheAST
+	ready  []scannedGoroutine
+	cur    scannedGoroutine
+	err    error
+	// line is the number of lines read and offset the number of bytes read
+	// before the current line.
+	line   int
+	offset int64
+}
+
+// NewScanner returns a Scanner reading from in.
+//
+// The lines that are not part of a snapshot are written to prefix. The scan
+// stops when ctx is canceled; it is checked between each line.
+func NewScanner(ctx context.Context, in io.Reader, prefix io.Writer, opts *Opts) (*Scanner, error) {
+	if opts == nil || !opts.isValid() {
+		return nil, errors.New("invalid Opts")
+	}
+	return &Scanner{
+		ctx:    ctx,
+		r:      reader{rd: in},
+		prefix: prefix,
+		opts:   opts,
+		state:  newScanningState(opts, nil),
+		line:   opts.InputLine,
+		offset: opts.InputOffset,
+		cache: cacheAST{
+			files:  map[string][]byte{},
+			parsed: map[string]*parsedFile{},
+		},
+	}, nil
+}
+
+// Scan advances to the next goroutine, which is then available through
+// Goroutine().
+//
+// It returns false at the end of the stream, on error or when the context is
+// canceled. Err() returns the error, if any.
+func (s *Scanner) Scan() bool {
+	s.cur = scannedGoroutine{}
+	for {
+		if err := s.ctx.Err(); err != nil {
+			if s.err == nil {
+				s.err = err
+			}
+			return false
+		}
+		if len(s.ready) != 0 {
+			break
+		}
+		if s.err != nil {
+			return false
+		}
+		s.step()
+	}
+	s.cur = s.ready[0]
+	s.ready[0] = scannedGoroutine{}
+	s.ready = s.ready[1:]
+	return true
+}
+
+// Goroutine returns the goroutine found by the last call to Scan().
+func (s *Scanner) Goroutine() *Goroutine {
+	return s.cur.g
+}
+
+// Snapshot returns the snapshot containing the goroutine found by the last
+// call to Scan().
+//
+// Goroutines is not set. Diagnostics only contains the issues found so far.
+// The line numbers are relative to the start of the stream.
+func (s *Scanner) Snapshot() *Snapshot {
+	if s.cur.s == nil {
+		return nil
+	}
+	c := *s.cur.s
+	c.Goroutines = nil
+	return &c
+}
+
+// Err returns the first error that occurred, except io.EOF.
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// Private stuff.
+
+// scannedGoroutine is a goroutine ready to be returned.
+type scannedGoroutine struct {
+	g *Goroutine
+	s *Snapshot
+}
+
+// step reads and scans one line.
+func (s *Scanner) step() {
+	d, err := s.r.readLine()
+	if len(d) != 0 {
+		s.line++
+		if err1 := s.scanLine(d); err1 != nil {
+			err = err1
+		}
+		s.offset += int64(len(d))
+	}
+	if err != nil {
+		if err == io.EOF {
+			s.state.diagnoseEOF()
+		}
+		s.end()
+		s.err = err
+	}
+}
+
+// scanLine scans one line, starting a new snapshot as needed.
+func (s *Scanner) scanLine(d []byte) error {
+	s.state.line, s.state.offset = s.line, s.offset
+	l, err := s.state.scan(s.opts.stripLogPrefix(d))
+	if err != nil {
+		s.state.diagnoseLine(d, err)
+		return err
+	}
+	if !l && s.state.state != looking {
+		// The snapshot ended, the line may be the start of the next one.
+		s.state.diagnoseLine(d, nil)
+		s.end()
+		s.state.line, s.state.offset = s.line, s.offset
+		if l, err = s.state.scan(s.opts.stripLogPrefix(d)); err != nil {
+			s.state.diagnoseLine(d, err)
+			return err
+		}
+	}
+	if l {
+		s.state.record(d)
+	} else if _, err = s.prefix.Write(d); err != nil {
+		return err
+	}
+	if s.state.state == gotRoutineHeader {
+		s.flush(false)
+	}
+	return nil
+}
+
+// end returns the remaining goroutines of the current snapshot and starts a
+// new one.
+func (s *Scanner) end() {
+	if s.state.yielded == 0 {
+		s.state.Race = newRaceReport(s.state.Goroutines, s.state.raceLocation)
+	}
+	s.flush(true)
+	s.state = newScanningState(s.opts, nil)
+}
+
+// flush processes the goroutines that were completely parsed and queues them
+// to be returned.
+func (s *Scanner) flush(all bool) {
+	st := &s.state
+	n := len(st.Goroutines)
+	if !all {
+		// The last goroutine is still being parsed.
+		n--
+	}
+	if n <= 0 {
+		return
+	}
+	var out, keep []*Goroutine
+	for _, g := range st.Goroutines[:n] {
+		// Keep the goroutine that received the signal until its registers are
+		// parsed.
+		if !all && g == st.signaled && st.signal != "" {
+			keep = append(keep, g)
+			continue
+		}
+		out = append(out, g)
+	}
+	st.Goroutines = append(keep, st.Goroutines[n:]...)
+	if len(out) == 0 {
+		return
+	}
+	if len(st.stackErrors) != 0 {
+		st.attachStackErrors(out)
+	}
+	st.yielded += len(out)
+	s.process(out)
+	for _, g := range out {
+		delete(st.lines, g)
+		s.ready = append(s.ready, scannedGoroutine{g: g, s: st.Snapshot})
+	}
+}
+
+// process is the equivalent of the processing done by ScanSnapshot, for the
+// goroutines that do not depend on the other goroutines.
+func (s *Scanner) process(goroutines []*Goroutine) {
+	st := s.state.Snapshot
+	if s.opts.GuessPaths {
+		if st.RemoteGOPATHs == nil {
+			st.RemoteGOPATHs = map[string]string{}
+			st.LocalGomods = map[string]string{}
+		}
+		_ = st.addRoots(goroutines)
+		r := st.roots()
+		for _, g := range goroutines {
+			g.updateLocations(r)
+		}
+		s.state.diagnoseUnresolved(goroutines)
+	}
+	st.guessGoVersion(goroutines)
+	if s.opts.AnalyzeSources {
+		augmentGoroutines(&s.cache, goroutines, s.state.diagnoseAugment)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/v2/internal/internaltest"
+)
+
+func TestScanner(t *testing.T) {
+	t.Parallel()
+	in := strings.Join([]string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:8 +0x25",
+		"",
+		"goroutine 5 [chan receive]:",
+		"main.recv()",
+		"\t/gopath/src/foo/main.go:12 +0x25",
+		"created by main.main",
+		"\t/gopath/src/foo/main.go:7 +0x25",
+		"",
+		"goroutine 6 [chan receive]:",
+		"main.recv()",
+		"\t/gopath/src/foo/main.go:12 +0x25",
+		"exit status 2",
+		"SIGQUIT: quit",
+		"PC=0x46e2a3 m=0 sigcode=0",
+		"",
+		"goroutine 0 [idle]:",
+		"runtime.futex()",
+		"\t/goroot/src/runtime/sys_linux_amd64.s:557 +0x23",
+		"",
+		"goroutine 1 [select]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:9 +0x25",
+		"",
+		"rax    0xca",
+		"",
+	}, "\n")
+	prefix := bytes.Buffer{}
+	s, err := NewScanner(context.Background(), strings.NewReader(in), &prefix, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, diags []string
+	for s.Scan() {
+		g := s.Goroutine()
+		got = append(got, fmt.Sprintf("%d %t %s %d", g.ID, g.First, g.State, len(g.Registers)))
+		if g.ID == 6 {
+			for _, d := range s.Snapshot().Diagnostics {
+				diags = append(diags, d.String())
+			}
+		}
+		if s.Snapshot() == nil || s.Snapshot().Goroutines != nil {
+			t.Fatal("unexpected snapshot")
+		}
+		if l := len(s.state.Goroutines); l > 2 {
+			t.Fatalf("too many goroutines kept in memory: %d", l)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"1 true running 0",
+		"5 false chan receive 0",
+		"6 false chan receive 0",
+		"0 true idle 1",
+		"1 false select 0",
+	}
+	compareString(t, strings.Join(want, "\n"), strings.Join(got, "\n"))
+	compareString(t, `line 16: UnparsedLine "exit status 2": end of snapshot`, strings.Join(diags, "\n"))
+	compareString(t, "panic: oh no\n\nexit status 2\nSIGQUIT: quit\nPC=0x46e2a3 m=0 sigcode=0\n\n", prefix.String())
+}
+
+func TestScanner_Equivalent(t *testing.T) {
+	t.Parallel()
+	for _, in := range [][]byte{internaltest.StaticPanicwebOutput(), internaltest.StaticPanicRaceOutput()} {
+		want, _, err := ScanSnapshot(bytes.NewReader(in), ioutil.Discard, &Opts{})
+		if want == nil {
+			t.Fatal(err)
+		}
+		s, err := NewScanner(context.Background(), bytes.NewReader(in), ioutil.Discard, &Opts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []*Goroutine
+		for s.Scan() {
+			got = append(got, s.Goroutine())
+			if want.Race != nil && len(got) == len(want.Goroutines) {
+				if s.Snapshot().Race == nil {
+					t.Error("expected a race report")
+				}
+			}
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		compareGoroutines(t, want.Goroutines, got)
+	}
+}
+
+func TestScanner_Cancel(t *testing.T) {
+	t.Parallel()
+	in := "goroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:8 +0x25\n\n" +
+		"goroutine 5 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:8 +0x25\n\n"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := NewScanner(ctx, strings.NewReader(in), ioutil.Discard, &Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Scan() || s.Goroutine().ID != 1 {
+		t.Fatal("expected goroutine 1")
+	}
+	cancel()
+	if s.Scan() {
+		t.Fatal("expected Scan() to stop")
+	}
+	if s.Goroutine() != nil {
+		t.Fatal("expected no goroutine")
+	}
+	if err := s.Err(); err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewScanner_Invalid(t *testing.T) {
+	t.Parallel()
+	if _, err := NewScanner(context.Background(), strings.NewReader(""), ioutil.Discard, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func BenchmarkScanner(b *testing.B) {
+	b.ReportAllocs()
+	in := internaltest.StaticPanicwebOutput()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, err := NewScanner(context.Background(), bytes.NewReader(in), ioutil.Discard, &Opts{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for s.Scan() {
+		}
+		if err := s.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -28,8 +28,9 @@ func TestAugment(t *testing.T) {
 	newCallSrc := func(f string, a Args, s string, l int) Call {
 		c := newCall(f, a, s, l)
 		// Simulate findRoots().
-		if !c.updateLocations(goroot, goroot, gm, gopaths) {
-			t.Fatalf("c.updateLocations(%v, %v, %v, %v) failed on %s", goroot, goroot, gm, gopaths, s)
+		r := roots{remoteGOROOT: goroot, localGOROOT: goroot, localGomods: gm, remoteGOPATHs: gopaths}
+		if !c.updateLocations(&r) {
+			t.Fatalf("c.updateLocations(%v) failed on %s", r, s)
 		}
 		return c
 	}
@@ -602,7 +603,7 @@ func testAugmentCommon(t *testing.T, content []byte, mayBeInlined bool, want Sta
 		}
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, ignoreBuild); diff != "" {
 		t.Logf("Different (-want +got):\n%s", diff)
 		t.Logf("Output:\n%s", content)
 		t.FailNow()
@@ -12,7 +12,6 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"os"
 	"sort"
 	"strings"
 	"unicode"
@@ -37,6 +36,10 @@ type Func struct {
 	IsExported bool
 	// IsPkgMain is true if it is in the main package.
 	IsPkgMain bool
+	// IsRuntime is true if it is an unexported function of package runtime,
+	// like "runtime.gopark". These frames are hidden by the runtime unless
+	// GOTRACEBACK=system or higher is used or the runtime itself crashed.
+	IsRuntime bool
 
 	// Disallow initialization with unnamed parameters.
 	_ struct{}
@@ -94,6 +97,11 @@ func (f *Func) Init(raw string) error {
 		r, _ := utf8.DecodeRuneInString(parts[len(parts)-1])
 		f.IsExported = unicode.ToUpper(r) == r
 	}
+	// See showfuncinfo() and isExportedRuntime() in src/runtime/traceback.go.
+	if f.ImportPath == "runtime" {
+		r, _ := utf8.DecodeRuneInString(f.Name)
+		f.IsRuntime = !unicode.IsUpper(r)
+	}
 	return nil
 }
 
@@ -243,6 +251,9 @@ const (
 	LocationUnknown Location = iota
 	// GoMod is a go module, it is outside $GOPATH and is inside a directory
 	// containing a go.mod file. This is considered a local copy.
+	//
+	// This includes the main module of executables built with -trimpath and
+	// "bazel-out/" generated files from Bazel builds.
 	GoMod
 	// GOPATH is in $GOPATH/src. This is either a dependency fetched via
 	// GO111MODULE=off or intentionally fetched this way. There is no guaranteed
@@ -250,6 +261,9 @@ const (
 	GOPATH
 	// GoPkg is in $GOPATH/pkg/mod. This is a dependency fetched via go module.
 	// It is considered to be an unmodified external dependency.
+	//
+	// This includes "module@version/" paths from executables built with
+	// -trimpath and "external/" paths from Bazel builds.
 	GoPkg
 	// Stdlib is when it is a Go standard library function. This includes the 'go
 	// test' generated main executable.
@@ -281,6 +295,12 @@ type Call struct {
 	// DirSrc is one directory plus the file name of the source file. It is a
 	// subset of RemoteSrcPath.
 	DirSrc string
+	// PCOffset is the offset of the program counter from the function entry
+	// point, as printed with "+0x" in the trace. It is 0 when not printed.
+	PCOffset uint64
+	// PC is the absolute program counter, as printed with "pc=0x" for C calls
+	// or when the runtime is crashing. It is 0 when not printed.
+	PC uint64
 
 	// The following are only set if Opts.GuessPaths was set.
 
@@ -298,6 +318,16 @@ type Call struct {
 	// Location is the source location, if determined.
 	Location Location
 
+	// The following is only set if Opts.Binary was set.
+
+	// ModuleVersion is the version of the go module containing this call as
+	// built in the executable, as read from its build information. For the
+	// standard library, it is the Go version.
+	//
+	// For the main module built from a source tree, it is the VCS revision
+	// if available.
+	ModuleVersion string
+
 	// Disallow initialization with unnamed parameters.
 	_ struct{}
 }
@@ -317,33 +347,41 @@ func (c *Call) init(srcPath string, line int) {
 				c.DirSrc = c.RemoteSrcPath[i+1:]
 			}
 		}
-		if c.DirSrc == testMainSrc {
+		if c.DirSrc == testMainSrc || isLibgoPath(c.RemoteSrcPath) {
 			// Consider _test/_testmain.go as stdlib since it's injected by "go test".
+			// gccgo's runtime and standard library are in libgo.
 			c.Location = Stdlib
 		}
 	}
 	c.ImportPath = c.Func.ImportPath
 }
 
-const testMainSrc = "_test" + string(os.PathSeparator) + "_testmain.go"
+// testMainSrc is DirSrc for the main file injected by "go test". The remote
+// paths use "/" as path separator, independently of the host.
+const testMainSrc = "_test/_testmain.go"
 
 // updateLocations initializes LocalSrcPath, RelSrcPath, Location and ImportPath.
 //
-// goroot, localgoroot, localgomod, gomodImportPath and gopaths are expected to
-// be in "/" format even on Windows. They must not have a trailing "/".
-//
 // Returns true if a match was found.
-func (c *Call) updateLocations(goroot, localgoroot string, localgomods, gopaths map[string]string) bool {
+func (c *Call) updateLocations(r *roots) bool {
 	// TODO(maruel): Reduce memory allocations.
 	if c.RemoteSrcPath == "" {
 		return false
 	}
+	if isLibgoPath(c.RemoteSrcPath) {
+		// gccgo's standard library sources are rarely available locally. Keep
+		// the import path from the function name.
+		return false
+	}
+	if isTrimmedPath(c.RemoteSrcPath) {
+		return c.updateTrimmedLocations(r)
+	}
 	// Check GOROOT first.
-	if goroot != "" {
-		if prefix := goroot + "/src/"; strings.HasPrefix(c.RemoteSrcPath, prefix) {
+	if r.remoteGOROOT != "" {
+		if prefix := r.remoteGOROOT + "/src/"; hasFoldPrefix(c.RemoteSrcPath, prefix, r.fold) {
 			// Replace remote GOROOT with local GOROOT.
 			c.RelSrcPath = c.RemoteSrcPath[len(prefix):]
-			c.LocalSrcPath = pathJoin(localgoroot, "src", c.RelSrcPath)
+			c.LocalSrcPath = pathJoin(r.localGOROOT, "src", c.RelSrcPath)
 			if i := strings.LastIndexByte(c.RelSrcPath, '/'); i != -1 {
 				c.ImportPath = c.RelSrcPath[:i]
 			}
@@ -355,8 +393,8 @@ func (c *Call) updateLocations(goroot, localgoroot string, localgomods, gopaths
 	}
 	// Check GOPATH.
 	// TODO(maruel): Sort for deterministic behavior?
-	for prefix, dest := range gopaths {
-		if p := prefix + "/src/"; strings.HasPrefix(c.RemoteSrcPath, p) {
+	for prefix, dest := range r.remoteGOPATHs {
+		if p := prefix + "/src/"; hasFoldPrefix(c.RemoteSrcPath, p, r.fold) {
 			c.RelSrcPath = c.RemoteSrcPath[len(p):]
 			c.LocalSrcPath = pathJoin(dest, "src", c.RelSrcPath)
 			if i := strings.LastIndexByte(c.RelSrcPath, '/'); i != -1 {
@@ -368,7 +406,7 @@ func (c *Call) updateLocations(goroot, localgoroot string, localgomods, gopaths
 			return true
 		}
 		// For modules, the path has to be altered, as it contains the version.
-		if p := prefix + "/pkg/mod/"; strings.HasPrefix(c.RemoteSrcPath, p) {
+		if p := prefix + "/pkg/mod/"; hasFoldPrefix(c.RemoteSrcPath, p, r.fold) {
 			c.RelSrcPath = c.RemoteSrcPath[len(p):]
 			c.LocalSrcPath = pathJoin(dest, "pkg/mod", c.RelSrcPath)
 			if i := strings.LastIndexByte(c.RelSrcPath, '/'); i != -1 {
@@ -381,10 +419,10 @@ func (c *Call) updateLocations(goroot, localgoroot string, localgomods, gopaths
 		}
 	}
 	// Check Go modules.
-	// Go module path detection only works with stack traces created on the local
+	// Go module path detection only works with stack traces created in the local
 	// file system.
-	for prefix, pkg := range localgomods {
-		if strings.HasPrefix(c.RemoteSrcPath, prefix+"/") {
+	for prefix, pkg := range r.localGomods {
+		if hasFoldPrefix(c.RemoteSrcPath, prefix+"/", r.fold) {
 			c.RelSrcPath = c.RemoteSrcPath[len(prefix)+1:]
 			c.LocalSrcPath = c.RemoteSrcPath
 			if i := strings.LastIndexByte(c.RelSrcPath, '/'); i != -1 {
@@ -402,6 +440,128 @@ func (c *Call) updateLocations(goroot, localgoroot string, localgomods, gopaths
 	return false
 }
 
+// updateTrimmedLocations is the equivalent of updateLocations for paths that
+// are not rooted, as generated by "go build -trimpath" or by Bazel.
+//
+// The formats handled are:
+//   - "GOROOT/src/<pkg>/<file>": Bazel stdlib.
+//   - "external/<repo>/<file>": Bazel external repository.
+//   - "bazel-out/<config>/bin/<file>": Bazel generated file.
+//   - "<module>@<version>/<file>": -trimpath go module dependency.
+//   - "<module>/<file>": -trimpath main module, when found in localGomods.
+//   - "<pkg>/<file>": -trimpath stdlib, when the first element has no dot.
+//
+// Returns true if a local path was determined.
+func (c *Call) updateTrimmedLocations(r *roots) bool {
+	p := c.RemoteSrcPath
+	const bazelGOROOT = "GOROOT/src/"
+	const bazelExternal = "external/"
+	const bazelOut = "bazel-out/"
+	switch {
+	case strings.HasPrefix(p, bazelGOROOT):
+		c.RelSrcPath = p[len(bazelGOROOT):]
+		c.setImportPathFromRel("")
+		if c.Location == LocationUnknown {
+			c.Location = Stdlib
+		}
+		if r.localGOROOT != "" {
+			c.LocalSrcPath = pathJoin(r.localGOROOT, "src", c.RelSrcPath)
+			return true
+		}
+		return false
+
+	case strings.HasPrefix(p, bazelExternal):
+		// The repository name is mangled by gazelle (e.g.
+		// com_github_foo_bar) so the import path cannot be reliably determined
+		// from it. Keep the one from the function name.
+		c.RelSrcPath = p[len(bazelExternal):]
+		if c.Location == LocationUnknown {
+			c.Location = GoPkg
+		}
+		if r.localBazelOutputBase != "" {
+			c.LocalSrcPath = pathJoin(r.localBazelOutputBase, p)
+			return true
+		}
+		return false
+
+	case strings.HasPrefix(p, bazelOut):
+		// "bazel-out/<config>/bin/<path>"
+		if parts := strings.SplitN(p[len(bazelOut):], "/", 3); len(parts) == 3 {
+			c.RelSrcPath = parts[2]
+		}
+		if c.Location == LocationUnknown {
+			c.Location = GoMod
+		}
+		if r.localBazelExecRoot != "" {
+			c.LocalSrcPath = pathJoin(r.localBazelExecRoot, p)
+			return true
+		}
+		return false
+	}
+
+	c.RelSrcPath = p
+	if i := strings.IndexByte(p, '@'); i != -1 && strings.IndexByte(p[i:], '/') != -1 {
+		// -trimpath replaces $GOMODCACHE with an empty string. It is the same
+		// format as a go module dependency in $GOPATH/pkg/mod.
+		c.setImportPathFromRel("")
+		if c.Location == LocationUnknown {
+			c.Location = GoPkg
+		}
+		if r.localGOMODCACHE != "" {
+			c.LocalSrcPath = pathJoin(r.localGOMODCACHE, escapeModulePath(p))
+			return true
+		}
+		return false
+	}
+	// -trimpath replaces the main module directory with its import path.
+	// Prefer the longest match in case of nested modules. This is checked
+	// before the standard library since the main module path doesn't need a
+	// dot, e.g. "myapp".
+	root, pkg := "", ""
+	for dir, imp := range r.localGomods {
+		if strings.HasPrefix(p, imp+"/") && len(imp) > len(pkg) {
+			root, pkg = dir, imp
+		}
+	}
+	if pkg != "" {
+		c.RelSrcPath = p[len(pkg)+1:]
+		c.LocalSrcPath = pathJoin(root, c.RelSrcPath)
+		c.setImportPathFromRel(pkg)
+		if c.Location == LocationUnknown {
+			c.Location = GoMod
+		}
+		return true
+	}
+	c.setImportPathFromRel("")
+	if first := p[:strings.IndexByte(p, '/')]; !strings.Contains(first, ".") {
+		// -trimpath replaces $GOROOT/src with an empty string. Only the standard
+		// library is allowed to have an import path without a dot in the first
+		// element. This is the same heuristic than cmd/go.
+		if c.Location == LocationUnknown {
+			c.Location = Stdlib
+		}
+		if r.localGOROOT != "" {
+			c.LocalSrcPath = pathJoin(r.localGOROOT, "src", p)
+			return true
+		}
+	}
+	return false
+}
+
+// setImportPathFromRel sets ImportPath to the directory of RelSrcPath,
+// prefixed with pkg if specified.
+func (c *Call) setImportPathFromRel(pkg string) {
+	i := strings.LastIndexByte(c.RelSrcPath, '/')
+	switch {
+	case i == -1 && pkg != "":
+		c.ImportPath = pkg
+	case i != -1 && pkg != "":
+		c.ImportPath = pkg + "/" + c.RelSrcPath[:i]
+	case i != -1:
+		c.ImportPath = c.RelSrcPath[:i]
+	}
+}
+
 // equal returns true only if both calls are exactly equal.
 func (c *Call) equal(r *Call) bool {
 	return c.Line == r.Line && c.Func.Complete == r.Func.Complete && c.RemoteSrcPath == r.RemoteSrcPath && c.Args.equal(&r.Args)
@@ -422,10 +582,13 @@ func (c *Call) merge(r *Call) Call {
 		Line:          c.Line,
 		SrcName:       c.SrcName,
 		DirSrc:        c.DirSrc,
+		PCOffset:      c.PCOffset,
+		PC:            c.PC,
 		LocalSrcPath:  c.LocalSrcPath,
 		RelSrcPath:    c.RelSrcPath,
 		ImportPath:    c.ImportPath,
 		Location:      c.Location,
+		ModuleVersion: c.ModuleVersion,
 	}
 }
 
@@ -435,7 +598,8 @@ type Stack struct {
 	// function.
 	Calls []Call
 	// Elided is set when there's >100 items in Stack, currently hardcoded in
-	// package runtime.
+	// package runtime. Go 1.21 and later elide the calls in the middle of the
+	// stack instead of the outermost ones.
 	Elided bool
 
 	// Disallow initialization with unnamed parameters.
@@ -554,13 +718,13 @@ func (s *Stack) less(r *Stack) bool {
 
 // updateLocations calls updateLocations on each call frame and returns true if
 // they were all resolved.
-func (s *Stack) updateLocations(goroot, localgoroot string, localgomods, gopaths map[string]string) bool {
+func (s *Stack) updateLocations(r *roots) bool {
 	// If there were none, it was "resolved".
-	r := true
+	b := true
 	for i := range s.Calls {
-		r = s.Calls[i].updateLocations(goroot, localgoroot, localgomods, gopaths) && r
+		b = s.Calls[i].updateLocations(r) && b
 	}
-	return r
+	return b
 }
 
 // Signature represents the signature of one or multiple goroutines.
@@ -588,6 +752,11 @@ type Signature struct {
 	//    - scan, scanrunnable, scanrunning, scansyscall, scanwaiting, scandead,
 	//      scanenqueue
 	//
+	// Newer versions print the sync primitive, e.g. sync.Mutex.Lock,
+	// sync.WaitGroup.Wait or sync.Cond.Wait, and can append qualifiers like
+	// " (scan)", " (synctest)" or " (durable)". Use WaitReason() to get a
+	// structured value.
+	//
 	// When running under the race detector, the values are 'running' or
 	// 'finished'.
 	State string
@@ -698,10 +867,10 @@ func (s *Signature) SleepString() string {
 
 // updateLocations calls updateLocations on both CreatedBy and Stack and
 // returns true if they were both resolved.
-func (s *Signature) updateLocations(goroot, localgoroot string, localgomods, gopaths map[string]string) bool {
-	r := s.CreatedBy.updateLocations(goroot, localgoroot, localgomods, gopaths)
-	r = s.Stack.updateLocations(goroot, localgoroot, localgomods, gopaths) && r
-	return r
+func (s *Signature) updateLocations(r *roots) bool {
+	b := s.CreatedBy.updateLocations(r)
+	b = s.Stack.updateLocations(r) && b
+	return b
 }
 
 // Goroutine represents the state of one goroutine, including the stack trace.
@@ -714,6 +883,35 @@ type Goroutine struct {
 	// First is the goroutine first printed, normally the one that crashed.
 	First bool
 
+	// GP is the address of the runtime g structure of the goroutine.
+	//
+	// It is only printed by Go 1.23 and later with GOTRACEBACK=system or
+	// higher, or for the goroutine that crashed the runtime. Otherwise it is 0.
+	GP uint64
+	// M is the ID of the runtime m structure, the OS thread, running the
+	// goroutine. It is only valid when MP is not 0.
+	M int
+	// MP is the address of the runtime m structure running the goroutine. It
+	// is 0 when the goroutine is not running on a thread ("m=nil") or when it
+	// was not printed.
+	MP uint64
+	// Synctest is the ID of the testing/synctest bubble the goroutine is in,
+	// if any. Otherwise it is 0.
+	Synctest int
+
+	// Signal is the signal received by the thread running this goroutine, as
+	// printed by the runtime, e.g. "SIGSEGV: segmentation violation". It is
+	// only set for the goroutine printed right after the signal.
+	Signal string
+	// Registers is the register dump of the thread that received Signal, in
+	// the order printed. It is only printed with GOTRACEBACK=crash.
+	Registers []Register
+	// StackErrors are the diagnostics printed by the runtime when it failed to
+	// unwind the stack of this goroutine, e.g. "runtime: g 1: unexpected
+	// return pc for main.f called from 0xdeadbeef". The stack is likely
+	// incomplete when set.
+	StackErrors []string
+
 	// RaceWrite is true if a race condition was detected, and this goroutine was
 	// race on a write operation, otherwise it was a read.
 	RaceWrite bool
@@ -721,6 +919,55 @@ type Goroutine struct {
 	// Otherwise it is 0.
 	RaceAddr uint64
 
+	// Input is the range of the input lines of the goroutine, from its header
+	// to its last call, the empty line that follows excluded. For a data race,
+	// it is the stack of the memory access.
+	Input InputRange
+	// Raw is the original text of the lines in Input, including the end of
+	// line characters and any log prefix. It is only set with Opts.KeepRaw.
+	Raw []byte
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// InputRange is a range of lines in the input.
+//
+// With ScanSnapshot, the input starts at the io.Reader passed, unless
+// Opts.InputOffset and Opts.InputLine are set.
+type InputRange struct {
+	// Offset is the byte offset of the first line, starting at 0.
+	Offset int64
+	// End is the byte offset following the last line.
+	End int64
+	// FirstLine is the line number of the first line, starting at 1. It is 0
+	// when the range is not set.
+	FirstLine int
+	// LastLine is the line number of the last line.
+	LastLine int
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// extend extends the range to include o, which must follow it.
+func (r *InputRange) extend(o InputRange) {
+	if r.FirstLine == 0 {
+		*r = o
+		return
+	}
+	r.End = o.End
+	r.LastLine = o.LastLine
+}
+
+// Register is the value of a CPU register as printed in a register dump.
+type Register struct {
+	// Name is the register name as printed by the runtime, e.g. "rip" on amd64
+	// or "lr" on arm64.
+	Name string
+	// Value is the value of the register.
+	Value uint64
+
 	// Disallow initialization with unnamed parameters.
 	_ struct{}
 }
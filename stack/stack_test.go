@@ -15,6 +15,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestFuncInit(t *testing.T) {
@@ -69,6 +70,37 @@ func TestFuncInit(t *testing.T) {
 				Name:     "gc",
 			},
 		},
+		{
+			"runtime.gopark",
+			Func{
+				Complete:   "runtime.gopark",
+				ImportPath: "runtime",
+				DirName:    "runtime",
+				Name:       "gopark",
+				IsRuntime:  true,
+			},
+		},
+		{
+			"runtime.(*Frames).Next",
+			Func{
+				Complete:   "runtime.(*Frames).Next",
+				ImportPath: "runtime",
+				DirName:    "runtime",
+				Name:       "(*Frames).Next",
+				IsExported: true,
+				IsRuntime:  true,
+			},
+		},
+		{
+			"runtime.Goexit",
+			Func{
+				Complete:   "runtime.Goexit",
+				ImportPath: "runtime",
+				DirName:    "runtime",
+				Name:       "Goexit",
+				IsExported: true,
+			},
+		},
 	}
 	for _, line := range data {
 		got := newFunc(line.raw)
@@ -215,7 +247,8 @@ func TestCallPkg(t *testing.T) {
 			// Equivalent of calling GuessPaths().
 			gp := map[string]string{"/gpremote": "/gplocal"}
 			gm := map[string]string{"/gomod": "example.com/foo"}
-			if !c.updateLocations("/grremote", "/grlocal", gm, gp) {
+			r := roots{remoteGOROOT: "/grremote", localGOROOT: "/grlocal", localGomods: gm, remoteGOPATHs: gp}
+			if !c.updateLocations(&r) {
 				t.Error("Unexpected")
 			}
 			compareString(t, line.ImportPath, c.ImportPath)
@@ -228,6 +261,112 @@ func TestCallPkg(t *testing.T) {
 	}
 }
 
+func TestCallTrimmed(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		name string
+		f    string
+		s    string
+		// Expectations
+		LocalSrcPath string
+		RelSrcPath   string
+		ImportPath   string
+		Location     Location
+		resolved     bool
+	}{
+		{
+			name:         "Stdlib",
+			f:            "runtime.gopanic",
+			s:            "runtime/panic.go",
+			LocalSrcPath: "/grlocal/src/runtime/panic.go",
+			RelSrcPath:   "runtime/panic.go",
+			ImportPath:   "runtime",
+			Location:     Stdlib,
+			resolved:     true,
+		},
+		{
+			name:         "PkgMod",
+			f:            "github.com/BurntSushi/toml.Decode",
+			s:            "github.com/BurntSushi/toml@v0.3.1/decode.go",
+			LocalSrcPath: "/modcache/github.com/!burnt!sushi/toml@v0.3.1/decode.go",
+			RelSrcPath:   "github.com/BurntSushi/toml@v0.3.1/decode.go",
+			ImportPath:   "github.com/BurntSushi/toml@v0.3.1",
+			Location:     GoPkg,
+			resolved:     true,
+		},
+		{
+			name:         "MainModule",
+			f:            "main.main",
+			s:            "example.com/foo/cmd/panic/main.go",
+			LocalSrcPath: "/gomod/cmd/panic/main.go",
+			RelSrcPath:   "cmd/panic/main.go",
+			ImportPath:   "example.com/foo/cmd/panic",
+			Location:     GoMod,
+			resolved:     true,
+		},
+		{
+			name:       "UnknownModule",
+			f:          "example.org/bar.Baz",
+			s:          "example.org/bar/baz.go",
+			RelSrcPath: "example.org/bar/baz.go",
+			ImportPath: "example.org/bar",
+		},
+		{
+			name:         "BazelGOROOT",
+			f:            "runtime.gopanic",
+			s:            "GOROOT/src/runtime/panic.go",
+			LocalSrcPath: "/grlocal/src/runtime/panic.go",
+			RelSrcPath:   "runtime/panic.go",
+			ImportPath:   "runtime",
+			Location:     Stdlib,
+			resolved:     true,
+		},
+		{
+			name:         "BazelExternal",
+			f:            "github.com/foo/bar.Baz",
+			s:            "external/com_github_foo_bar/baz.go",
+			LocalSrcPath: "/bazel/external/com_github_foo_bar/baz.go",
+			RelSrcPath:   "com_github_foo_bar/baz.go",
+			ImportPath:   "github.com/foo/bar",
+			Location:     GoPkg,
+			resolved:     true,
+		},
+		{
+			name:         "BazelOut",
+			f:            "example.com/foo/proto.init",
+			s:            "bazel-out/k8-fastbuild/bin/proto/foo_go_proto_/foo.pb.go",
+			LocalSrcPath: "/bazel/execroot/ws/bazel-out/k8-fastbuild/bin/proto/foo_go_proto_/foo.pb.go",
+			RelSrcPath:   "proto/foo_go_proto_/foo.pb.go",
+			ImportPath:   "example.com/foo/proto",
+			Location:     GoMod,
+			resolved:     true,
+		},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
+			t.Parallel()
+			c := newCall(line.f, Args{}, line.s, 153)
+			r := roots{
+				localGOROOT:          "/grlocal",
+				localGomods:          map[string]string{"/gomod": "example.com/foo"},
+				localGOMODCACHE:      "/modcache",
+				localBazelOutputBase: "/bazel",
+				localBazelExecRoot:   "/bazel/execroot/ws",
+			}
+			if got := c.updateLocations(&r); got != line.resolved {
+				t.Errorf("want %t, got %t", line.resolved, got)
+			}
+			compareString(t, line.ImportPath, c.ImportPath)
+			if line.Location != c.Location {
+				t.Errorf("want %s, got %s", line.Location, c.Location)
+			}
+			compareString(t, line.LocalSrcPath, c.LocalSrcPath)
+			compareString(t, line.RelSrcPath, c.RelSrcPath)
+		})
+	}
+}
+
 func TestArgs(t *testing.T) {
 	t.Parallel()
 	a := Args{
@@ -364,10 +503,26 @@ func newCall(f string, a Args, s string, l int) Call {
 	return c
 }
 
+// newCallOffset returns a Call with the program counter offset printed with
+// "+0x".
+func newCallOffset(f string, a Args, s string, l int, off uint64) Call {
+	c := newCall(f, a, s, l)
+	c.PCOffset = off
+	return c
+}
+
+// newCallPC returns a Call with the program counter offset printed with "+0x"
+// and the absolute program counter printed with "pc=0x".
+func newCallPC(f string, a Args, s string, l int, off, pc uint64) Call {
+	c := newCallOffset(f, a, s, l, off)
+	c.PC = pc
+	return c
+}
+
 func newCallLocal(f string, a Args, s string, l int) Call {
 	c := newCall(f, a, s, l)
-	r := c.updateLocations(goroot, goroot, gomods, gopaths)
-	if !r {
+	r := roots{remoteGOROOT: goroot, localGOROOT: goroot, localGomods: gomods, remoteGOPATHs: gopaths}
+	if !c.updateLocations(&r) {
 		panic("Unexpected")
 	}
 	if c.LocalSrcPath == "" || c.RelSrcPath == "" {
@@ -395,13 +550,14 @@ func compareString(t *testing.T, want, got string) {
 	}
 }
 
-// similarGoroutines compares slice of Goroutine to be similar enough.
+// similarGoroutines compares slice of Goroutine to be similar enough. It is
+// used for the output of a binary compiled by the test.
 //
 // Warning: it mutates inputs.
 func similarGoroutines(t *testing.T, want, got []*Goroutine) {
 	helper(t)()
 	zapGoroutines(t, want, got)
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, ignoreBuild); diff != "" {
 		t.Fatalf("Goroutine mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -417,13 +573,14 @@ func zapGoroutines(t *testing.T, a, b []*Goroutine) {
 	}
 }
 
-// similarSignatures compares Signature to be similar enough.
+// similarSignatures compares Signature to be similar enough. It is used for
+// the output of a binary compiled by the test.
 //
 // Warning: it mutates inputs.
 func similarSignatures(t *testing.T, want, got *Signature) {
 	helper(t)()
 	zapSignatures(t, want, got)
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, ignoreBuild); diff != "" {
 		t.Fatalf("Signature mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -478,6 +635,14 @@ func zapArgs(t *testing.T, a, b *Args) {
 	}
 }
 
+// ignoreBuild ignores the program counters and the position of the
+// goroutines in the output of a binary compiled by the test, which depend on
+// the toolchain.
+var ignoreBuild = cmp.Options{
+	cmpopts.IgnoreFields(Call{}, "PCOffset", "PC"),
+	cmpopts.IgnoreFields(Goroutine{}, "Input"),
+}
+
 func compareGoroutines(t *testing.T, want, got []*Goroutine) {
 	helper(t)()
 	if diff := cmp.Diff(want, got); diff != "" {
@@ -17,21 +17,31 @@ func _() {
 	_ = x[gotFileFunc-6]
 	_ = x[gotFileCreated-7]
 	_ = x[gotUnavail-8]
-	_ = x[gotRaceHeader1-9]
-	_ = x[gotRaceHeader2-10]
-	_ = x[gotRaceOperationHeader-11]
-	_ = x[gotRaceOperationFunc-12]
-	_ = x[gotRaceOperationFile-13]
-	_ = x[betweenRaceOperations-14]
-	_ = x[gotRaceGoroutineHeader-15]
-	_ = x[gotRaceGoroutineFunc-16]
-	_ = x[gotRaceGoroutineFile-17]
-	_ = x[betweenRaceGoroutines-18]
+	_ = x[gotStackError-9]
+	_ = x[gotStackDump-10]
+	_ = x[gotSignal-11]
+	_ = x[gotSignalPC-12]
+	_ = x[gotRegister-13]
+	_ = x[gotSignalSeparator-14]
+	_ = x[gotRaceHeader1-15]
+	_ = x[gotRaceHeader2-16]
+	_ = x[gotRaceOperationHeader-17]
+	_ = x[gotRaceOperationFunc-18]
+	_ = x[gotRaceOperationFile-19]
+	_ = x[betweenRaceOperations-20]
+	_ = x[gotRaceHeapHeader-21]
+	_ = x[gotRaceHeapFunc-22]
+	_ = x[gotRaceHeapFile-23]
+	_ = x[gotRaceGlobal-24]
+	_ = x[gotRaceGoroutineHeader-25]
+	_ = x[gotRaceGoroutineFunc-26]
+	_ = x[gotRaceGoroutineFile-27]
+	_ = x[betweenRaceGoroutines-28]
 }
 
-const _state_name = "lookingdonebetweenRoutinegotRoutineHeadergotFuncgotCreatedgotFileFuncgotFileCreatedgotUnavailgotRaceHeader1gotRaceHeader2gotRaceOperationHeadergotRaceOperationFuncgotRaceOperationFilebetweenRaceOperationsgotRaceGoroutineHeadergotRaceGoroutineFuncgotRaceGoroutineFilebetweenRaceGoroutines"
+const _state_name = "lookingdonebetweenRoutinegotRoutineHeadergotFuncgotCreatedgotFileFuncgotFileCreatedgotUnavailgotStackErrorgotStackDumpgotSignalgotSignalPCgotRegistergotSignalSeparatorgotRaceHeader1gotRaceHeader2gotRaceOperationHeadergotRaceOperationFuncgotRaceOperationFilebetweenRaceOperationsgotRaceHeapHeadergotRaceHeapFuncgotRaceHeapFilegotRaceGlobalgotRaceGoroutineHeadergotRaceGoroutineFuncgotRaceGoroutineFilebetweenRaceGoroutines"
 
-var _state_index = [...]uint16{0, 7, 11, 25, 41, 48, 58, 69, 83, 93, 107, 121, 143, 163, 183, 204, 226, 246, 266, 287}
+var _state_index = [...]uint16{0, 7, 11, 25, 41, 48, 58, 69, 83, 93, 106, 118, 127, 138, 149, 167, 181, 195, 217, 237, 257, 278, 295, 310, 325, 338, 360, 380, 400, 421}
 
 func (i state) String() string {
 	if i < 0 || i >= state(len(_state_index)-1) {
@@ -0,0 +1,265 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+)
+
+// symbolize resolves the calls with an unknown source file "??" using the
+// symbol tables of the ELF executable p.
+//
+// Calls in C code that were inlined are expanded into one Call per inlined
+// function, innermost first.
+func symbolize(p string, goroutines []*Goroutine) error {
+	f, err := elf.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s, err := newSymbolizer(f)
+	if err != nil {
+		return err
+	}
+	for _, g := range goroutines {
+		s.computeSlide(g.Stack.Calls)
+	}
+	for _, g := range goroutines {
+		g.Stack.Calls = s.resolve(g.Stack.Calls)
+		g.CreatedBy.Calls = s.resolve(g.CreatedBy.Calls)
+	}
+	return nil
+}
+
+// symbolizer resolves program counters to source locations.
+type symbolizer struct {
+	// table is the Go symbol table, from .gopclntab.
+	table *gosym.Table
+	// dwarf is the DWARF debug information, used for C code. It is nil when
+	// the executable was stripped.
+	dwarf *dwarf.Data
+	// slide is the difference between the program counters at runtime and the
+	// addresses in the executable. It is non-zero for position independent
+	// executables.
+	slide    uint64
+	hasSlide bool
+}
+
+func newSymbolizer(f *elf.File) (*symbolizer, error) {
+	text := f.Section(".text")
+	pcln := f.Section(".gopclntab")
+	if text == nil || pcln == nil {
+		return nil, errors.New("no Go symbol table found")
+	}
+	pclntab, err := pcln.Data()
+	if err != nil {
+		return nil, err
+	}
+	// .gosymtab is empty on recent Go versions but it is still used by older
+	// ones.
+	var symtab []byte
+	if sect := f.Section(".gosymtab"); sect != nil {
+		if symtab, err = sect.Data(); err != nil {
+			return nil, err
+		}
+	}
+	table, err := gosym.NewTable(symtab, gosym.NewLineTable(pclntab, text.Addr))
+	if err != nil {
+		return nil, err
+	}
+	s := &symbolizer{table: table}
+	// Ignore the error, DWARF information is optional.
+	s.dwarf, _ = f.DWARF()
+	return s, nil
+}
+
+// computeSlide determines the load offset from a Go call that has both its
+// absolute program counter and its offset from the function entry point.
+func (s *symbolizer) computeSlide(calls []Call) {
+	if s.hasSlide {
+		return
+	}
+	for i := range calls {
+		c := &calls[i]
+		if c.PC == 0 || c.PCOffset == 0 {
+			continue
+		}
+		if fn := s.table.LookupFunc(c.Func.Complete); fn != nil {
+			s.slide = c.PC - (fn.Entry + c.PCOffset)
+			s.hasSlide = true
+			return
+		}
+	}
+}
+
+// resolve returns calls with the unknown source locations resolved.
+func (s *symbolizer) resolve(calls []Call) []Call {
+	var out []Call
+	for i := range calls {
+		c := &calls[i]
+		if c.RemoteSrcPath != "??" {
+			out = append(out, *c)
+			continue
+		}
+		// Only the leaf call has its program counter exactly on the
+		// instruction. The other ones point to the return address, which may be
+		// on the next source line.
+		adjust := uint64(0)
+		if i != 0 {
+			adjust = 1
+		}
+		frames := s.lookup(c, adjust)
+		if len(frames) == 0 {
+			out = append(out, *c)
+			continue
+		}
+		for j, f := range frames {
+			n := *c
+			if j != 0 {
+				n.Args = Args{}
+			}
+			if f.name != "" {
+				n.Func = Func{}
+				if err := n.Func.Init(f.name); err != nil {
+					n.Func = c.Func
+				}
+			}
+			n.RemoteSrcPath = ""
+			n.SrcName = ""
+			n.DirSrc = ""
+			n.init(f.file, f.line)
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// frame is a resolved source location.
+type frame struct {
+	name string
+	file string
+	line int
+}
+
+// lookup returns the source location of c, innermost first.
+func (s *symbolizer) lookup(c *Call, adjust uint64) []frame {
+	var pc uint64
+	if c.PC != 0 {
+		pc = c.PC - s.slide
+	} else if fn := s.table.LookupFunc(c.Func.Complete); fn != nil {
+		pc = fn.Entry + c.PCOffset
+	} else {
+		return nil
+	}
+	pc -= adjust
+	if file, line, fn := s.table.PCToLine(pc); fn != nil && file != "" {
+		return []frame{{name: fn.Name, file: file, line: line}}
+	}
+	if s.dwarf == nil {
+		return nil
+	}
+	return s.lookupDWARF(pc)
+}
+
+// lookupDWARF returns the source location of pc, including the functions
+// that were inlined, innermost first.
+func (s *symbolizer) lookupDWARF(pc uint64) []frame {
+	r := s.dwarf.Reader()
+	cu, err := r.SeekPC(pc)
+	if err != nil {
+		return nil
+	}
+	lr, err := s.dwarf.LineReader(cu)
+	if err != nil || lr == nil {
+		return nil
+	}
+	var le dwarf.LineEntry
+	if err := lr.SeekPC(pc, &le); err != nil || le.File == nil {
+		return nil
+	}
+	files := lineFiles(lr)
+
+	// Find the chain of functions containing pc, outermost first.
+	var chain []*dwarf.Entry
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil || e.Tag == 0 {
+			// End of the children of the innermost scope containing pc.
+			break
+		}
+		if e.Tag == dwarf.TagSubprogram || e.Tag == dwarf.TagInlinedSubroutine || e.Tag == dwarf.TagLexDwarfBlock {
+			if s.contains(e, pc) {
+				if e.Tag != dwarf.TagLexDwarfBlock {
+					chain = append(chain, e)
+				}
+				if !e.Children {
+					break
+				}
+				continue
+			}
+		}
+		if e.Children {
+			r.SkipChildren()
+		}
+	}
+
+	out := []frame{{file: le.File.Name, line: le.Line}}
+	if len(chain) == 0 {
+		return out
+	}
+	out[0].name = s.entryName(chain[len(chain)-1])
+	// Each inlined function has its call site in the enclosing function.
+	for i := len(chain) - 1; i > 0; i-- {
+		f := frame{name: s.entryName(chain[i-1])}
+		if idx, ok := chain[i].Val(dwarf.AttrCallFile).(int64); ok && idx >= 0 && int(idx) < len(files) && files[idx] != nil {
+			f.file = files[idx].Name
+		}
+		if l, ok := chain[i].Val(dwarf.AttrCallLine).(int64); ok {
+			f.line = int(l)
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// contains returns true if the entry e covers pc.
+func (s *symbolizer) contains(e *dwarf.Entry, pc uint64) bool {
+	ranges, err := s.dwarf.Ranges(e)
+	if err != nil {
+		return false
+	}
+	for _, r := range ranges {
+		if r[0] <= pc && pc < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// entryName returns the function name of e, following the abstract origin
+// for inlined functions.
+func (s *symbolizer) entryName(e *dwarf.Entry) string {
+	for i := 0; i < 4 && e != nil; i++ {
+		if name, ok := e.Val(dwarf.AttrName).(string); ok {
+			return name
+		}
+		off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if off, ok = e.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				return ""
+			}
+		}
+		r := s.dwarf.Reader()
+		r.Seek(off)
+		var err error
+		if e, err = r.Next(); err != nil {
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"debug/elf"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSymbolize(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("only ELF executables are supported")
+	}
+	p, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := elf.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSymbolizer(f)
+	_ = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := s.table.LookupFunc("github.com/maruel/panicparse/v2/stack.ScanSnapshot")
+	parse := s.table.LookupFunc("github.com/maruel/panicparse/v2/stack.parseFile")
+	if scan == nil || parse == nil {
+		t.Fatal("failed to find functions")
+	}
+	// Simulate a position independent executable loaded at a different address.
+	const slide = 0x10000
+	known := Call{PCOffset: 8, PC: parse.Entry + 8 + slide}
+	if err := known.Func.Init(parse.Name); err != nil {
+		t.Fatal(err)
+	}
+	known.init("/remote/stack/context.go", 1)
+	// A Go call with only its offset.
+	offset := Call{PCOffset: 8}
+	if err := offset.Func.Init(scan.Name); err != nil {
+		t.Fatal(err)
+	}
+	offset.init("??", 0)
+	// A call with only its absolute program counter, like C calls.
+	absolute := Call{PC: scan.Entry + 8 + slide}
+	absolute.Func = Func{Complete: "non-Go function", Name: "non-Go function"}
+	absolute.init("??", 0)
+
+	g := []*Goroutine{{Signature: Signature{Stack: Stack{Calls: []Call{absolute, offset, known}}}}}
+	if err := symbolize(p, g); err != nil {
+		t.Fatal(err)
+	}
+	calls := g[0].Stack.Calls
+	if len(calls) != 3 {
+		t.Fatalf("unexpected calls: %#v", calls)
+	}
+	for i, c := range calls[:2] {
+		if !strings.HasSuffix(c.RemoteSrcPath, "/stack/context.go") || c.SrcName != "context.go" || c.Line == 0 {
+			t.Errorf("#%d: unexpected location %s:%d", i, c.RemoteSrcPath, c.Line)
+		}
+		if c.Func.Complete != scan.Name {
+			t.Errorf("#%d: unexpected function %q", i, c.Func.Complete)
+		}
+	}
+	if calls[2].RemoteSrcPath != "/remote/stack/context.go" {
+		t.Errorf("known call was modified: %s", calls[2].RemoteSrcPath)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// TestOutput is the output of the tests of a package, reconstructed from a
+// "go test -json" stream.
+type TestOutput struct {
+	// Package is the import path of the package. It is empty for the lines that
+	// were not test events, like build errors printed to stderr.
+	Package string
+	// Output is the output of the package, as it would have been printed
+	// without -json. It can be parsed with ScanSnapshot.
+	Output []byte
+	// PanicTest is the test that printed "panic: ", if any. It is empty when
+	// the panic happened outside of a test, like a test timeout, even though
+	// its output is attributed to a running test in the stream.
+	PanicTest string
+	// Running are the tests that were started and not finished when "panic: "
+	// was printed, in the order they were started. It includes the paused
+	// parallel tests.
+	Running []string
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// ParseTestJSON reads a "go test -json" stream and returns the output of
+// each package, in the order they are returned by ScanTestJSON.
+//
+// The whole stream is read before returning, use ScanTestJSON to process each
+// package as soon as its tests ended.
+func ParseTestJSON(r io.Reader) ([]*TestOutput, error) {
+	var out []*TestOutput
+	err := ScanTestJSON(r, func(t *TestOutput) error {
+		out = append(out, t)
+		return nil
+	})
+	return out, err
+}
+
+// ScanTestJSON reads a "go test -json" stream and calls f with the output of
+// each package as soon as its tests ended.
+//
+// The output of the packages tested concurrently is interleaved in the
+// stream. The packages that didn't end, like one that panicked, are passed to
+// f at the end of the stream, in the order they were first seen. Lines that
+// are not test events are kept in a TestOutput with an empty Package, passed
+// to f at the end of the stream too.
+//
+// Stops and returns the error returned by f, if any.
+func ScanTestJSON(r io.Reader, f func(*TestOutput) error) error {
+	var order []*testState
+	pkgs := map[string]*testState{}
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) != 0 {
+			e := testEvent{}
+			if !isTestEvent(line, &e) {
+				e = testEvent{Action: "output", Output: string(line)}
+			}
+			p := pkgs[e.Package]
+			if p == nil {
+				p = &testState{TestOutput: &TestOutput{Package: e.Package}}
+				pkgs[e.Package] = p
+				order = append(order, p)
+			}
+			p.add(&e)
+			if e.isPackageEnd() {
+				delete(pkgs, e.Package)
+				for i := range order {
+					if order[i] == p {
+						order = append(order[:i], order[i+1:]...)
+						break
+					}
+				}
+				if err := f(p.TestOutput); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			for _, p := range order {
+				if err = f(p.TestOutput); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// IsTestJSON returns true if line is an event of a "go test -json" stream.
+func IsTestJSON(line []byte) bool {
+	e := testEvent{}
+	return isTestEvent(line, &e)
+}
+
+// Private stuff.
+
+// testEvent is an event as generated by cmd/test2json.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+// timeoutPanic is the start of the panic printed by the testing package when
+// the test binary timed out.
+const timeoutPanic = "panic: test timed out after "
+
+// testState is the state of the tests of a package while the stream is read.
+type testState struct {
+	*TestOutput
+	running  []string
+	panicked bool
+}
+
+// add processes an event.
+func (t *testState) add(e *testEvent) {
+	switch e.Action {
+	case "run":
+		if e.Test != "" {
+			t.running = append(t.running, e.Test)
+		}
+	case "pass", "fail", "skip":
+		for i, n := range t.running {
+			if n == e.Test {
+				t.running = append(t.running[:i], t.running[i+1:]...)
+				break
+			}
+		}
+	}
+	if e.Output == "" {
+		return
+	}
+	if !t.panicked && strings.HasPrefix(e.Output, "panic: ") {
+		t.panicked = true
+		// test2json attributes the output of the test binary to the last test
+		// started, even when the panic didn't happen in a test.
+		if !strings.HasPrefix(e.Output, timeoutPanic) {
+			t.PanicTest = e.Test
+		}
+		t.Running = append([]string{}, t.running...)
+	}
+	t.Output = append(t.Output, e.Output...)
+}
+
+// isPackageEnd returns true if the event is the end of the tests of a
+// package.
+func (e *testEvent) isPackageEnd() bool {
+	if e.Package == "" || e.Test != "" {
+		return false
+	}
+	return e.Action == "pass" || e.Action == "fail" || e.Action == "skip"
+}
+
+// isTestEvent returns true if line is a JSON object with an Action.
+func isTestEvent(line []byte, e *testEvent) bool {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return false
+	}
+	return json.Unmarshal(line, e) == nil && e.Action != ""
+}
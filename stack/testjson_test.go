@@ -0,0 +1,180 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseTestJSON(t *testing.T) {
+	t.Parallel()
+	in := testJSONStream(t, []testEvent{
+		{Action: "start", Package: "example.com/a"},
+		{Action: "run", Package: "example.com/a", Test: "TestSlow"},
+		{Action: "output", Package: "example.com/a", Test: "TestSlow", Output: "=== RUN   TestSlow\n"},
+		{Action: "run", Package: "example.com/b", Test: "TestOk"},
+		{Action: "output", Package: "example.com/b", Test: "TestOk", Output: "=== RUN   TestOk\n"},
+		{Action: "run", Package: "example.com/a", Test: "TestParallel"},
+		{Action: "pause", Package: "example.com/a", Test: "TestParallel"},
+		{Action: "run", Package: "example.com/a", Test: "TestFast"},
+		{Action: "pass", Package: "example.com/a", Test: "TestFast"},
+		{Action: "output", Package: "example.com/b", Test: "TestOk", Output: "--- PASS: TestOk (0.00s)\n"},
+		{Action: "pass", Package: "example.com/b", Test: "TestOk"},
+		// test2json attributes the timeout to the last test started.
+		{Action: "output", Package: "example.com/a", Test: "TestSlow", Output: "panic: test timed out after 1s\n"},
+		{Action: "output", Package: "example.com/a", Test: "TestSlow", Output: "\n"},
+		{Action: "output", Package: "example.com/a", Test: "TestSlow", Output: "goroutine 1 [running]:\n"},
+		{Action: "output", Package: "example.com/a", Test: "TestSlow", Output: "main.main()\n"},
+		{Action: "output", Package: "example.com/a", Test: "TestSlow", Output: "\t/gopath/src/foo/main.go:8 +0x25\n"},
+		{Action: "fail", Package: "example.com/a", Test: "TestSlow"},
+		{Action: "fail", Package: "example.com/a"},
+	})
+	in = "# example.com/c\nbuild failed\n" + in
+	got, err := ParseTestJSON(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// example.com/a ended first, the others are returned at the end.
+	want := []*TestOutput{
+		{
+			Package: "example.com/a",
+			Output:  []byte("=== RUN   TestSlow\npanic: test timed out after 1s\n\ngoroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:8 +0x25\n"),
+			Running: []string{"TestSlow", "TestParallel"},
+		},
+		{Output: []byte("# example.com/c\nbuild failed\n")},
+		{
+			Package: "example.com/b",
+			Output:  []byte("=== RUN   TestOk\n--- PASS: TestOk (0.00s)\n"),
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(TestOutput{})); diff != "" {
+		t.Fatalf("Mismatch (-want +got):\n%s", diff)
+	}
+
+	s, _, err := ScanSnapshot(bytes.NewReader(got[0].Output), ioutil.Discard, &Opts{})
+	if s == nil {
+		t.Fatal(err)
+	}
+	if len(s.Goroutines) != 1 {
+		t.Fatalf("unexpected goroutines: %d", len(s.Goroutines))
+	}
+}
+
+func TestParseTestJSON_PanicTest(t *testing.T) {
+	t.Parallel()
+	in := testJSONStream(t, []testEvent{
+		{Action: "run", Package: "example.com/a", Test: "TestCrash"},
+		{Action: "output", Package: "example.com/a", Test: "TestCrash", Output: "panic: oh no [recovered]\n"},
+		{Action: "output", Package: "example.com/a", Test: "TestCrash", Output: "panic: oh no\n"},
+	})
+	got, err := ParseTestJSON(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].PanicTest != "TestCrash" {
+		t.Fatalf("unexpected output %#v", got)
+	}
+	if diff := cmp.Diff([]string{"TestCrash"}, got[0].Running); diff != "" {
+		t.Fatalf("Mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestScanTestJSON(t *testing.T) {
+	t.Parallel()
+	first := testJSONStream(t, []testEvent{
+		{Action: "run", Package: "example.com/a", Test: "TestA"},
+		{Action: "output", Package: "example.com/a", Test: "TestA", Output: "ok\n"},
+		{Action: "pass", Package: "example.com/a", Test: "TestA"},
+		{Action: "pass", Package: "example.com/a"},
+	})
+	second := testJSONStream(t, []testEvent{
+		{Action: "output", Package: "example.com/b", Output: "running\n"},
+	})
+	r, w := io.Pipe()
+	done := make(chan error)
+	got := make(chan *TestOutput)
+	go func() {
+		done <- ScanTestJSON(r, func(t *TestOutput) error {
+			got <- t
+			return nil
+		})
+	}()
+	// The output of a package is returned as soon as its tests ended, before
+	// the end of the stream.
+	go func() {
+		_, _ = io.WriteString(w, first)
+	}()
+	if o := <-got; o.Package != "example.com/a" || string(o.Output) != "ok\n" {
+		t.Fatalf("unexpected output %#v", o)
+	}
+	go func() {
+		_, _ = io.WriteString(w, second)
+		_ = w.Close()
+	}()
+	if o := <-got; o.Package != "example.com/b" || string(o.Output) != "running\n" {
+		t.Fatalf("unexpected output %#v", o)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanTestJSON_Error(t *testing.T) {
+	t.Parallel()
+	in := testJSONStream(t, []testEvent{
+		{Action: "pass", Package: "example.com/a"},
+		{Action: "pass", Package: "example.com/b"},
+	})
+	var got []string
+	errFoo := errors.New("foo")
+	err := ScanTestJSON(strings.NewReader(in), func(t *TestOutput) error {
+		got = append(got, t.Package)
+		return errFoo
+	})
+	if err != errFoo {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"example.com/a"}, got); diff != "" {
+		t.Fatalf("Mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestIsTestJSON(t *testing.T) {
+	t.Parallel()
+	data := map[string]bool{
+		`{"Action":"run","Package":"a","Test":"TestA"}` + "\n": true,
+		`{"log":"goroutine 1 [running]:\n"}`:                   false,
+		"goroutine 1 [running]:\n":                             false,
+		"":                                                     false,
+	}
+	for line, want := range data {
+		if got := IsTestJSON([]byte(line)); got != want {
+			t.Errorf("IsTestJSON(%q) = %t", line, got)
+		}
+	}
+}
+
+//
+
+func testJSONStream(t *testing.T, events []testEvent) string {
+	out := ""
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out += string(b) + "\n"
+	}
+	return out
+}
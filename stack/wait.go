@@ -0,0 +1,142 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"strings"
+)
+
+// WaitCategory is the category of the reason a goroutine is not running.
+type WaitCategory int
+
+const (
+	// WaitOther is a state that is not recognized or that doesn't fit in the
+	// other categories, like "GC assist marking" or "dead".
+	WaitOther WaitCategory = iota
+	// WaitRunning is a goroutine that is not waiting: "running", "runnable" or
+	// a race detector "finished" goroutine.
+	WaitRunning
+	// WaitLock is a goroutine blocked on a sync primitive, e.g.
+	// "sync.Mutex.Lock", "sync.WaitGroup.Wait" or "semacquire".
+	WaitLock
+	// WaitChannel is a goroutine blocked on a channel operation or a select.
+	WaitChannel
+	// WaitIO is a goroutine blocked on the network poller: "IO wait".
+	WaitIO
+	// WaitTimer is a goroutine sleeping: "sleep".
+	WaitTimer
+	// WaitSyscall is a goroutine in a system call: "syscall".
+	WaitSyscall
+	// WaitRuntimeIdle is an idle runtime goroutine, like "GC worker (idle)",
+	// "finalizer wait" or "GC sweep wait".
+	WaitRuntimeIdle
+)
+
+// WaitReason is the structured form of Signature.State.
+type WaitReason struct {
+	// Reason is the state without the qualifiers in parenthesis, e.g. "chan
+	// receive" for "chan receive (nil chan)". The qualifiers that are part of
+	// the name, like "GC worker (idle)", are kept.
+	Reason string
+	// Category is the category of Reason.
+	Category WaitCategory
+	// NilChan is set for an operation on a nil channel, which blocks forever:
+	// "(nil chan)".
+	NilChan bool
+	// Scan is set when the goroutine stack was being scanned by the garbage
+	// collector: "(scan)".
+	Scan bool
+	// Synctest is set when the goroutine is blocked in a testing/synctest
+	// bubble: "(synctest)" or "(durable)".
+	Synctest bool
+	// Durable is set when the goroutine is durably blocked in a
+	// testing/synctest bubble: "(durable)".
+	Durable bool
+
+	// Disallow initialization with unnamed parameters.
+	_ struct{}
+}
+
+// WaitReason returns the structured form of State.
+func (s *Signature) WaitReason() WaitReason {
+	w := WaitReason{Reason: s.State}
+	// Strip the qualifiers that can be appended, in any order.
+	for {
+		if r := strings.TrimSuffix(w.Reason, " (scan)"); r != w.Reason {
+			w.Reason, w.Scan = r, true
+		} else if r := strings.TrimSuffix(w.Reason, " (durable)"); r != w.Reason {
+			w.Reason, w.Synctest, w.Durable = r, true, true
+		} else if r := strings.TrimSuffix(w.Reason, " (synctest)"); r != w.Reason {
+			w.Reason, w.Synctest = r, true
+		} else if r := strings.TrimSuffix(w.Reason, " (nil chan)"); r != w.Reason {
+			w.Reason, w.NilChan = r, true
+		} else {
+			break
+		}
+	}
+	w.Category = waitCategory(w.Reason)
+	return w
+}
+
+// Private stuff.
+
+// waitCategories maps the wait reasons, as listed in waitReasonStrings in
+// src/runtime/runtime2.go, and the goroutine statuses to their category.
+//
+// The ones not listed are WaitOther, except the ones found by waitCategory().
+var waitCategories = map[string]WaitCategory{
+	"running":  WaitRunning,
+	"runnable": WaitRunning,
+	"finished": WaitRunning,
+
+	"semacquire":          WaitLock,
+	"semarelease":         WaitLock,
+	"sync.Mutex.Lock":     WaitLock,
+	"sync.RWMutex.Lock":   WaitLock,
+	"sync.RWMutex.RLock":  WaitLock,
+	"sync.WaitGroup.Wait": WaitLock,
+	"sync.Cond.Wait":      WaitLock,
+
+	"chan send":         WaitChannel,
+	"chan receive":      WaitChannel,
+	"select":            WaitChannel,
+	"select (no cases)": WaitChannel,
+
+	"IO wait": WaitIO,
+
+	"sleep": WaitTimer,
+
+	"syscall": WaitSyscall,
+
+	"GC worker (idle)":           WaitRuntimeIdle,
+	"GC sweep wait":              WaitRuntimeIdle,
+	"GC scavenge wait":           WaitRuntimeIdle,
+	"GC background sweeper wait": WaitRuntimeIdle,
+	"GC weak to strong wait":     WaitRuntimeIdle,
+	"Concurrent GC wait":         WaitRuntimeIdle,
+	"finalizer wait":             WaitRuntimeIdle,
+	"cleanup wait":               WaitRuntimeIdle,
+	"trace reader (blocked)":     WaitRuntimeIdle,
+	"wait for GC cycle":          WaitRuntimeIdle,
+	"wait until GC ends":         WaitRuntimeIdle,
+	"wait for debug call":        WaitRuntimeIdle,
+}
+
+// waitCategory returns the category of the wait reason without qualifiers.
+func waitCategory(r string) WaitCategory {
+	if c, ok := waitCategories[r]; ok {
+		return c
+	}
+	// Best effort for wait reasons added in future versions.
+	switch {
+	case strings.HasPrefix(r, "sync."):
+		return WaitLock
+	case strings.HasPrefix(r, "chan ") || strings.HasPrefix(r, "select"):
+		return WaitChannel
+	case strings.HasSuffix(r, "(idle)"):
+		return WaitRuntimeIdle
+	}
+	return WaitOther
+}
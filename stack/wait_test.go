@@ -0,0 +1,45 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSignature_WaitReason(t *testing.T) {
+	t.Parallel()
+	data := map[string]WaitReason{
+		"running":                       {Reason: "running", Category: WaitRunning},
+		"runnable (scan)":               {Reason: "runnable", Category: WaitRunning, Scan: true},
+		"sync.Mutex.Lock":               {Reason: "sync.Mutex.Lock", Category: WaitLock},
+		"sync.WaitGroup.Wait":           {Reason: "sync.WaitGroup.Wait", Category: WaitLock},
+		"sync.Cond.Wait":                {Reason: "sync.Cond.Wait", Category: WaitLock},
+		"semacquire":                    {Reason: "semacquire", Category: WaitLock},
+		"sync.Future.Wait":              {Reason: "sync.Future.Wait", Category: WaitLock},
+		"chan receive":                  {Reason: "chan receive", Category: WaitChannel},
+		"chan send (nil chan)":          {Reason: "chan send", Category: WaitChannel, NilChan: true},
+		"chan receive (synctest)":       {Reason: "chan receive", Category: WaitChannel, Synctest: true},
+		"select (durable)":              {Reason: "select", Category: WaitChannel, Synctest: true, Durable: true},
+		"select (no cases)":             {Reason: "select (no cases)", Category: WaitChannel},
+		"IO wait":                       {Reason: "IO wait", Category: WaitIO},
+		"IO wait (scan)":                {Reason: "IO wait", Category: WaitIO, Scan: true},
+		"sleep":                         {Reason: "sleep", Category: WaitTimer},
+		"syscall":                       {Reason: "syscall", Category: WaitSyscall},
+		"GC worker (idle)":              {Reason: "GC worker (idle)", Category: WaitRuntimeIdle},
+		"force gc (idle)":               {Reason: "force gc (idle)", Category: WaitRuntimeIdle},
+		"finalizer wait":                {Reason: "finalizer wait", Category: WaitRuntimeIdle},
+		"GC assist marking":             {Reason: "GC assist marking", Category: WaitOther},
+		"sync.WaitGroup.Wait (durable)": {Reason: "sync.WaitGroup.Wait", Category: WaitLock, Synctest: true, Durable: true},
+	}
+	for state, want := range data {
+		s := Signature{State: state}
+		if diff := cmp.Diff(want, s.WaitReason(), cmp.AllowUnexported(WaitReason{})); diff != "" {
+			t.Errorf("%q: Mismatch (-want +got):\n%s", state, diff)
+		}
+	}
+	compareString(t, "WaitRuntimeIdle", WaitRuntimeIdle.String())
+}
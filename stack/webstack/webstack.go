@@ -10,9 +10,11 @@ package webstack
 
 import (
 	"bytes"
+	"html/template"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"runtime"
 	"strconv"
 
@@ -44,6 +46,14 @@ import (
 //
 // similarity: (default: "anypointer") Can be one of stack.Similarity value in
 // lowercase: "exactflags", "exactlines", "anypointer" or "anyvalue".
+//
+// docurl: (default: "") Base URL of a documentation server, like a local
+// pkgsite, in the form [prefix=]URL. URL must be an absolute http or https
+// URL. Can be specified multiple times. See stack.DocServer for more details.
+//
+// srcurl: (default: "") Base URL of a source server, like a local godoc, in
+// the form [prefix=]URL. URL must be an absolute http or https URL. Can be
+// specified multiple times.
 func SnapshotHandler(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "GET" {
 		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
@@ -69,6 +79,24 @@ func SnapshotHandler(w http.ResponseWriter, req *http.Request) {
 			opts.AnalyzeSources = false
 		}
 	}
+	l := stack.DefaultLinkResolver()
+	for _, v := range req.Form["docurl"] {
+		prefix, u := stack.SplitDocServer(v)
+		if !isHTTPURL(u) {
+			http.Error(w, "invalid docurl value", http.StatusBadRequest)
+			return
+		}
+		l.DocServers = append(l.DocServers, stack.DocServer{Prefix: prefix, DocURL: u})
+	}
+	for _, v := range req.Form["srcurl"] {
+		prefix, u := stack.SplitDocServer(v)
+		if !isHTTPURL(u) {
+			http.Error(w, "invalid srcurl value", http.StatusBadRequest)
+			return
+		}
+		l.DocServers = append(l.DocServers, stack.DocServer{Prefix: prefix, SrcURL: u})
+	}
+
 	c, err := snapshot(maxmem, opts)
 	if err != nil {
 		http.Error(w, "failed to process the snapshot, try a larger maxmem value", http.StatusInternalServerError)
@@ -90,12 +118,29 @@ func SnapshotHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	o := &stack.HTMLOpts{Links: l}
+	for _, d := range c.Diagnostics {
+		if d.Kind == stack.Truncated && d.Line == 0 {
+			o.Footer = template.HTML(template.HTMLEscapeString(d.Msg))
+		}
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_ = c.Aggregate(s).ToHTML(w, "")
+	_ = c.Aggregate(s).ToHTMLWithOptions(w, o)
+}
+
+// isHTTPURL returns true if s is an absolute http or https URL.
+//
+// The doc and source servers are provided by the request, so anything else,
+// like a javascript: URL, is refused.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
 }
 
 // snapshot returns a Context based on the snapshot of the stacks of the
 // current process.
+//
+// A Truncated diagnostic is added when maxmem was not enough.
 func snapshot(maxmem int, opts *stack.Opts) (*stack.Snapshot, error) {
 	// We don't know how big the buffer needs to be to collect all the
 	// goroutines. Start with 1 MB and try a few times, doubling each time. Give
@@ -104,6 +149,7 @@ func snapshot(maxmem int, opts *stack.Opts) (*stack.Snapshot, error) {
 	if maxmem < len(buf) {
 		maxmem = len(buf)
 	}
+	truncated := false
 	for i := 0; ; i++ {
 		n := runtime.Stack(buf, true)
 		if n < len(buf) {
@@ -111,6 +157,7 @@ func snapshot(maxmem int, opts *stack.Opts) (*stack.Snapshot, error) {
 			break
 		}
 		if len(buf) >= maxmem {
+			truncated = true
 			break
 		}
 		l := len(buf) * 2
@@ -124,5 +171,11 @@ func snapshot(maxmem int, opts *stack.Opts) (*stack.Snapshot, error) {
 	if err == io.EOF {
 		err = nil
 	}
+	if truncated && s != nil {
+		s.Diagnostics = append(s.Diagnostics, stack.Diagnostic{
+			Kind: stack.Truncated,
+			Msg:  "the snapshot was truncated at maxmem=" + strconv.Itoa(maxmem) + " bytes; increase maxmem to see all the goroutines",
+		})
+	}
 	return s, err
 }
@@ -7,6 +7,8 @@ package webstack
 import (
 	"context"
 	"net/http/httptest"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -21,6 +23,7 @@ func TestSnapshotHandler(t *testing.T) {
 		"/debug?similarity=exactlines",
 		"/debug?similarity=anypointer",
 		"/debug?similarity=anyvalue",
+		"/debug?docurl=https://pkgsite.example.com/&srcurl=git.example.com/=http://godoc.example.com/src/",
 	}
 	for _, url := range data {
 		url := url
@@ -41,6 +44,10 @@ func TestSnapshotHandler_Err(t *testing.T) {
 		"/debug?augment=2",
 		"/debug?maxmem=abc",
 		"/debug?similarity=alike",
+		"/debug?docurl=javascript:alert(1)//",
+		"/debug?docurl=git.example.com/=javascript:alert(1)//",
+		"/debug?srcurl=//evil.example.com/",
+		"/debug?srcurl=file:///etc/",
 	}
 	for _, url := range data {
 		url := url
@@ -108,6 +115,11 @@ func TestSnapshotHandler_LargeMemory(t *testing.T) {
 	if w.Code != 200 && w.Code != 500 {
 		t.Fatalf("%d\n%s", w.Code, w.Body.String())
 	}
+	if w.Code == 200 && runtime.Stack(make([]byte, 2<<20), true) > 1048577 {
+		if !strings.Contains(w.Body.String(), "truncated at maxmem=1048577 bytes") {
+			t.Fatal("expected the truncation to be reported")
+		}
+	}
 
 	cancel()
 	wg.Wait()